@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"pylontech_exporter/src/config"
+	"pylontech_exporter/src/fetcher"
+	"pylontech_exporter/src/metrics"
+	"pylontech_exporter/src/snapshot"
+)
+
+// shutdownTimeout bounds how long in-flight HTTP requests may take to finish
+// after SIGINT/SIGTERM.
+const shutdownTimeout = 10 * time.Second
+
+var errIdentityMismatch = errors.New("device identity does not match EXPECTED_DEVICE_SERIAL")
+
+// collectionCycle holds the state of one device carried from one collection
+// cycle to the next. Cycles of a device run either from the ticker or from a
+// scrape, never concurrently; cycles of different devices run in parallel.
+type collectionCycle struct {
+	name          string // Device name, the device label of its metrics
+	console       fetcher.Fetcher
+	store         *snapshot.Store
+	health        *unitHealth
+	auxCollectors *auxScheduler
+	topology      *unitTopology
+	readiness     *readiness
+	// fetchConcurrency limits the bat commands that run at the same time.
+	fetchConcurrency int
+
+	expectedSerial    string
+	enforceSerial     bool
+	identityMatches   bool
+	lastIdentityCheck time.Time
+	// powerSampled is set when the power output of the running cycle was
+	// read; cycles without it skip the stack energy integration.
+	powerSampled bool
+}
+
+func newCollectionCycle(device *fetcher.Device, cfg config.Config, expectedSerial string, ready *readiness) *collectionCycle {
+	c := &collectionCycle{
+		name:             device.Name,
+		console:          device,
+		store:            snapshot.NewStore(),
+		health:           newUnitHealth(device.Name, cfg.UnitDisableAfter, cfg.Refresh, cfg.UnitCooldown),
+		topology:         newUnitTopology(cfg.UnitShrinkCycles),
+		readiness:        ready,
+		fetchConcurrency: cfg.FetchConcurrency,
+		expectedSerial:   expectedSerial,
+		enforceSerial:    cfg.EnforceSerial,
+		identityMatches:  true,
+	}
+	c.auxCollectors = newAuxScheduler(device.Name, cfg.AuxRefresh, cfg.CommandTiers, []auxCollector{
+		{command: "power", defaultTier: tierFast, collect: c.processPowerData},
+		{command: "info", defaultTier: tierStartup, collect: c.processINFOData},
+		{command: "stat", defaultTier: tierSlow, collect: c.processSTATData},
+		{command: "soh", defaultTier: tierSlow, collect: c.processSOHData},
+		{command: "log", defaultTier: tierSlow, collect: c.processEventLog},
+	})
+	return c
+}
+
+// run collects all due commands once. It returns an error when pwr could not
+// be read or collection is blocked by an identity mismatch. Stages after pwr
+// are skipped once ctx is done.
+func (c *collectionCycle) run(ctx context.Context) error {
+	c.console.BeginCycle()
+	if c.expectedSerial != "" && (!c.identityMatches || c.lastIdentityCheck.IsZero() || time.Since(c.lastIdentityCheck) >= time.Hour) {
+		if matches, ok := c.verifyDeviceIdentity(ctx, c.expectedSerial); ok {
+			if !matches && c.enforceSerial {
+				metrics.ResetDeviceMetrics(c.name)
+			}
+			c.identityMatches = matches
+			c.lastIdentityCheck = time.Now()
+		}
+	}
+	if !c.identityMatches && c.enforceSerial {
+		slog.Warn("Skipping data collection until the identity matches EXPECTED_DEVICE_SERIAL", "device", c.name)
+		c.store.SetStale(true)
+		return errIdentityMismatch
+	}
+
+	c.powerSampled = false
+	defer func() {
+		if !c.powerSampled {
+			metrics.PauseStackEnergy(c.name)
+		}
+	}()
+
+	slog.Debug("Fetching and processing data", "device", c.name)
+	started := time.Now()
+	pwrUnitIDs := c.processPWRData(ctx)
+	metrics.RecordCommandRun(c.name, "pwr", started, len(pwrUnitIDs) > 0)
+	if len(pwrUnitIDs) > 0 {
+		c.readiness.recordSuccess(c.name, time.Now())
+	}
+	unitIDs, unitSource := c.topology.observe(pwrUnitIDs, time.Now())
+	metrics.SetUnitTopology(c.name, unitSource, c.topology.confirmedAt)
+
+	defer c.store.CompleteCycle()
+	batCollected := false
+	defer func() { c.store.SetStale(len(pwrUnitIDs) == 0 || !batCollected) }()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	started = time.Now()
+	metrics.RecordCommandRun(c.name, "pwrsys", started, c.processPWRSYSData(ctx))
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	started = time.Now()
+	batCollected = c.processBATData(ctx, unitIDs)
+	metrics.RecordCommandRun(c.name, "bat", started, batCollected)
+	if batCollected && c.readiness.recordCollected(c.name) {
+		slog.Info("First full collection cycle completed", "device", c.name)
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	c.auxCollectors.runDue(ctx, unitIDs, time.Now())
+
+	if len(pwrUnitIDs) == 0 {
+		return fmt.Errorf("pwr data of device %s could not be collected", c.name)
+	}
+	return nil
+}
+
+// runCycles runs one cycle for every device, at most workers at a time. A
+// failing device does not stop the others; an error is only returned when
+// no device could be read.
+func runCycles(ctx context.Context, cycles []*collectionCycle, workers int) error {
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		errs  []error
+		limit = make(chan struct{}, workers)
+	)
+	for _, c := range cycles {
+		wg.Add(1)
+		limit <- struct{}{}
+		go func(c *collectionCycle) {
+			defer wg.Done()
+			defer func() { <-limit }()
+			if err := c.run(ctx); err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	if len(errs) == len(cycles) {
+		return errors.Join(errs...)
+	}
+	for _, err := range errs {
+		slog.Error("Collection failed", "error", err)
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// readiness tracks when the pwr output of each device was last fetched and
+// parsed, the outcome of the last collection and which devices completed a
+// full collection cycle. Collection cycles report to it; /readyz and
+// METRICS_REQUIRE_DATA read it.
+type readiness struct {
+	mu             sync.Mutex
+	lastSuccess    map[string]time.Time
+	collected      map[string]bool // Device -> pwr and all bat units succeeded in one cycle
+	collections    int             // Collections of all devices since startup
+	lastCollection error           // Outcome of the last collection of all devices
+	window         time.Duration
+	requireData    bool
+}
+
+// newReadiness returns a readiness that is ready while a device succeeded
+// within window. A zero window bases readiness on the last collection
+// instead, for COLLECTION_MODE=collector where scrapes set the pace. With
+// requireData (METRICS_REQUIRE_DATA) every device must also have completed
+// a full collection cycle once.
+func newReadiness(window time.Duration, requireData bool, devices []string) *readiness {
+	collected := map[string]bool{}
+	for _, device := range devices {
+		collected[device] = false
+	}
+	return &readiness{lastSuccess: map[string]time.Time{}, collected: collected, window: window, requireData: requireData}
+}
+
+// recordCollection notes the outcome of a collection of all devices.
+func (r *readiness) recordCollection(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collections++
+	r.lastCollection = err
+}
+
+// recordSuccess notes a successful pwr collection of a device.
+func (r *readiness) recordSuccess(device string, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastSuccess[device] = at
+}
+
+// recordCollected notes a full collection cycle of a device and reports
+// whether it was the first one.
+func (r *readiness) recordCollected(device string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	first := !r.collected[device]
+	r.collected[device] = true
+	return first
+}
+
+// dataCollected reports whether every device completed a full collection
+// cycle, and the reason when one did not.
+func (r *readiness) dataCollected() (bool, string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.dataCollectedLocked()
+}
+
+func (r *readiness) dataCollectedLocked() (bool, string) {
+	var missing []string
+	for device, collected := range r.collected {
+		if !collected {
+			missing = append(missing, device)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return false, "no full collection since startup for device " + strings.Join(missing, ", ")
+	}
+	return true, ""
+}
+
+// check reports whether any device succeeded within the window, or in the
+// last collection with a zero window, and, with requireData, every device
+// completed a full collection cycle, and the reason when not.
+func (r *readiness) check(now time.Time) (bool, string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.requireData {
+		if collected, reason := r.dataCollectedLocked(); !collected {
+			return false, reason
+		}
+	}
+	if r.window == 0 {
+		switch {
+		case r.collections == 0:
+			return false, "no scrape since startup"
+		case r.lastCollection != nil:
+			return false, "last collection failed: " + r.lastCollection.Error()
+		}
+		return true, ""
+	}
+	var latest time.Time
+	for _, at := range r.lastSuccess {
+		if at.After(latest) {
+			latest = at
+		}
+	}
+	if latest.IsZero() {
+		return false, "no successful scrape since startup"
+	}
+	if age := now.Sub(latest); age > r.window {
+		return false, fmt.Sprintf("last success %ds ago", int(age.Seconds()))
+	}
+	return true, ""
+}
+
+// ServeHTTP answers /readyz: 200 while ready, 503 with the reason otherwise.
+func (r *readiness) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	if ready, reason := r.check(time.Now()); !ready {
+		http.Error(w, reason, http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+// requireCollectedData responds 503 until every device completed a full
+// collection cycle. Until then the response is buffered, because in
+// COLLECTION_MODE=collector the scrape itself runs the collection that may
+// complete the data.
+func requireCollectedData(next http.Handler, ready *readiness) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if collected, _ := ready.dataCollected(); collected {
+			next.ServeHTTP(w, r)
+			return
+		}
+		buffered := &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+		next.ServeHTTP(buffered, r)
+		if collected, reason := ready.dataCollected(); !collected {
+			http.Error(w, reason, http.StatusServiceUnavailable)
+			return
+		}
+		for name, values := range buffered.header {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(buffered.status)
+		w.Write(buffered.body.Bytes())
+	})
+}
+
+// bufferedResponse holds a response until requireCollectedData decides
+// whether to send it.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header         { return b.header }
+func (b *bufferedResponse) WriteHeader(status int)      { b.status = status }
+func (b *bufferedResponse) Write(p []byte) (int, error) { return b.body.Write(p) }
+
+// healthz answers /healthz as long as the HTTP server is serving.
+func healthz(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
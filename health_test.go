@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReadinessRequiresDataOfEveryDevice(t *testing.T) {
+	ready := newReadiness(time.Minute, true, []string{"garage", "basement"})
+	metricsHandler := requireCollectedData(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}), ready)
+	now := time.Now()
+	status := func(h http.Handler) int {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec.Code
+	}
+
+	ready.recordSuccess("garage", now)
+	ready.recordSuccess("basement", now)
+	if !ready.recordCollected("garage") {
+		t.Fatal("the first full collection of garage is not reported as the first")
+	}
+	if ready.recordCollected("garage") {
+		t.Fatal("the second full collection of garage is reported as the first")
+	}
+	if ok, reason := ready.check(now); ok || reason != "no full collection since startup for device basement" {
+		t.Fatalf("check = %v %q, want not ready until basement collected", ok, reason)
+	}
+	if got := status(metricsHandler); got != http.StatusServiceUnavailable {
+		t.Fatalf("/metrics status = %d before basement collected, want 503", got)
+	}
+
+	ready.recordCollected("basement")
+	if ok, reason := ready.check(now); !ok {
+		t.Fatalf("check = not ready (%s) after every device collected", reason)
+	}
+	if got := status(metricsHandler); got != http.StatusOK {
+		t.Fatalf("/metrics status = %d after every device collected, want 200", got)
+	}
+	if got := status(ready); got != http.StatusOK {
+		t.Fatalf("/readyz status = %d after every device collected, want 200", got)
+	}
+}
+
+func TestReadinessWithoutRequiredData(t *testing.T) {
+	ready := newReadiness(time.Minute, false, []string{"garage", "basement"})
+	now := time.Now()
+	ready.recordSuccess("garage", now)
+	if ok, reason := ready.check(now); !ok {
+		t.Fatalf("check = not ready (%s) with a recent pwr success", reason)
+	}
+	if ok, _ := ready.check(now.Add(2 * time.Minute)); ok {
+		t.Fatal("check = ready after the window passed without a success")
+	}
+}
+
+func TestReadinessInCollectorMode(t *testing.T) {
+	ready := newReadiness(0, true, []string{"default"})
+	// The scrape runs the collection that completes the data
+	metricsHandler := requireCollectedData(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		ready.recordSuccess("default", time.Now())
+		ready.recordCollected("default")
+		ready.recordCollection(nil)
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintln(w, "devicemon_up 1")
+	}), ready)
+
+	if ok, reason := ready.check(time.Now()); ok || reason != "no full collection since startup for device default" {
+		t.Fatalf("check = %v %q before the first scrape", ok, reason)
+	}
+	rec := httptest.NewRecorder()
+	metricsHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "devicemon_up 1\n" || rec.Header().Get("Content-Type") != "text/plain" {
+		t.Fatalf("/metrics = %d %q, want the metrics of the scrape that collected the data", rec.Code, rec.Body.String())
+	}
+	// Scrapes set the pace, so an old success is no reason to be unready
+	if ok, reason := ready.check(time.Now().Add(time.Hour)); !ok {
+		t.Fatalf("check = not ready (%s) after a successful scrape", reason)
+	}
+
+	ready.recordCollection(errors.New("no device could be read"))
+	if ok, reason := ready.check(time.Now()); ok || reason != "last collection failed: no device could be read" {
+		t.Fatalf("check = %v %q after a failed scrape", ok, reason)
+	}
+}
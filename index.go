@@ -0,0 +1,51 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+
+	"pylontech_exporter/src/version"
+)
+
+// indexPage is the landing page at /, like the one of node_exporter.
+var indexPage = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Pylontech Exporter</title></head>
+<body>
+<h1>Pylontech Exporter</h1>
+<p>Version {{.Version}}</p>
+<ul>
+{{- range .Links}}
+<li><a href="{{.Path}}">{{.Path}}</a> - {{.Text}}</li>
+{{- end}}
+</ul>
+</body>
+</html>
+`))
+
+type indexLink struct {
+	Path string
+	Text string
+}
+
+// indexLinks are the endpoints listed on the landing page.
+var indexLinks = []indexLink{
+	{"/metrics", "Prometheus metrics"},
+	{"/api/v1/summary", "JSON summary of the latest snapshot"},
+	{"/api/v1/status", "Latest pwr, bat and pwrsys rows as JSON"},
+	{"/healthz", "Liveness"},
+	{"/readyz", "Readiness"},
+}
+
+// index serves the landing page; every other unregistered path is a 404.
+func index(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	indexPage.Execute(w, struct {
+		Version string
+		Links   []indexLink
+	}{version.String(), indexLinks})
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"os"
+
+	"pylontech_exporter/src/config"
+	"pylontech_exporter/src/fetcher"
+	"pylontech_exporter/src/metrics"
+	"pylontech_exporter/src/parser"
+)
+
+// newLogger builds the logger for LOG_LEVEL and LOG_FORMAT, both validated by
+// config.Load.
+func newLogger(cfg config.Config, w io.Writer) *slog.Logger {
+	var level slog.Level
+	level.UnmarshalText([]byte(cfg.LogLevel))
+	opts := &slog.HandlerOptions{Level: level}
+	if cfg.LogFormat == "json" {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+// useLogger makes l the default logger, which the standard log package
+// writes to as well, and gives the packages their own loggers with a
+// component attribute.
+func useLogger(l *slog.Logger) {
+	slog.SetDefault(l)
+	parser.SetLogger(l.With("component", "parser"))
+	fetcher.SetLogger(l.With("component", "fetcher"))
+	metrics.SetLogger(l.With("component", "metrics"))
+}
+
+// fatal logs msg at error level and exits, like log.Fatal.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
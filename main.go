@@ -1,209 +1,836 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
+	"pylontech_exporter/src/api"
+	"pylontech_exporter/src/config"
 	"pylontech_exporter/src/fetcher"
+	"pylontech_exporter/src/grpcapi"
+	"pylontech_exporter/src/influx"
 	"pylontech_exporter/src/metrics"
+	"pylontech_exporter/src/mqtt"
 	"pylontech_exporter/src/parser"
+	"pylontech_exporter/src/snapshot"
+	"pylontech_exporter/src/version"
 
 	"github.com/joho/godotenv"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 var (
-	verbose bool
+	deviceProfile parser.Profile
+	// expectedModules is EXPECTED_MODULES, 0 when unset
+	expectedModules int
+	// ignoredUnits holds the unit IDs from IGNORE_UNITS; reloaded on SIGHUP
+	ignoredUnits atomic.Pointer[map[int]bool]
 )
 
-func logVerbose(format string, v ...interface{}) {
-	if verbose {
-		log.Printf(format, v...)
+func main() {
+	envErr := godotenv.Load()
+	cfg, err := config.Load(os.Args[1:], os.Environ())
+	if errors.Is(err, flag.ErrHelp) {
+		return
 	}
-}
+	if err != nil {
+		fatal("Invalid configuration", "error", err)
+	}
+	if cfg.ShowVersion {
+		fmt.Println("pylontech-prom-export", version.String())
+		return
+	}
+	useLogger(newLogger(cfg, os.Stderr))
+	if envErr != nil {
+		slog.Info("No .env file found, relying on environment variables")
+	}
+	slog.Info("Effective configuration", "config", cfg.String())
 
-func main() {
-	err := godotenv.Load()
+	fetcher.Configure(cfg.Fetch)
+	metrics.Configure(cfg.Metrics)
+
+	// Validated by config.Load
+	deviceProfile, _ = parser.LookupProfile(cfg.DeviceProfile)
+	if cfg.TempScale != "" {
+		deviceProfile.TempScale = parser.TempScales[cfg.TempScale]
+	}
+	slog.Debug("Using device profile", "profile", deviceProfile.Name, "temp_scale", deviceProfile.TempScale)
+	expectedModules = cfg.ExpectedModules
+
+	loadIgnoredUnits()
+
+	if len(cfg.Args) > 0 && cfg.Args[0] == "watch" {
+		deviceName := ""
+		if len(cfg.Args) > 1 {
+			deviceName = cfg.Args[1]
+		}
+		if err := runWatch(cfg.Refresh, deviceName); err != nil {
+			fatal("Watch mode failed", "error", err)
+		}
+		return
+	}
+
+	// A single command, including its retries, must fit into the interval it
+	// runs in
+	cycleBudget, budgetName := cfg.Refresh, "refresh interval"
+	if cfg.CollectionMode == "collector" {
+		cycleBudget, budgetName = cfg.ScrapeTimeout, "scrape timeout"
+	}
+	for _, command := range []string{"pwr", "pwrsys", "bat"} {
+		if deadline := fetcher.CommandDeadline(command); deadline > cycleBudget {
+			slog.Warn("Fetch timeout including retries is larger than the "+budgetName, "command", command, "timeout", deadline.String(), "budget", cycleBudget.String())
+		}
+	}
+
+	// SIGINT/SIGTERM cancel running collections and stop the HTTP server
+	shutdownCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Initialize Prometheus metrics and get the custom registry. The cycles
+	// are created afterwards, so device metrics published while loading the
+	// devices are not lost.
+	var cycles []*collectionCycle
+	var ready *readiness
+	collectAll := func(ctx context.Context) error {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		defer context.AfterFunc(shutdownCtx, cancel)()
+		defer parser.FlushWarnings()
+		err := runCycles(ctx, cycles, cfg.DeviceConcurrency)
+		ready.recordCollection(err)
+		return err
+	}
+	var customRegistry *prometheus.Registry
+	if cfg.CollectionMode == "ticker" {
+		customRegistry, err = metrics.InitMetrics()
+	} else {
+		customRegistry, err = metrics.InitCollector(collectAll, cfg.ScrapeTimeout)
+	}
 	if err != nil {
-		log.Println("No .env file found, relying on environment variables")
+		fatal("Could not initialize metrics", "error", err)
 	}
-	refreshSecondsStr := os.Getenv("REFRESH_SECONDS")
-	if refreshSecondsStr == "" {
-		refreshSecondsStr = "30"
+	// Integrate current and power across gaps of at most SAMPLE_MAX_GAP
+	metrics.SetSampleMaxGap(cfg.SampleMaxGap)
+	timeouts := map[string]time.Duration{}
+	for _, command := range config.Commands {
+		timeouts[command] = fetcher.CommandTimeout(command)
 	}
-	refreshSeconds, err := strconv.Atoi(refreshSecondsStr)
-	if err != nil || refreshSeconds < 1 {
-		log.Printf("Invalid REFRESH_SECONDS value '%s', defaulting to 30", refreshSecondsStr)
-		refreshSeconds = 30
+	metrics.SetFetchTimeouts(timeouts)
+	if err := metrics.LoadEventState(cfg.EventStateFile); err != nil {
+		slog.Warn("Could not read the event state file, starting without the event log position", "path", cfg.EventStateFile, "error", err)
 	}
 
-	verbose = strings.ToLower(os.Getenv("LOG_VERBOSE")) == "true"
+	devices, err := fetcher.LoadDevices()
+	if err != nil {
+		fatal("Invalid device configuration", "error", err)
+	}
+	expectedSerial := cfg.ExpectedSerial
+	if expectedSerial != "" && len(devices) > 1 {
+		slog.Warn("EXPECTED_DEVICE_SERIAL only applies to a single device, ignoring it")
+		expectedSerial = ""
+	}
+	// /readyz fails after READY_INTERVALS refresh intervals without a pwr
+	// output, or in collector mode when the last scrape could not read any
+	// device
+	var deviceNames []string
+	for _, device := range devices {
+		deviceNames = append(deviceNames, device.Name)
+	}
+	readyWindow := time.Duration(cfg.ReadyIntervals) * cfg.Refresh
+	if cfg.CollectionMode == "collector" {
+		readyWindow = 0
+	}
+	ready = newReadiness(readyWindow, cfg.MetricsRequireData, deviceNames)
+	for _, device := range devices {
+		cycles = append(cycles, newCollectionCycle(device, cfg, expectedSerial, ready))
+		metrics.SetIgnoredUnits(device.Name, ignoredUnitIDs())
+	}
 
-	// Initialize Prometheus metrics and get the custom registry
-	customRegistry := metrics.InitMetrics()
+	go handleReloadSignals(cycles)
 
 	// Start HTTP server for Prometheus metrics
+	server := &http.Server{Addr: cfg.ListenAddress}
 	go func() {
-		port := os.Getenv("PORT")
-		if port == "" {
-			port = "9100" // fallback default
-		}
-
 		// Use HandlerFor with the custom registry
-		http.Handle("/metrics", promhttp.HandlerFor(customRegistry, promhttp.HandlerOpts{}))
-		log.Printf("Starting HTTP server on :%s", port)
-		if err := http.ListenAndServe(":"+port, nil); err != nil {
-			log.Fatalf("Error starting HTTP server: %v", err)
+		var metricsHandler http.Handler = promhttp.HandlerFor(metrics.WithDeviceLabels(customRegistry), promhttp.HandlerOpts{})
+		if cfg.MetricsRequireData {
+			metricsHandler = requireCollectedData(metricsHandler, ready)
+		}
+		http.Handle("/metrics", metricsHandler)
+		http.Handle("/api/v1/summary", deviceHandler(cycles, api.SummaryHandler))
+		http.Handle("/api/v1/status", deviceHandler(cycles, api.StatusHandler))
+		http.HandleFunc("/healthz", healthz)
+		http.Handle("/readyz", ready)
+		http.HandleFunc("/", index)
+		slog.Info("Starting HTTP server", "address", cfg.ListenAddress)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("Could not start HTTP server", "error", err)
 		}
 	}()
 
-	// Data fetching and processing loop
-	ticker := time.NewTicker(time.Duration(refreshSeconds) * time.Second)
-	defer ticker.Stop()
-	lastStatFetch := time.Time{}
-
-	for {
-		<-ticker.C
-		logVerbose("Fetching and processing device data...")
-		pwrUnitCount := processPWRData()
-		processBATData(pwrUnitCount)
-		if lastStatFetch.IsZero() || time.Since(lastStatFetch) >= time.Hour {
-			if processSTATData(pwrUnitCount) {
-				lastStatFetch = time.Now()
+	// Optional gRPC API, only started when configured
+	if cfg.GRPC.Listen != "" {
+		go func() {
+			grpcConfig := grpcapi.Config{
+				ListenAddr: cfg.GRPC.Listen,
+				CertFile:   cfg.GRPC.CertFile,
+				KeyFile:    cfg.GRPC.KeyFile,
+				Token:      cfg.GRPC.Token,
+			}
+			slog.Info("Starting gRPC server", "address", cfg.GRPC.Listen)
+			if len(cycles) > 1 {
+				slog.Info("The gRPC API serves the first device only", "device", cycles[0].name)
+			}
+			if err := grpcapi.Serve(grpcConfig, cycles[0].store); err != nil {
+				fatal("Could not start gRPC server", "error", err)
+			}
+		}()
+	}
+
+	// Optional MQTT publisher, fed after each collection cycle
+	if cfg.MQTT.Broker != "" {
+		if cfg.CollectionMode == "collector" {
+			slog.Warn("MQTT is published after each collection cycle, which only runs on scrapes in COLLECTION_MODE=collector; set COLLECTION_MODE=ticker to publish without Prometheus")
+		}
+		mqttDevices := make([]mqtt.Device, 0, len(cycles))
+		for _, c := range cycles {
+			mqttDevices = append(mqttDevices, mqtt.Device{Name: c.name, Store: c.store})
+		}
+		mqttConfig := mqtt.Config{
+			Broker:          cfg.MQTT.Broker,
+			Username:        cfg.MQTT.Username,
+			Password:        cfg.MQTT.Password,
+			ClientID:        cfg.MQTT.ClientID,
+			TopicPrefix:     cfg.MQTT.TopicPrefix,
+			DiscoveryPrefix: cfg.MQTT.DiscoveryPrefix,
+		}
+		if err := mqtt.Start(mqttConfig, mqttDevices); err != nil {
+			fatal("Could not start MQTT publisher", "error", err)
+		}
+		slog.Info("Publishing to MQTT broker", "broker", cfg.MQTT.Broker)
+	}
+
+	// Optional InfluxDB push output, written after each collection cycle
+	if cfg.Influx.URL != "" {
+		if cfg.CollectionMode == "collector" {
+			slog.Warn("InfluxDB is written after each collection cycle, which only runs on scrapes in COLLECTION_MODE=collector; set COLLECTION_MODE=ticker to write without Prometheus")
+		}
+		influxDevices := make([]influx.Device, 0, len(cycles))
+		for _, c := range cycles {
+			influxDevices = append(influxDevices, influx.Device{Name: c.name, Store: c.store})
+		}
+		influxConfig := influx.Config{
+			URL:    cfg.Influx.URL,
+			Token:  cfg.Influx.Token,
+			Org:    cfg.Influx.Org,
+			Bucket: cfg.Influx.Bucket,
+		}
+		if err := influx.Start(influxConfig, influxDevices); err != nil {
+			fatal("Could not start InfluxDB output", "error", err)
+		}
+		slog.Info("Writing to InfluxDB", "url", cfg.Influx.URL, "bucket", cfg.Influx.Bucket)
+	}
+
+	if cfg.CollectionMode == "ticker" {
+		// Data fetching and processing loop, starting right away so /metrics
+		// is not empty for the first interval
+		ticker := time.NewTicker(cfg.Refresh)
+		defer ticker.Stop()
+		for shutdownCtx.Err() == nil {
+			started := time.Now()
+			collectAll(shutdownCtx)
+			if took := time.Since(started); took > cfg.Refresh {
+				slog.Warn("Collection took longer than the refresh interval, raise FETCH_CONCURRENCY or REFRESH_SECONDS", "took", took.Round(time.Millisecond).String(), "refresh", cfg.Refresh.String())
+			}
+			slog.Debug("Data processing complete, waiting for the next tick")
+			select {
+			case <-ticker.C:
+			case <-shutdownCtx.Done():
+			}
+		}
+	}
+
+	// In collector mode collection runs inside scrapes, so only the signal
+	// is left to wait for
+	<-shutdownCtx.Done()
+	stop()
+	slog.Info("Shutting down")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error("Could not shut down HTTP server", "error", err)
+	}
+}
+
+// handleReloadSignals reloads file-based configuration on SIGHUP and has
+// the startup tier, e.g. the info output, collected again.
+func handleReloadSignals(cycles []*collectionCycle) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		slog.Info("Received SIGHUP, reloading configuration")
+		if err := fetcher.ReloadTLS(); err != nil {
+			slog.Error("Could not reload the device client certificate, keeping the previous one", "error", err)
+		}
+		// The process environment is fixed, so pick up an edited .env value
+		if values, err := godotenv.Read(); err == nil {
+			if value, ok := values["IGNORE_UNITS"]; ok {
+				os.Setenv("IGNORE_UNITS", value)
 			}
 		}
-		logVerbose("Data processing complete. Waiting for next tick.")
+		loadIgnoredUnits()
+		for _, c := range cycles {
+			metrics.SetIgnoredUnits(c.name, ignoredUnitIDs())
+			c.auxCollectors.rerunStartup()
+		}
 	}
 }
 
-// processBATData fetches, parses, and updates metrics for BAT command
-func processBATData(pwrUnitCount int8) {
-	if pwrUnitCount <= 0 {
-		log.Println("No power units specified for BAT data processing (pwrUnitCount <= 0).")
-		return
+// loadIgnoredUnits reads IGNORE_UNITS, a comma-separated list of unit IDs
+// (e.g. "4" or "2,5") that are skipped by bat/stat collection and by the
+// module presence check. Unlike the rest of the configuration it is read
+// here, as SIGHUP reloads it at runtime.
+func loadIgnoredUnits() {
+	ignored := map[int]bool{}
+	for _, raw := range strings.Split(os.Getenv("IGNORE_UNITS"), ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		id, err := strconv.Atoi(raw)
+		if err != nil || id < 1 {
+			slog.Warn("Invalid IGNORE_UNITS entry, ignoring it", "entry", raw)
+			continue
+		}
+		ignored[id] = true
+	}
+	if len(ignored) > 0 {
+		slog.Info("Ignoring units", "units", sortedUnitIDs(ignored))
 	}
+	ignoredUnits.Store(&ignored)
+}
 
-	totalRecordsProcessedOverall := 0
-	unitsSuccessfullyProcessed := 0
+func isUnitIgnored(id int) bool {
+	ignored := ignoredUnits.Load()
+	return ignored != nil && (*ignored)[id]
+}
 
-	for unitNum := int8(1); unitNum <= pwrUnitCount; unitNum++ {
-		var commandToFetch string
-		var unitMetricLabel string
+func ignoredUnitIDs() []int {
+	ignored := ignoredUnits.Load()
+	if ignored == nil {
+		return nil
+	}
+	return sortedUnitIDs(*ignored)
+}
 
-		suffix := strconv.Itoa(int(unitNum))
-		commandToFetch = "bat " + suffix
-		unitMetricLabel = "bat" + suffix
+func sortedUnitIDs(units map[int]bool) []int {
+	ids := make([]int, 0, len(units))
+	for id := range units {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
 
-		logVerbose("Fetching BAT data for unit %s (command: %s)...", unitMetricLabel, commandToFetch)
-		batLines, err := fetcher.FetchConsoleOutput(commandToFetch)
-		if err != nil {
-			log.Printf("Error fetching BAT data for unit %s: %v", unitMetricLabel, err)
-			metrics.RecordError("bat_fetch_" + unitMetricLabel)
+// verifyDeviceIdentity compares the device barcode from the info command with
+// the expected serial. ok is false when the check could not be performed.
+func (c *collectionCycle) verifyDeviceIdentity(ctx context.Context, expectedSerial string) (matches bool, ok bool) {
+	infoLines, err := c.console.FetchConsoleOutput(ctx, "info")
+	if err != nil {
+		slog.Error("Could not fetch info for the identity check", "device", c.name, "command", "info", "error", err)
+		recordFetchError(c.name, "info_fetch", err)
+		return false, false
+	}
+
+	info, err := parser.ParseInfo(infoLines)
+	if err != nil {
+		slog.Error("Could not parse info for the identity check", "device", c.name, "command", "info", "error", err)
+		metrics.RecordError(c.name, "info_parse")
+		return false, false
+	}
+
+	matches = strings.EqualFold(info.Barcode, expectedSerial)
+	if !matches {
+		slog.Error("Device identity mismatch", "device", c.name, "serial", info.Barcode, "expected", expectedSerial)
+	} else {
+		slog.Debug("Device identity verified", "device", c.name, "serial", info.Barcode)
+	}
+	metrics.SetDeviceIdentityMismatch(c.name, !matches)
+	return matches, true
+}
+
+// deviceHandler serves the store of the device named by the "device" query
+// parameter, or of the first device when it is omitted.
+func deviceHandler(cycles []*collectionCycle, newHandler func(*snapshot.Store) http.Handler) http.Handler {
+	handlers := make(map[string]http.Handler, len(cycles))
+	for _, c := range cycles {
+		handlers[c.name] = newHandler(c.store)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("device")
+		if name == "" {
+			name = cycles[0].name
+		}
+		handler, ok := handlers[name]
+		if !ok {
+			http.Error(w, "unknown device", http.StatusNotFound)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// batResult is the outcome of fetching and parsing the bat output of one unit.
+type batResult struct {
+	unitID   int
+	statuses []parser.BatteryStatus
+	stage    string // "fetch" or "parse" when err is set
+	err      error
+}
+
+// fetchDueUnits fetches the units among unitIDs that health is not backing
+// off from, at most concurrency at a time, and records each outcome in
+// health. fetch does the actual work, e.g. fetchBATUnit. The results are in
+// completion order; skipped units have none.
+func fetchDueUnits(ctx context.Context, health *unitHealth, unitIDs []int, concurrency int, fetch func(context.Context, int) batResult) []batResult {
+	due := make([]int, 0, len(unitIDs))
+	for _, unitID := range unitIDs {
+		if !health.shouldFetch(unitID, time.Now()) {
+			slog.Debug("Skipping unit in backoff", "device", health.device, "unit", "bat"+strconv.Itoa(unitID))
 			continue
 		}
+		due = append(due, unitID)
+	}
 
-		logVerbose("Parsing BAT data for unit %s...", unitMetricLabel)
-		batDataForUnit, err := parser.ParseBAT(batLines)
-		if err != nil {
-			log.Printf("Error parsing BAT data for unit %s: %v", unitMetricLabel, err)
-			metrics.RecordError("bat_parse_" + unitMetricLabel)
+	jobs := make(chan int)
+	results := make(chan batResult)
+	workers := min(max(concurrency, 1), len(due))
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for unitID := range jobs {
+				results <- fetch(ctx, unitID)
+			}
+		}()
+	}
+	go func() {
+		for _, unitID := range due {
+			jobs <- unitID
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	// Only this goroutine touches health, so it needs no locking
+	collected := make([]batResult, 0, len(due))
+	for result := range results {
+		if result.err != nil {
+			health.recordFailure(result.unitID, time.Now())
+		} else {
+			health.recordSuccess(result.unitID)
+		}
+		collected = append(collected, result)
+	}
+	return collected
+}
+
+func (c *collectionCycle) fetchBATUnit(ctx context.Context, unitID int) batResult {
+	commandToFetch := "bat " + strconv.Itoa(unitID)
+	slog.Debug("Fetching", "device", c.name, "command", commandToFetch, "unit", "bat"+strconv.Itoa(unitID))
+	batLines, err := c.console.FetchConsoleOutput(ctx, commandToFetch)
+	if err != nil {
+		return batResult{unitID: unitID, stage: "fetch", err: err}
+	}
+
+	slog.Debug("Parsing", "device", c.name, "command", commandToFetch, "unit", "bat"+strconv.Itoa(unitID))
+	statuses, err := deviceProfile.ParseBAT(batLines)
+	if err != nil {
+		return batResult{unitID: unitID, stage: "parse", err: err}
+	}
+	return batResult{unitID: unitID, statuses: statuses}
+}
+
+// processBATData fetches, parses, and updates metrics for BAT command.
+// Units are fetched concurrently (see fetchDueUnits); results are applied
+// here one at a time, so the metrics need no locking.
+// It reports whether at least one unit was due and every due unit was
+// fetched and parsed successfully.
+func (c *collectionCycle) processBATData(ctx context.Context, unitIDs []int) bool {
+	if len(unitIDs) == 0 {
+		slog.Warn("No units to fetch", "device", c.name, "command", "bat")
+		return false
+	}
+
+	totalRecordsProcessedOverall := 0
+	unitsSuccessfullyProcessed := 0
+	stackUnits := make([]string, 0, len(unitIDs))
+	units := make([]int, 0, len(unitIDs))
+
+	for _, unitID := range unitIDs {
+		if isUnitIgnored(unitID) {
 			continue
 		}
+		// Units in backoff stay in the stack; their series are only dropped once they leave it
+		stackUnits = append(stackUnits, "bat"+strconv.Itoa(unitID))
+		units = append(units, unitID)
+	}
 
+	results := fetchDueUnits(ctx, c.health, units, c.fetchConcurrency, c.fetchBATUnit)
+	unitsAttempted := len(results)
+	for _, result := range results {
+		unitMetricLabel := "bat" + strconv.Itoa(result.unitID)
+		switch {
+		case result.err != nil && result.stage == "fetch":
+			slog.Error("Fetch failed", "device", c.name, "command", "bat", "unit", unitMetricLabel, "error", result.err)
+			recordFetchError(c.name, "bat_fetch_"+unitMetricLabel, result.err)
+			continue
+		case result.err != nil:
+			slog.Error("Parse failed", "device", c.name, "command", "bat", "unit", unitMetricLabel, "error", result.err)
+			metrics.RecordError(c.name, "bat_parse_"+unitMetricLabel)
+			continue
+		}
+
+		batDataForUnit := result.statuses
 		if len(batDataForUnit) == 0 {
-			log.Printf("No BAT data parsed for unit %s.", unitMetricLabel)
+			slog.Warn("No records parsed", "device", c.name, "command", "bat", "unit", unitMetricLabel)
 		}
 
+		metrics.SetUnitLastSuccess(c.name, "bat", unitMetricLabel, time.Now())
+
 		for _, status := range batDataForUnit {
-			metrics.UpdateBatteryMetrics(unitMetricLabel, status)
+			metrics.UpdateBatteryMetrics(c.name, unitMetricLabel, status)
 		}
+		metrics.SyncBatteryCells(c.name, unitMetricLabel, batDataForUnit)
+		metrics.UpdateCellAggregates(c.name, unitMetricLabel, batDataForUnit)
+		metrics.ObserveCellVoltages(c.name, unitMetricLabel, batDataForUnit)
+		metrics.UpdateSOCEstimate(c.name, unitMetricLabel, time.Now(), batDataForUnit)
+		c.store.SetBattery(unitMetricLabel, batDataForUnit)
 
 		if len(batDataForUnit) > 0 {
-			logVerbose("Successfully processed %d BAT records for unit %s.", len(batDataForUnit), unitMetricLabel)
+			slog.Debug("Processed records", "device", c.name, "command", "bat", "unit", unitMetricLabel, "records", len(batDataForUnit))
 		}
 		totalRecordsProcessedOverall += len(batDataForUnit)
 		unitsSuccessfullyProcessed++
 	}
 
+	metrics.RetireBatteryUnits(c.name, stackUnits)
+
 	if unitsSuccessfullyProcessed > 0 {
-		logVerbose("Finished processing BAT data for %d unit(s). Total records processed: %d.\n", unitsSuccessfullyProcessed, totalRecordsProcessedOverall)
-	} else if pwrUnitCount > 0 {
-		log.Println("Attempted to process BAT data, but no units were successfully fetched or parsed.")
+		slog.Debug("Finished processing units", "device", c.name, "command", "bat", "units", unitsSuccessfullyProcessed, "records", totalRecordsProcessedOverall)
+	} else if unitsAttempted > 0 {
+		slog.Error("No unit could be fetched and parsed", "device", c.name, "command", "bat", "units", unitsAttempted)
 	}
+
+	// With every unit in backoff nothing was collected
+	return unitsAttempted > 0 && unitsSuccessfullyProcessed == unitsAttempted
 }
 
 // processSTATData fetches, parses, and updates slow-changing metrics for stat command.
-func processSTATData(pwrUnitCount int8) bool {
-	if pwrUnitCount <= 0 {
-		log.Println("No power units specified for STAT data processing (pwrUnitCount <= 0).")
+func (c *collectionCycle) processSTATData(ctx context.Context, unitIDs []int) bool {
+	if len(unitIDs) == 0 {
+		slog.Warn("No units to fetch", "device", c.name, "command", "stat")
 		return false
 	}
 
 	unitsSuccessfullyProcessed := 0
 
-	for unitNum := int8(1); unitNum <= pwrUnitCount; unitNum++ {
-		suffix := strconv.Itoa(int(unitNum))
+	for _, unitID := range unitIDs {
+		if isUnitIgnored(unitID) || !c.health.shouldFetch(unitID, time.Now()) {
+			continue
+		}
+		suffix := strconv.Itoa(unitID)
 		commandToFetch := "stat " + suffix
 		unitMetricLabel := "bat" + suffix
 
-		logVerbose("Fetching STAT data for unit %s (command: %s)...", unitMetricLabel, commandToFetch)
-		statLines, err := fetcher.FetchConsoleOutput(commandToFetch)
+		slog.Debug("Fetching", "device", c.name, "command", commandToFetch, "unit", unitMetricLabel)
+		statLines, err := c.console.FetchConsoleOutput(ctx, commandToFetch)
 		if err != nil {
-			log.Printf("Error fetching STAT data for unit %s: %v", unitMetricLabel, err)
-			metrics.RecordError("stat_fetch_" + unitMetricLabel)
+			slog.Error("Fetch failed", "device", c.name, "command", "stat", "unit", unitMetricLabel, "error", err)
+			recordFetchError(c.name, "stat_fetch_"+unitMetricLabel, err)
 			continue
 		}
 
-		logVerbose("Parsing STAT data for unit %s...", unitMetricLabel)
+		slog.Debug("Parsing", "device", c.name, "command", commandToFetch, "unit", unitMetricLabel)
 		statData, err := parser.ParseSTAT(statLines)
 		if err != nil {
-			log.Printf("Error parsing STAT data for unit %s: %v", unitMetricLabel, err)
-			metrics.RecordError("stat_parse_" + unitMetricLabel)
+			slog.Error("Parse failed", "device", c.name, "command", "stat", "unit", unitMetricLabel, "error", err)
+			metrics.RecordError(c.name, "stat_parse_"+unitMetricLabel)
 			continue
 		}
 
-		metrics.UpdateBatteryStatMetrics(unitMetricLabel, statData)
+		metrics.UpdateBatteryStatMetrics(c.name, unitMetricLabel, statData)
+		metrics.SetUnitLastSuccess(c.name, "stat", unitMetricLabel, time.Now())
 		unitsSuccessfullyProcessed++
 	}
 
 	if unitsSuccessfullyProcessed > 0 {
-		logVerbose("Finished processing STAT data for %d unit(s).", unitsSuccessfullyProcessed)
+		slog.Debug("Finished processing units", "device", c.name, "command", "stat", "units", unitsSuccessfullyProcessed)
 	} else {
-		log.Println("Attempted to process STAT data, but no units were successfully fetched or parsed.")
+		slog.Error("No unit could be fetched and parsed", "device", c.name, "command", "stat")
+	}
+
+	return unitsSuccessfullyProcessed > 0
+}
+
+// processSOHData fetches the state of health and cycle count of every unit.
+// A firmware rejecting the command marks it unsupported instead of counting
+// an error every run.
+func (c *collectionCycle) processSOHData(ctx context.Context, unitIDs []int) bool {
+	unitsSuccessfullyProcessed := 0
+	for _, unitID := range unitIDs {
+		if isUnitIgnored(unitID) || !c.health.shouldFetch(unitID, time.Now()) {
+			continue
+		}
+		suffix := strconv.Itoa(unitID)
+		unitMetricLabel := "bat" + suffix
+
+		sohLines, err := c.console.FetchConsoleOutput(ctx, "soh "+suffix)
+		if errors.Is(err, fetcher.ErrInvalidCommand) {
+			c.auxCollectors.markUnsupported("soh")
+			return false
+		}
+		if err != nil {
+			slog.Error("Fetch failed", "device", c.name, "command", "soh", "unit", unitMetricLabel, "error", err)
+			recordFetchError(c.name, "soh_fetch_"+unitMetricLabel, err)
+			continue
+		}
+		soh, err := parser.ParseSOH(sohLines)
+		if errors.Is(err, parser.ErrUnsupportedCommand) {
+			c.auxCollectors.markUnsupported("soh")
+			return false
+		}
+		if err != nil {
+			slog.Error("Parse failed", "device", c.name, "command", "soh", "unit", unitMetricLabel, "error", err)
+			metrics.RecordError(c.name, "soh_parse_"+unitMetricLabel)
+			continue
+		}
+
+		metrics.UpdateBatterySOH(c.name, unitMetricLabel, soh)
+		metrics.SetUnitLastSuccess(c.name, "soh", unitMetricLabel, time.Now())
+		unitsSuccessfullyProcessed++
 	}
 
 	return unitsSuccessfullyProcessed > 0
 }
 
-// processPWRData fetches, parses, and updates metrics for PWR command
-func processPWRData() int8 {
-	pwrLines, err := fetcher.FetchConsoleOutput("pwr")
+// processEventLog reads the event log of the stack. It prints the full
+// history every time, so metrics.UpdateEvents only counts the entries it has
+// not seen before.
+func (c *collectionCycle) processEventLog(ctx context.Context, _ []int) bool {
+	lines, err := c.console.FetchConsoleOutput(ctx, "log")
+	if errors.Is(err, fetcher.ErrInvalidCommand) {
+		c.auxCollectors.markUnsupported("log")
+		return false
+	}
+	if err != nil {
+		slog.Error("Fetch failed", "device", c.name, "command", "log", "error", err)
+		recordFetchError(c.name, "log_fetch", err)
+		return false
+	}
+	entries, err := parser.ParseEvents(lines)
+	if errors.Is(err, parser.ErrUnsupportedCommand) {
+		c.auxCollectors.markUnsupported("log")
+		return false
+	}
+	if err != nil {
+		slog.Error("Parse failed", "device", c.name, "command", "log", "error", err)
+		metrics.RecordError(c.name, "log_parse")
+		return false
+	}
+	if err := metrics.UpdateEvents(c.name, entries); err != nil {
+		slog.Warn("Could not save the event state file", "device", c.name, "error", err)
+	}
+	return true
+}
+
+// processINFOData fetches the identity of every unit. It reports whether all
+// units succeeded; the info metrics rarely change, so it runs in the startup
+// tier by default.
+func (c *collectionCycle) processINFOData(ctx context.Context, unitIDs []int) bool {
+	unitsAttempted := 0
+	unitsSuccessfullyProcessed := 0
+	modelSet := false
+	for _, unitID := range unitIDs {
+		if isUnitIgnored(unitID) || !c.health.shouldFetch(unitID, time.Now()) {
+			continue
+		}
+		unitsAttempted++
+		suffix := strconv.Itoa(unitID)
+		unitMetricLabel := "bat" + suffix
+
+		infoLines, err := c.console.FetchConsoleOutput(ctx, "info "+suffix)
+		if err != nil {
+			slog.Error("Fetch failed", "device", c.name, "command", "info", "unit", unitMetricLabel, "error", err)
+			recordFetchError(c.name, "info_fetch_"+unitMetricLabel, err)
+			continue
+		}
+		info, err := parser.ParseInfo(infoLines)
+		if err != nil {
+			slog.Error("Parse failed", "device", c.name, "command", "info", "unit", unitMetricLabel, "error", err)
+			metrics.RecordError(c.name, "info_parse_"+unitMetricLabel)
+			continue
+		}
+
+		metrics.UpdateBatteryInfo(c.name, unitMetricLabel, info)
+		// The first unit that answers, normally the lowest, names the model
+		// of the stack, so the labels stay the same across restarts
+		if !modelSet && info.DeviceName != "" {
+			metrics.SetDeviceModel(c.name, info.DeviceName, parser.FirmwareMajor(info.FirmwareVersion))
+			modelSet = true
+		}
+		metrics.SetUnitLastSuccess(c.name, "info", unitMetricLabel, time.Now())
+		slog.Debug("Unit identified", "device", c.name, "unit", unitMetricLabel, "model", info.DeviceName, "serial", info.Barcode, "firmware", info.FirmwareVersion)
+		unitsSuccessfullyProcessed++
+	}
+
+	return unitsAttempted > 0 && unitsSuccessfullyProcessed == unitsAttempted
+}
+
+// recordFetchError counts a failed fetch as errorType, or as "auth" when the
+// device rejected the credentials, as "console_busy", "invalid_command" or
+// "unexpected_content" when the console answered with something other than
+// the command output and as "tls" when the TLS handshake failed.
+func recordFetchError(device, errorType string, err error) {
+	var authErr *fetcher.AuthError
+	switch {
+	case errors.As(err, &authErr):
+		errorType = "auth"
+	case errors.Is(err, fetcher.ErrConsoleBusy):
+		errorType = "console_busy"
+	case errors.Is(err, fetcher.ErrInvalidCommand):
+		errorType = "invalid_command"
+	case errors.Is(err, fetcher.ErrUnexpectedContent):
+		errorType = "unexpected_content"
+	case fetcher.IsTLSError(err):
+		errorType = "tls"
+	}
+	metrics.RecordError(device, errorType)
+}
+
+// processPowerData fetches the aggregated stack values of the power command
+// and integrates the stack energy. A firmware rejecting the command marks it
+// unsupported.
+func (c *collectionCycle) processPowerData(ctx context.Context, _ []int) bool {
+	powerLines, err := c.console.FetchConsoleOutput(ctx, "power")
+	if errors.Is(err, fetcher.ErrInvalidCommand) {
+		c.auxCollectors.markUnsupported("power")
+		return false
+	}
 	if err != nil {
-		log.Printf("Error fetching PWR data: %v", err)
-		metrics.RecordError("pwr_fetch")
-		return 0
+		slog.Error("Fetch failed", "device", c.name, "command", "power", "error", err)
+		recordFetchError(c.name, "power_fetch", err)
+		return false
 	}
 
-	pwrData, err := parser.ParsePWR(pwrLines)
+	stackPower, err := parser.ParsePower(powerLines)
+	if errors.Is(err, parser.ErrUnsupportedCommand) {
+		c.auxCollectors.markUnsupported("power")
+		return false
+	}
 	if err != nil {
-		log.Printf("Error parsing PWR data: %v", err)
-		metrics.RecordError("pwr_parse")
-		return 0
+		slog.Error("Parse failed", "device", c.name, "command", "power", "error", err)
+		metrics.RecordError(c.name, "power_parse")
+		return false
 	}
 
-	if len(pwrData) == 0 {
-		log.Println("No PWR data parsed.")
-		return 0
+	metrics.UpdateStackPower(c.name, time.Now(), stackPower)
+	c.powerSampled = true
+	slog.Debug("Processed records", "device", c.name, "command", "power")
+	return true
+}
+
+// processPWRSYSData fetches, parses, and updates stack-level metrics for
+// pwrsys command. It reports whether it succeeded.
+func (c *collectionCycle) processPWRSYSData(ctx context.Context) bool {
+	pwrsysLines, err := c.console.FetchConsoleOutput(ctx, "pwrsys")
+	if err != nil {
+		slog.Error("Fetch failed", "device", c.name, "command", "pwrsys", "error", err)
+		recordFetchError(c.name, "pwrsys_fetch", err)
+		return false
+	}
+
+	systemData, err := parser.ParsePWRSYS(pwrsysLines)
+	if err != nil {
+		slog.Error("Parse failed", "device", c.name, "command", "pwrsys", "error", err)
+		metrics.RecordError(c.name, "pwrsys_parse")
+		return false
 	}
 
+	metrics.UpdateSystemMetrics(c.name, systemData)
+	c.store.SetSystem(systemData)
+	slog.Debug("Processed records", "device", c.name, "command", "pwrsys")
+	return true
+}
+
+// processPWRData fetches, parses, and updates metrics for PWR command. It
+// returns the IDs of the present (non-Absent) units, nil when pwr failed.
+func (c *collectionCycle) processPWRData(ctx context.Context) []int {
+	pwrLines, err := c.console.FetchConsoleOutput(ctx, "pwr")
+	if err != nil {
+		slog.Error("Fetch failed", "device", c.name, "command", "pwr", "error", err)
+		recordFetchError(c.name, "pwr_fetch", err)
+		return nil
+	}
+
+	pwrData, err := deviceProfile.ParsePWR(pwrLines)
+	if err != nil {
+		slog.Error("Parse failed", "device", c.name, "command", "pwr", "error", err)
+		metrics.RecordError(c.name, "pwr_parse")
+		return nil
+	}
+
+	// Absent rows are already dropped by the parser; ignored units are left
+	// out of the power metrics and the presence check but still returned,
+	// bat collection skips them itself.
+	monitored := make([]parser.PowerStatus, 0, len(pwrData))
 	for _, status := range pwrData {
-		metrics.UpdatePowerMetrics(status)
+		if !isUnitIgnored(status.ID) {
+			monitored = append(monitored, status)
+		}
+	}
+
+	ignoredExpected := 0
+	for _, id := range ignoredUnitIDs() {
+		if id <= expectedModules {
+			ignoredExpected++
+		}
+	}
+	metrics.UpdateModuleCounts(c.name, len(monitored), expectedModules, ignoredExpected)
+	if expectedModules > 0 && len(monitored) < expectedModules-ignoredExpected {
+		slog.Warn("Expected modules are missing", "device", c.name, "command", "pwr", "present", len(monitored), "expected", expectedModules-ignoredExpected)
+	}
+
+	metrics.SyncPowerModules(c.name, monitored)
+
+	if len(pwrData) == 0 {
+		slog.Warn("No records parsed", "device", c.name, "command", "pwr")
+		return nil
+	}
+
+	for _, status := range monitored {
+		metrics.UpdatePowerMetrics(c.name, status)
+		metrics.UpdateHeaterMetrics(c.name, "bat"+strconv.Itoa(status.ID), status)
 	}
+	c.store.SetPower(monitored)
 
-	logVerbose("Successfully processed %d PWR records.\n", len(pwrData))
-	return int8(len(pwrData))
+	slog.Debug("Processed records", "device", c.name, "command", "pwr", "records", len(pwrData))
+	return parser.UnitIDs(pwrData)
 }
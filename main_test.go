@@ -0,0 +1,45 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"pylontech_exporter/src/metrics"
+)
+
+func TestRecordFetchErrorCountsTLSErrorsOnce(t *testing.T) {
+	registry, err := metrics.InitMetrics()
+	if err != nil {
+		t.Fatalf("InitMetrics returned error: %v", err)
+	}
+	recordFetchError("default", "pwr_fetch", fmt.Errorf("request failed: %w", tls.AlertError(42)))
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather returned error: %v", err)
+	}
+	counts := map[string]float64{}
+	for _, family := range families {
+		if family.GetName() != "devicemon_scraper_errors_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			counts[labelValue(metric, "type")] += metric.GetCounter().GetValue()
+		}
+	}
+	if counts["tls"] != 1 || len(counts) != 1 {
+		t.Fatalf("scraper_errors_total = %v, want a single tls error", counts)
+	}
+}
+
+func labelValue(metric *dto.Metric, name string) string {
+	for _, label := range metric.GetLabel() {
+		if label.GetName() == name {
+			return label.GetValue()
+		}
+	}
+	return ""
+}
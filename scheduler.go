@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"sync/atomic"
+	"time"
+
+	"pylontech_exporter/src/metrics"
+)
+
+// Scheduling tiers of auxiliary collectors. pwr and bat always run every
+// cycle; auxiliary commands default to the slow tier.
+const (
+	tierFast    = "fast"    // every REFRESH_SECONDS
+	tierSlow    = "slow"    // every AUX_REFRESH
+	tierStartup = "startup" // until the first success after startup
+)
+
+// auxCollector is an auxiliary console command whose data changes slowly.
+type auxCollector struct {
+	command     string
+	defaultTier string
+	// collect runs the command for the given units and reports whether it
+	// succeeded; failed runs are retried in the next cycle.
+	collect func(ctx context.Context, unitIDs []int) bool
+}
+
+type scheduledCollector struct {
+	auxCollector
+	tier        string
+	lastRun     time.Time
+	unsupported bool
+}
+
+// auxScheduler runs the auxiliary collectors of the cycle that are due. It
+// is called from the collection loop, so the commands are serialised with
+// pwr and bat and share the cycle's endpoint.
+type auxScheduler struct {
+	device     string
+	auxRefresh time.Duration
+	collectors []*scheduledCollector
+	// startupDue is set by rerunStartup from another goroutine and taken
+	// by the next runDue.
+	startupDue atomic.Bool
+}
+
+// newAuxScheduler runs the slow tier every auxRefresh (AUX_REFRESH) and
+// moves the commands named in tierOverrides (COMMAND_TIERS) to another tier.
+func newAuxScheduler(device string, auxRefresh time.Duration, tierOverrides map[string]string, collectors []auxCollector) *auxScheduler {
+	scheduler := &auxScheduler{device: device, auxRefresh: auxRefresh}
+	overrides := maps.Clone(tierOverrides)
+
+	for _, collector := range collectors {
+		tier := collector.defaultTier
+		if override, ok := overrides[collector.command]; ok {
+			tier = override
+			delete(overrides, collector.command)
+		}
+		scheduler.collectors = append(scheduler.collectors, &scheduledCollector{auxCollector: collector, tier: tier})
+		slog.Debug("Auxiliary command tier", "device", device, "command", collector.command, "tier", tier)
+	}
+	for command := range overrides {
+		slog.Warn("COMMAND_TIERS names an unknown command, ignoring it", "command", command)
+	}
+	return scheduler
+}
+
+// runDue runs every collector that is due in this cycle.
+func (s *auxScheduler) runDue(ctx context.Context, unitIDs []int, now time.Time) {
+	if s.startupDue.Swap(false) {
+		for _, collector := range s.collectors {
+			if collector.tier == tierStartup {
+				collector.lastRun = time.Time{}
+			}
+		}
+	}
+	for _, collector := range s.collectors {
+		if ctx.Err() != nil || collector.unsupported || !collector.due(now, s.auxRefresh) {
+			continue
+		}
+		started := time.Now()
+		ok := collector.collect(ctx, unitIDs)
+		metrics.RecordCommandRun(s.device, collector.command, started, ok)
+		if ok {
+			collector.lastRun = now
+		}
+	}
+}
+
+// rerunStartup has the startup tier run again in the next cycle, e.g. after
+// a reload. It may be called from any goroutine.
+func (s *auxScheduler) rerunStartup() {
+	s.startupDue.Store(true)
+}
+
+// markUnsupported stops running a command the firmware does not implement.
+func (s *auxScheduler) markUnsupported(command string) {
+	for _, collector := range s.collectors {
+		if collector.command == command && !collector.unsupported {
+			collector.unsupported = true
+			slog.Warn("Command not supported by the device, no longer fetching it", "device", s.device, "command", command)
+			metrics.SetCommandSupported(s.device, command, false)
+		}
+	}
+}
+
+func (c *scheduledCollector) due(now time.Time, auxRefresh time.Duration) bool {
+	switch c.tier {
+	case tierFast:
+		return true
+	case tierStartup:
+		return c.lastRun.IsZero()
+	}
+	return c.lastRun.IsZero() || now.Sub(c.lastRun) >= auxRefresh
+}
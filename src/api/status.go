@@ -0,0 +1,64 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"pylontech_exporter/src/parser"
+	"pylontech_exporter/src/snapshot"
+)
+
+// StatusHandler serves the latest snapshot as parsed from the console: the
+// pwr rows, the bat rows per unit and the pwrsys values, along with when they
+// were collected and whether the last cycle failed. ?unit=bat2 limits the
+// response to one unit. Responds 503 while nothing has been collected yet.
+func StatusHandler(store *snapshot.Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		latest, ok := store.Latest()
+		if !ok {
+			http.Error(w, "no data collected yet", http.StatusServiceUnavailable)
+			return
+		}
+
+		if unit := r.URL.Query().Get("unit"); unit != "" {
+			filtered, ok := filterUnit(latest, unit)
+			if !ok {
+				http.Error(w, "unknown unit", http.StatusNotFound)
+				return
+			}
+			latest = filtered
+		}
+
+		writeJSON(w, latest)
+	})
+}
+
+// filterUnit keeps the pwr row and bat rows of one unit, given as "bat2" or
+// "2". It reports false when the unit is not in the snapshot.
+func filterUnit(latest snapshot.Snapshot, unit string) (snapshot.Snapshot, bool) {
+	id, err := strconv.Atoi(strings.TrimPrefix(unit, "bat"))
+	if err != nil {
+		return latest, false
+	}
+	unitLabel := "bat" + strconv.Itoa(id)
+
+	filtered := latest
+	filtered.Power = nil
+	for _, status := range latest.Power {
+		if status.ID == id {
+			filtered.Power = append(filtered.Power, status)
+		}
+	}
+	filtered.Batteries = map[string][]parser.BatteryStatus{}
+	if batteries, ok := latest.Batteries[unitLabel]; ok {
+		filtered.Batteries[unitLabel] = batteries
+	}
+	return filtered, len(filtered.Power) > 0 || len(filtered.Batteries) > 0
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"pylontech_exporter/src/parser"
+	"pylontech_exporter/src/snapshot"
+)
+
+func TestStatusHandler(t *testing.T) {
+	store := snapshot.NewStore()
+	handler := StatusHandler(store)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/status", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status before the first collection = %d, want 503", rec.Code)
+	}
+
+	store.SetPower([]parser.PowerStatus{{ID: 1, Volt: 50000}, {ID: 2, Volt: 51000}})
+	store.SetBattery("bat1", []parser.BatteryStatus{{ID: 0, Volt: 3300}})
+	store.SetBattery("bat2", []parser.BatteryStatus{{ID: 0, Volt: 3310}})
+	store.SetStale(true)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/status?unit=bat2", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	var got snapshot.Snapshot
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if !got.Stale || got.CollectedAt.IsZero() {
+		t.Fatalf("stale = %v, collected_at = %v, want a stale snapshot with timestamp", got.Stale, got.CollectedAt)
+	}
+	if len(got.Power) != 1 || got.Power[0].ID != 2 {
+		t.Fatalf("power = %+v, want only unit 2", got.Power)
+	}
+	if _, ok := got.Batteries["bat1"]; ok || len(got.Batteries["bat2"]) != 1 {
+		t.Fatalf("batteries = %+v, want only bat2", got.Batteries)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/status?unit=bat9", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status for an unknown unit = %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"pylontech_exporter/src/parser"
+	"pylontech_exporter/src/snapshot"
+)
+
+// Summary is the response of GET /api/v1/summary. Field names and units are
+// part of the API and must stay stable.
+type Summary struct {
+	// SOCPercent is the average state of charge of all present modules in percent.
+	SOCPercent *float64 `json:"soc_percent"`
+	// AvailableDischargePowerW is the BMS discharge current limit multiplied by
+	// the average module voltage, in watts. Null when the limit is unknown.
+	AvailableDischargePowerW *float64 `json:"available_discharge_power_w"`
+	// NetPowerW is the summed module power in watts; positive while charging,
+	// negative while discharging.
+	NetPowerW float64 `json:"net_power_w"`
+	// AlarmActive is true when any module reports a non-Normal state.
+	AlarmActive bool `json:"alarm_active"`
+	// SnapshotAgeSeconds is the time since the data was collected.
+	SnapshotAgeSeconds float64 `json:"snapshot_age_seconds"`
+}
+
+// SummaryHandler serves the derived Summary of the latest snapshot, or 503
+// while nothing has been collected yet.
+func SummaryHandler(store *snapshot.Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		latest, ok := store.Latest()
+		if !ok {
+			http.Error(w, "no data collected yet", http.StatusServiceUnavailable)
+			return
+		}
+
+		writeJSON(w, BuildSummary(latest, time.Now()))
+	})
+}
+
+// BuildSummary derives the Summary of a snapshot as of now.
+func BuildSummary(latest snapshot.Snapshot, now time.Time) Summary {
+	summary := Summary{SnapshotAgeSeconds: now.Sub(latest.CollectedAt).Seconds()}
+
+	var socSum, voltSum float64
+	socCount := 0
+	for _, status := range latest.Power {
+		summary.NetPowerW += float64(status.Volt) * float64(status.Curr) / 1e6
+		voltSum += float64(status.Volt)
+		if status.Coulomb >= 0 {
+			socSum += float64(status.Coulomb)
+			socCount++
+		}
+		if hasAlarm(status) {
+			summary.AlarmActive = true
+		}
+	}
+
+	if socCount > 0 {
+		soc := socSum / float64(socCount)
+		summary.SOCPercent = &soc
+	}
+
+	if latest.System != nil && latest.System.DsgCurrLimit >= 0 && len(latest.Power) > 0 {
+		avgVolt := voltSum / float64(len(latest.Power))
+		available := float64(latest.System.DsgCurrLimit) * avgVolt / 1e6
+		summary.AvailableDischargePowerW = &available
+	}
+
+	return summary
+}
+
+func hasAlarm(status parser.PowerStatus) bool {
+	for _, state := range []string{status.VoltState, status.CurrState, status.TempState, status.BVState, status.BTState, status.MTState} {
+		if state != "" && state != "Normal" {
+			return true
+		}
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Could not encode JSON response", "error", err)
+	}
+}
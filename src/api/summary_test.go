@@ -0,0 +1,46 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"pylontech_exporter/src/parser"
+	"pylontech_exporter/src/snapshot"
+)
+
+func TestBuildSummary(t *testing.T) {
+	collectedAt := time.Date(2026, 6, 18, 22, 49, 12, 0, time.UTC)
+	latest := snapshot.Snapshot{
+		CollectedAt: collectedAt,
+		Power: []parser.PowerStatus{
+			{ID: 1, Volt: 50000, Curr: -2000, Coulomb: 80, VoltState: "Normal", TempState: "Normal"},
+			{ID: 2, Volt: 52000, Curr: -1000, Coulomb: 60, VoltState: "Normal", TempState: "Low"},
+		},
+		System: &parser.SystemStatus{DsgCurrLimit: 100000},
+	}
+
+	got := BuildSummary(latest, collectedAt.Add(5*time.Second))
+
+	if got.SOCPercent == nil || *got.SOCPercent != 70 {
+		t.Fatalf("SOCPercent = %v, want 70", got.SOCPercent)
+	}
+	if got.NetPowerW != -152 {
+		t.Fatalf("NetPowerW = %v, want -152", got.NetPowerW)
+	}
+	if got.AvailableDischargePowerW == nil || *got.AvailableDischargePowerW != 5100 {
+		t.Fatalf("AvailableDischargePowerW = %v, want 5100", got.AvailableDischargePowerW)
+	}
+	if !got.AlarmActive {
+		t.Fatal("AlarmActive = false, want true for a Low temperature state")
+	}
+	if got.SnapshotAgeSeconds != 5 {
+		t.Fatalf("SnapshotAgeSeconds = %v, want 5", got.SnapshotAgeSeconds)
+	}
+}
+
+func TestBuildSummaryWithoutLimits(t *testing.T) {
+	got := BuildSummary(snapshot.Snapshot{Power: []parser.PowerStatus{{Volt: 50000, Coulomb: -1}}}, time.Now())
+	if got.SOCPercent != nil || got.AvailableDischargePowerW != nil {
+		t.Fatalf("unknown values should be null: %#v", got)
+	}
+}
@@ -0,0 +1,641 @@
+// Package config loads the exporter settings from the environment and the
+// command line into one typed Config. Invalid values are reported together
+// at startup instead of being replaced by defaults.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"pylontech_exporter/src/parser"
+)
+
+// Config is the effective configuration of the exporter.
+type Config struct {
+	ListenAddress      string            // PORT, -listen-address
+	Refresh            time.Duration     // REFRESH_SECONDS, -refresh
+	Verbose            bool              // LOG_VERBOSE, -verbose: an alias of LOG_LEVEL=debug
+	LogLevel           string            // LOG_LEVEL, -log-level: debug, info, warn or error
+	LogFormat          string            // LOG_FORMAT: text or json
+	CollectionMode     string            // COLLECTION_MODE: collector or ticker
+	ScrapeTimeout      time.Duration     // SCRAPE_TIMEOUT
+	DeviceConcurrency  int               // DEVICE_CONCURRENCY
+	FetchConcurrency   int               // FETCH_CONCURRENCY
+	DeviceProfile      string            // DEVICE_PROFILE
+	ExpectedModules    int               // EXPECTED_MODULES, 0 when unset
+	ExpectedSerial     string            // EXPECTED_DEVICE_SERIAL
+	EnforceSerial      bool              // EXPECTED_DEVICE_SERIAL_ENFORCE
+	MetricsRequireData bool              // METRICS_REQUIRE_DATA
+	AuxRefresh         time.Duration     // AUX_REFRESH
+	CommandTiers       map[string]string // COMMAND_TIERS, command -> tier
+	UnitShrinkCycles   int               // UNIT_SHRINK_CYCLES
+	UnitDisableAfter   int               // UNIT_DISABLE_AFTER, 0 turns the backoff off
+	UnitCooldown       time.Duration     // UNIT_COOLDOWN, the longest backoff of a failing unit
+	ReadyIntervals     int               // READY_INTERVALS, ticker mode only
+	SampleMaxGap       time.Duration     // SAMPLE_MAX_GAP, the longest sample interval that is integrated
+	TempScale          string            // TEMP_SCALE, a parser.TempScales name; empty uses the profile's
+	EventStateFile     string            // EVENT_STATE_FILE, keeps the event log position across restarts
+
+	Metrics Metrics
+	Fetch   Fetch
+	GRPC    GRPC
+	MQTT    MQTT
+	Influx  Influx
+
+	ShowVersion bool     // -version
+	Args        []string // Arguments left after the flags, e.g. "watch garage"
+}
+
+// Metrics holds the settings of the metrics package.
+type Metrics struct {
+	Namespace string   // PROM_NAMESPACE
+	Disabled  []string // DISABLE_METRICS
+	// CellVoltBuckets are the upper bounds in V of the cell voltage
+	// histogram, from CELL_VOLT_BUCKETS=start:end:width.
+	CellVoltBuckets []float64
+	Units           string // METRIC_UNITS: raw (millivolts, milliamps) or si
+	Runtime         bool   // ENABLE_RUNTIME_METRICS: Go runtime and process metrics of the exporter
+}
+
+// Fetch holds the settings of the fetcher package.
+type Fetch struct {
+	Devices       string   // DEVICES: name=host[:port],...
+	DeviceName    string   // DEVICE_NAME
+	DeviceIP      string   // DEVICE_IP, may list several addresses
+	DevicePort    string   // DEVICE_PORT
+	Endpoints     []string // DEVICE_ENDPOINTS
+	FallbackIP    string   // DEVICE_FALLBACK_IP
+	FallbackPort  string   // DEVICE_FALLBACK_PORT
+	FailoverAfter int      // DEVICE_FAILOVER_AFTER
+
+	Mode       string // DEVICE_MODE: http, serial or file
+	SerialPort string // SERIAL_PORT
+	SerialBaud int    // SERIAL_BAUD
+	FixtureDir string // FIXTURE_DIR, replayed with DEVICE_MODE=file
+	DumpDir    string // DUMP_RAW_DIR or -dump-raw, the console output is dumped here as fixtures
+
+	Scheme                string // DEVICE_SCHEME: http or https
+	TLSCertFile           string // DEVICE_TLS_CERT_FILE
+	TLSKeyFile            string // DEVICE_TLS_KEY_FILE
+	TLSKeyPassphrase      string // DEVICE_TLS_KEY_PASSPHRASE
+	CAFile                string // DEVICE_CA_FILE
+	TLSInsecureSkipVerify bool   // DEVICE_TLS_INSECURE_SKIP_VERIFY
+
+	Username   string // DEVICE_USERNAME, basic auth
+	Password   string // DEVICE_PASSWORD
+	Token      string // DEVICE_TOKEN, sent as bearer token
+	TokenParam string // DEVICE_TOKEN_PARAM, sends the token as this query parameter instead
+
+	Timeout         time.Duration            // FETCH_TIMEOUT or FETCH_TIMEOUT_SECONDS
+	CommandTimeouts map[string]time.Duration // FETCH_TIMEOUT_<COMMAND>, keyed by command name
+	Retries         int                      // FETCH_RETRIES
+	Backoff         time.Duration            // FETCH_BACKOFF_MS
+}
+
+// GRPC holds the settings of the optional gRPC API.
+type GRPC struct {
+	Listen   string // GRPC_LISTEN, disabled when empty
+	CertFile string // GRPC_TLS_CERT_FILE
+	KeyFile  string // GRPC_TLS_KEY_FILE
+	Token    string // GRPC_TOKEN
+}
+
+// MQTT holds the settings of the optional MQTT publisher.
+type MQTT struct {
+	Broker          string // MQTT_BROKER, disabled when empty
+	Username        string // MQTT_USERNAME
+	Password        string // MQTT_PASSWORD
+	ClientID        string // MQTT_CLIENT_ID
+	TopicPrefix     string // MQTT_TOPIC_PREFIX
+	DiscoveryPrefix string // MQTT_DISCOVERY_PREFIX
+}
+
+// Influx holds the settings of the optional InfluxDB push output.
+type Influx struct {
+	URL    string // INFLUX_URL, disabled when empty
+	Token  string // INFLUX_TOKEN
+	Org    string // INFLUX_ORG
+	Bucket string // INFLUX_BUCKET
+}
+
+// Default returns the configuration used when nothing is set.
+func Default() Config {
+	return Config{
+		ListenAddress:     ":9100",
+		Refresh:           30 * time.Second,
+		CollectionMode:    "collector",
+		ScrapeTimeout:     30 * time.Second,
+		DeviceConcurrency: 4,
+		FetchConcurrency:  3,
+		AuxRefresh:        15 * time.Minute,
+		CommandTiers:      map[string]string{},
+		UnitShrinkCycles:  3,
+		UnitDisableAfter:  5,
+		UnitCooldown:      10 * time.Minute,
+		ReadyIntervals:    3,
+		LogFormat:         "text",
+		Metrics: Metrics{
+			Namespace:       "devicemon",
+			CellVoltBuckets: linearBuckets(2.5, 3.8, 0.025),
+			Units:           "raw",
+		},
+		Fetch: Fetch{
+			DeviceName:      "default",
+			DevicePort:      "80",
+			FailoverAfter:   3,
+			Mode:            "http",
+			SerialPort:      "/dev/ttyUSB0",
+			SerialBaud:      115200,
+			FixtureDir:      "fixtures",
+			Scheme:          "http",
+			Timeout:         15 * time.Second,
+			CommandTimeouts: map[string]time.Duration{},
+			Retries:         2,
+			Backoff:         500 * time.Millisecond,
+		},
+	}
+}
+
+// Commands are the console commands the exporter sends, the ones
+// FETCH_TIMEOUT_<COMMAND> can override the timeout of.
+var Commands = []string{"pwr", "bat", "pwrsys", "power", "info", "stat", "soh", "log"}
+
+var namespacePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Load reads the configuration from environ (as returned by os.Environ) and
+// overrides it with the flags in args (os.Args[1:]). All invalid values are
+// returned as one error.
+func Load(args, environ []string) (Config, error) {
+	env := map[string]string{}
+	for _, entry := range environ {
+		if name, value, ok := strings.Cut(entry, "="); ok {
+			env[name] = value
+		}
+	}
+
+	r := &envReader{env: env}
+	cfg := Default()
+	cfg.fromEnv(r)
+
+	fs := flag.NewFlagSet("pylontech-prom-export", flag.ContinueOnError)
+	fs.StringVar(&cfg.ListenAddress, "listen-address", cfg.ListenAddress, "address of the HTTP server (PORT)")
+	fs.Func("device", "device address, or name=host[:port],... for several stacks (DEVICE_IP, DEVICES)", func(value string) error {
+		if strings.Contains(value, "=") {
+			cfg.Fetch.Devices, cfg.Fetch.DeviceIP = value, ""
+		} else {
+			cfg.Fetch.Devices, cfg.Fetch.DeviceIP = "", value
+		}
+		return nil
+	})
+	fs.DurationVar(&cfg.Refresh, "refresh", cfg.Refresh, "collection interval in ticker mode (REFRESH_SECONDS)")
+	fs.StringVar(&cfg.Metrics.Namespace, "namespace", cfg.Metrics.Namespace, "metric namespace (PROM_NAMESPACE)")
+	fs.BoolVar(&cfg.Verbose, "verbose", cfg.Verbose, "debug logging, like -log-level=debug (LOG_VERBOSE)")
+	fs.StringVar(&cfg.LogLevel, "log-level", cfg.LogLevel, "debug, info, warn or error (LOG_LEVEL)")
+	fs.StringVar(&cfg.CollectionMode, "collection-mode", cfg.CollectionMode, "collector or ticker (COLLECTION_MODE)")
+	fs.DurationVar(&cfg.ScrapeTimeout, "scrape-timeout", cfg.ScrapeTimeout, "collection budget of a scrape (SCRAPE_TIMEOUT)")
+	fs.DurationVar(&cfg.Fetch.Timeout, "fetch-timeout", cfg.Fetch.Timeout, "timeout of a console request attempt (FETCH_TIMEOUT)")
+	fs.StringVar(&cfg.Fetch.DumpDir, "dump-raw", cfg.Fetch.DumpDir, "dump the console output of every command to this directory as replayable fixtures (DUMP_RAW_DIR)")
+	fs.StringVar(&cfg.DeviceProfile, "profile", cfg.DeviceProfile, "console output format (DEVICE_PROFILE)")
+	fs.BoolVar(&cfg.ShowVersion, "version", false, "print the version and exit")
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+	cfg.Args = fs.Args()
+	if cfg.SampleMaxGap == 0 {
+		// Three missed ticks; in collector mode scrapes set the pace, and
+		// Prometheus treats series older than 5m as stale anyway
+		cfg.SampleMaxGap = 3 * cfg.Refresh
+		if cfg.CollectionMode == "collector" {
+			cfg.SampleMaxGap = 5 * time.Minute
+		}
+	}
+	cfg.LogLevel = strings.ToLower(cfg.LogLevel)
+	if cfg.LogLevel == "" {
+		cfg.LogLevel = "info"
+		if cfg.Verbose {
+			cfg.LogLevel = "debug"
+		}
+	}
+
+	return cfg, errors.Join(append(r.errs, cfg.validate()...)...)
+}
+
+func (cfg *Config) fromEnv(r *envReader) {
+	if port := r.str("PORT"); port != "" {
+		cfg.ListenAddress = ":" + port
+	}
+	cfg.Refresh = time.Duration(r.integer("REFRESH_SECONDS", int(cfg.Refresh/time.Second), 1)) * time.Second
+	cfg.Verbose = r.boolean("LOG_VERBOSE")
+	cfg.LogLevel = r.str("LOG_LEVEL")
+	if format := r.str("LOG_FORMAT"); format != "" {
+		cfg.LogFormat = strings.ToLower(format)
+	}
+	if mode := r.str("COLLECTION_MODE"); mode != "" {
+		cfg.CollectionMode = strings.ToLower(mode)
+	}
+	cfg.ScrapeTimeout = r.duration("SCRAPE_TIMEOUT", cfg.ScrapeTimeout)
+	cfg.DeviceConcurrency = r.integer("DEVICE_CONCURRENCY", cfg.DeviceConcurrency, 1)
+	cfg.FetchConcurrency = r.integer("FETCH_CONCURRENCY", cfg.FetchConcurrency, 1)
+	cfg.DeviceProfile = r.str("DEVICE_PROFILE")
+	cfg.ExpectedModules = r.integer("EXPECTED_MODULES", 0, 1)
+	cfg.ExpectedSerial = r.str("EXPECTED_DEVICE_SERIAL")
+	cfg.EnforceSerial = r.boolean("EXPECTED_DEVICE_SERIAL_ENFORCE")
+	cfg.MetricsRequireData = r.boolean("METRICS_REQUIRE_DATA")
+	cfg.AuxRefresh = r.duration("AUX_REFRESH", cfg.AuxRefresh)
+	cfg.CommandTiers = r.commandTiers("COMMAND_TIERS")
+	cfg.UnitShrinkCycles = r.integer("UNIT_SHRINK_CYCLES", cfg.UnitShrinkCycles, 1)
+	cfg.UnitDisableAfter = r.integer("UNIT_DISABLE_AFTER", cfg.UnitDisableAfter, 0)
+	cfg.UnitCooldown = r.duration("UNIT_COOLDOWN", cfg.UnitCooldown)
+	cfg.ReadyIntervals = r.integer("READY_INTERVALS", cfg.ReadyIntervals, 1)
+	cfg.SampleMaxGap = r.duration("SAMPLE_MAX_GAP", 0)
+
+	if namespace := r.str("PROM_NAMESPACE"); namespace != "" {
+		cfg.Metrics.Namespace = namespace
+	}
+	cfg.Metrics.Disabled = r.list("DISABLE_METRICS")
+	cfg.Metrics.CellVoltBuckets = r.buckets("CELL_VOLT_BUCKETS", cfg.Metrics.CellVoltBuckets)
+	if units := r.str("METRIC_UNITS"); units != "" {
+		cfg.Metrics.Units = strings.ToLower(units)
+	}
+	cfg.Metrics.Runtime = r.boolean("ENABLE_RUNTIME_METRICS")
+	cfg.TempScale = strings.ToLower(r.str("TEMP_SCALE"))
+	cfg.EventStateFile = r.str("EVENT_STATE_FILE")
+
+	f := &cfg.Fetch
+	f.Devices = r.str("DEVICES")
+	if name := r.str("DEVICE_NAME"); name != "" {
+		f.DeviceName = name
+	}
+	f.DeviceIP = r.str("DEVICE_IP")
+	if port := r.str("DEVICE_PORT"); port != "" {
+		f.DevicePort = port
+	}
+	f.Endpoints = r.list("DEVICE_ENDPOINTS")
+	f.FallbackIP = r.str("DEVICE_FALLBACK_IP")
+	f.FallbackPort = r.str("DEVICE_FALLBACK_PORT")
+	f.FailoverAfter = r.integer("DEVICE_FAILOVER_AFTER", f.FailoverAfter, 1)
+	if mode := r.str("DEVICE_MODE"); mode != "" {
+		f.Mode = strings.ToLower(mode)
+	}
+	if port := r.str("SERIAL_PORT"); port != "" {
+		f.SerialPort = port
+	}
+	f.SerialBaud = r.integer("SERIAL_BAUD", f.SerialBaud, 1)
+	if dir := r.str("FIXTURE_DIR"); dir != "" {
+		f.FixtureDir = dir
+	}
+	f.DumpDir = r.str("DUMP_RAW_DIR")
+	if scheme := r.str("DEVICE_SCHEME"); scheme != "" {
+		f.Scheme = strings.ToLower(scheme)
+	}
+	f.TLSCertFile = r.str("DEVICE_TLS_CERT_FILE")
+	f.TLSKeyFile = r.str("DEVICE_TLS_KEY_FILE")
+	f.TLSKeyPassphrase = r.env["DEVICE_TLS_KEY_PASSPHRASE"]
+	f.CAFile = r.str("DEVICE_CA_FILE")
+	f.TLSInsecureSkipVerify = r.boolean("DEVICE_TLS_INSECURE_SKIP_VERIFY")
+	if f.TLSCertFile != "" || f.CAFile != "" || f.TLSInsecureSkipVerify {
+		f.Scheme = "https"
+	}
+	f.Username = r.str("DEVICE_USERNAME")
+	f.Password = r.env["DEVICE_PASSWORD"]
+	f.Token = r.env["DEVICE_TOKEN"]
+	f.TokenParam = r.str("DEVICE_TOKEN_PARAM")
+	if timeout, ok := r.timeout("FETCH_TIMEOUT"); ok {
+		f.Timeout = timeout
+	} else if timeout, ok := r.timeout("FETCH_TIMEOUT_SECONDS"); ok {
+		f.Timeout = timeout
+	}
+	var names []string
+	for name := range r.env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		command, ok := strings.CutPrefix(name, "FETCH_TIMEOUT_")
+		if !ok || command == "SECONDS" {
+			continue
+		}
+		command = strings.ToLower(command)
+		if !slices.Contains(Commands, command) {
+			r.errs = append(r.errs, fmt.Errorf("unknown command in %s, expected one of %s", name, strings.ToUpper(strings.Join(Commands, ", "))))
+			continue
+		}
+		if timeout, ok := r.timeout(name); ok {
+			f.CommandTimeouts[command] = timeout
+		}
+	}
+	f.Retries = r.integer("FETCH_RETRIES", f.Retries, 0)
+	f.Backoff = time.Duration(r.integer("FETCH_BACKOFF_MS", int(f.Backoff/time.Millisecond), 0)) * time.Millisecond
+
+	cfg.GRPC = GRPC{
+		Listen:   r.str("GRPC_LISTEN"),
+		CertFile: r.str("GRPC_TLS_CERT_FILE"),
+		KeyFile:  r.str("GRPC_TLS_KEY_FILE"),
+		Token:    r.env["GRPC_TOKEN"],
+	}
+	cfg.MQTT = MQTT{
+		Broker:          r.str("MQTT_BROKER"),
+		Username:        r.str("MQTT_USERNAME"),
+		Password:        r.env["MQTT_PASSWORD"],
+		ClientID:        r.str("MQTT_CLIENT_ID"),
+		TopicPrefix:     r.str("MQTT_TOPIC_PREFIX"),
+		DiscoveryPrefix: r.str("MQTT_DISCOVERY_PREFIX"),
+	}
+	cfg.Influx = Influx{
+		URL:    r.str("INFLUX_URL"),
+		Token:  r.env["INFLUX_TOKEN"],
+		Org:    r.str("INFLUX_ORG"),
+		Bucket: r.str("INFLUX_BUCKET"),
+	}
+}
+
+// validate checks values that flags can set as well as combinations of
+// settings.
+func (cfg *Config) validate() []error {
+	var errs []error
+	if cfg.ListenAddress == "" {
+		errs = append(errs, fmt.Errorf("the listen address must not be empty"))
+	}
+	if cfg.Refresh < time.Second {
+		errs = append(errs, fmt.Errorf("invalid refresh interval %s, expected at least 1s", cfg.Refresh))
+	}
+	if cfg.CollectionMode != "collector" && cfg.CollectionMode != "ticker" {
+		errs = append(errs, fmt.Errorf("invalid COLLECTION_MODE '%s', expected collector or ticker", cfg.CollectionMode))
+	}
+	switch cfg.LogLevel {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("invalid LOG_LEVEL '%s', expected debug, info, warn or error", cfg.LogLevel))
+	}
+	if cfg.LogFormat != "text" && cfg.LogFormat != "json" {
+		errs = append(errs, fmt.Errorf("invalid LOG_FORMAT '%s', expected text or json", cfg.LogFormat))
+	}
+	if cfg.ScrapeTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("invalid scrape timeout %s", cfg.ScrapeTimeout))
+	}
+	if _, err := parser.LookupProfile(cfg.DeviceProfile); err != nil {
+		errs = append(errs, fmt.Errorf("invalid DEVICE_PROFILE: %w", err))
+	}
+	if _, ok := parser.TempScales[cfg.TempScale]; cfg.TempScale != "" && !ok {
+		errs = append(errs, fmt.Errorf("invalid TEMP_SCALE '%s', expected milli, centi, deci or degree", cfg.TempScale))
+	}
+	if cfg.Metrics.Units != "raw" && cfg.Metrics.Units != "si" {
+		errs = append(errs, fmt.Errorf("invalid METRIC_UNITS '%s', expected raw or si", cfg.Metrics.Units))
+	}
+	if !namespacePattern.MatchString(cfg.Metrics.Namespace) {
+		errs = append(errs, fmt.Errorf("invalid PROM_NAMESPACE '%s', expected letters, digits and underscores", cfg.Metrics.Namespace))
+	}
+	if cfg.Fetch.Mode != "http" && cfg.Fetch.Mode != "serial" && cfg.Fetch.Mode != "file" {
+		errs = append(errs, fmt.Errorf("invalid DEVICE_MODE '%s', expected http, serial or file", cfg.Fetch.Mode))
+	}
+	if cfg.Fetch.Scheme != "http" && cfg.Fetch.Scheme != "https" {
+		errs = append(errs, fmt.Errorf("invalid DEVICE_SCHEME '%s', expected http or https", cfg.Fetch.Scheme))
+	}
+	if (cfg.Fetch.TLSCertFile == "") != (cfg.Fetch.TLSKeyFile == "") {
+		errs = append(errs, fmt.Errorf("DEVICE_TLS_CERT_FILE and DEVICE_TLS_KEY_FILE must be set together"))
+	}
+	if cfg.Fetch.Password != "" && cfg.Fetch.Username == "" {
+		errs = append(errs, fmt.Errorf("DEVICE_PASSWORD is set without DEVICE_USERNAME"))
+	}
+	if cfg.Fetch.Username != "" && cfg.Fetch.Token != "" {
+		errs = append(errs, fmt.Errorf("DEVICE_USERNAME and DEVICE_TOKEN cannot be used together"))
+	}
+	if cfg.Fetch.TokenParam != "" && cfg.Fetch.Token == "" {
+		errs = append(errs, fmt.Errorf("DEVICE_TOKEN_PARAM is set without DEVICE_TOKEN"))
+	}
+	if cfg.Fetch.Timeout <= 0 {
+		errs = append(errs, fmt.Errorf("invalid fetch timeout %s", cfg.Fetch.Timeout))
+	}
+	return errs
+}
+
+// String renders the effective configuration for the startup log, with
+// secrets redacted.
+func (cfg Config) String() string {
+	f := cfg.Fetch
+	values := []string{
+		"listen-address=" + cfg.ListenAddress,
+		"refresh=" + cfg.Refresh.String(),
+		"collection-mode=" + cfg.CollectionMode,
+		"scrape-timeout=" + cfg.ScrapeTimeout.String(),
+		"sample-max-gap=" + cfg.SampleMaxGap.String(),
+		"device-concurrency=" + strconv.Itoa(cfg.DeviceConcurrency),
+		"fetch-concurrency=" + strconv.Itoa(cfg.FetchConcurrency),
+		"profile=" + cfg.DeviceProfile,
+		"namespace=" + cfg.Metrics.Namespace,
+		"disable-metrics=" + strings.Join(cfg.Metrics.Disabled, ","),
+		"cell-volt-buckets=" + formatBuckets(cfg.Metrics.CellVoltBuckets),
+		"metric-units=" + cfg.Metrics.Units,
+		"runtime-metrics=" + strconv.FormatBool(cfg.Metrics.Runtime),
+		"temp-scale=" + cfg.TempScale,
+		"event-state-file=" + cfg.EventStateFile,
+		"log-level=" + cfg.LogLevel,
+		"log-format=" + cfg.LogFormat,
+		"devices=" + f.Devices,
+		"device-name=" + f.DeviceName,
+		"device-ip=" + f.DeviceIP,
+		"device-port=" + f.DevicePort,
+		"device-endpoints=" + strings.Join(f.Endpoints, ","),
+		"device-fallback=" + f.FallbackIP,
+		"device-mode=" + f.Mode,
+		"fixture-dir=" + f.FixtureDir,
+		"dump-raw=" + f.DumpDir,
+		"device-scheme=" + f.Scheme,
+		"device-tls-cert=" + f.TLSCertFile,
+		"device-tls-key-passphrase=" + redact(f.TLSKeyPassphrase),
+		"device-ca=" + f.CAFile,
+		"device-tls-insecure-skip-verify=" + strconv.FormatBool(f.TLSInsecureSkipVerify),
+		"device-username=" + f.Username,
+		"device-password=" + redact(f.Password),
+		"device-token=" + redact(f.Token),
+		"device-token-param=" + f.TokenParam,
+		"fetch-timeout=" + f.Timeout.String(),
+		"fetch-command-timeouts=" + formatTimeouts(f.CommandTimeouts),
+		"fetch-retries=" + strconv.Itoa(f.Retries),
+		"fetch-backoff=" + f.Backoff.String(),
+		"grpc-listen=" + cfg.GRPC.Listen,
+		"grpc-token=" + redact(cfg.GRPC.Token),
+		"mqtt-broker=" + cfg.MQTT.Broker,
+		"mqtt-username=" + cfg.MQTT.Username,
+		"mqtt-password=" + redact(cfg.MQTT.Password),
+		"influx-url=" + cfg.Influx.URL,
+		"influx-token=" + redact(cfg.Influx.Token),
+		"influx-org=" + cfg.Influx.Org,
+		"influx-bucket=" + cfg.Influx.Bucket,
+	}
+	if f.Mode == "serial" {
+		values = append(values, "serial-port="+f.SerialPort, "serial-baud="+strconv.Itoa(f.SerialBaud))
+	}
+	return strings.Join(values, " ")
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "<redacted>"
+}
+
+func formatTimeouts(timeouts map[string]time.Duration) string {
+	var values []string
+	for command, timeout := range timeouts {
+		values = append(values, command+":"+timeout.String())
+	}
+	sort.Strings(values)
+	return strings.Join(values, ",")
+}
+
+// envReader parses environment values and collects the errors of invalid
+// ones.
+type envReader struct {
+	env  map[string]string
+	errs []error
+}
+
+func (r *envReader) str(name string) string {
+	return strings.TrimSpace(r.env[name])
+}
+
+func (r *envReader) invalid(name, raw, expected string) {
+	r.errs = append(r.errs, fmt.Errorf("invalid %s value '%s', expected %s", name, raw, expected))
+}
+
+func (r *envReader) boolean(name string) bool {
+	raw := r.str(name)
+	if raw == "" {
+		return false
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		r.invalid(name, raw, "true or false")
+	}
+	return value
+}
+
+func (r *envReader) integer(name string, def, min int) int {
+	raw := r.str(name)
+	if raw == "" {
+		return def
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < min {
+		r.invalid(name, raw, fmt.Sprintf("an integer of at least %d", min))
+		return def
+	}
+	return value
+}
+
+func (r *envReader) duration(name string, def time.Duration) time.Duration {
+	raw := r.str(name)
+	if raw == "" {
+		return def
+	}
+	value, err := time.ParseDuration(raw)
+	if err != nil || value <= 0 {
+		r.invalid(name, raw, "a positive duration such as 30s")
+		return def
+	}
+	return value
+}
+
+// timeout reads a duration like "3s" or a plain number of seconds.
+func (r *envReader) timeout(name string) (time.Duration, bool) {
+	raw := r.str(name)
+	if raw == "" {
+		return 0, false
+	}
+	value, err := time.ParseDuration(raw)
+	if err != nil {
+		seconds, convErr := strconv.ParseFloat(raw, 64)
+		if convErr != nil {
+			r.invalid(name, raw, "a duration such as 3s or a number of seconds")
+			return 0, false
+		}
+		value = time.Duration(seconds * float64(time.Second))
+	}
+	if value <= 0 {
+		r.invalid(name, raw, "a positive timeout")
+		return 0, false
+	}
+	return value, true
+}
+
+func (r *envReader) list(name string) []string {
+	var values []string
+	for _, value := range strings.Split(r.env[name], ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// buckets reads linear histogram buckets as "start:end:width", e.g.
+// "2.5:3.8:0.025" for 25 mV buckets from 2.5 V to 3.8 V.
+func (r *envReader) buckets(name string, def []float64) []float64 {
+	raw := r.str(name)
+	if raw == "" {
+		return def
+	}
+	parts := strings.Split(raw, ":")
+	values := make([]float64, 0, 3)
+	for _, part := range parts {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			break
+		}
+		values = append(values, value)
+	}
+	if len(parts) != 3 || len(values) != 3 || values[2] <= 0 || values[1] <= values[0] || (values[1]-values[0])/values[2] > 1000 {
+		r.invalid(name, raw, "start:end:width with start < end and at most 1000 buckets")
+		return def
+	}
+	return linearBuckets(values[0], values[1], values[2])
+}
+
+// linearBuckets returns the upper bounds from start to end in steps of width,
+// rounded to six decimals so the le labels stay readable.
+func linearBuckets(start, end, width float64) []float64 {
+	count := int(math.Round((end-start)/width)) + 1
+	bounds := make([]float64, 0, count)
+	for i := 0; i < count; i++ {
+		bounds = append(bounds, math.Round((start+float64(i)*width)*1e6)/1e6)
+	}
+	return bounds
+}
+
+// formatBuckets is the inverse of buckets for the startup log.
+func formatBuckets(bounds []float64) string {
+	switch len(bounds) {
+	case 0:
+		return ""
+	case 1:
+		return strconv.FormatFloat(bounds[0], 'g', -1, 64)
+	}
+	width := math.Round((bounds[1]-bounds[0])*1e6) / 1e6
+	return fmt.Sprintf("%g:%g:%g", bounds[0], bounds[len(bounds)-1], width)
+}
+
+// commandTiers reads a list of command:tier pairs such as
+// "stat:fast,info:startup".
+func (r *envReader) commandTiers(name string) map[string]string {
+	tiers := map[string]string{}
+	for _, pair := range r.list(name) {
+		command, tier, ok := strings.Cut(pair, ":")
+		tier = strings.ToLower(strings.TrimSpace(tier))
+		if !ok || (tier != "fast" && tier != "slow" && tier != "startup") {
+			r.invalid(name, pair, "command:fast|slow|startup")
+			continue
+		}
+		tiers[strings.ToLower(strings.TrimSpace(command))] = tier
+	}
+	return tiers
+}
@@ -0,0 +1,216 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load(nil, nil)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.ListenAddress != ":9100" || cfg.Refresh != 30*time.Second || cfg.Metrics.Namespace != "devicemon" {
+		t.Fatalf("defaults = %s", cfg)
+	}
+	if cfg.Fetch.Timeout != 15*time.Second || cfg.Fetch.Retries != 2 || cfg.Fetch.DeviceName != "default" || cfg.FetchConcurrency != 3 {
+		t.Fatalf("fetch defaults = %+v", cfg.Fetch)
+	}
+}
+
+func TestLoadFlagsOverrideEnvironment(t *testing.T) {
+	environ := []string{
+		"PORT=9092",
+		"REFRESH_SECONDS=10",
+		"DEVICE_IP=192.168.1.10",
+		"PROM_NAMESPACE=pylon",
+		"FETCH_TIMEOUT=5s",
+		"FETCH_TIMEOUT_BAT=25",
+		"DISABLE_METRICS=battery_curr, battery_coulomb",
+	}
+	cfg, err := Load([]string{"-listen-address", "127.0.0.1:9200", "-refresh", "1m", "-device", "garage=10.0.0.1", "watch", "garage"}, environ)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+
+	if cfg.ListenAddress != "127.0.0.1:9200" || cfg.Refresh != time.Minute {
+		t.Errorf("listen address %q, refresh %s, want the flag values", cfg.ListenAddress, cfg.Refresh)
+	}
+	if cfg.Fetch.Devices != "garage=10.0.0.1" || cfg.Fetch.DeviceIP != "" {
+		t.Errorf("devices %q, device IP %q, want -device to replace DEVICE_IP", cfg.Fetch.Devices, cfg.Fetch.DeviceIP)
+	}
+	if cfg.Metrics.Namespace != "pylon" || len(cfg.Metrics.Disabled) != 2 {
+		t.Errorf("metrics = %+v", cfg.Metrics)
+	}
+	if cfg.Fetch.Timeout != 5*time.Second || cfg.Fetch.CommandTimeouts["bat"] != 25*time.Second {
+		t.Errorf("timeouts = %s / %v", cfg.Fetch.Timeout, cfg.Fetch.CommandTimeouts)
+	}
+	if strings.Join(cfg.Args, " ") != "watch garage" {
+		t.Errorf("args = %v, want [watch garage]", cfg.Args)
+	}
+}
+
+func TestLoadRejectsInvalidValues(t *testing.T) {
+	_, err := Load(nil, []string{
+		"REFRESH_SECONDS=abc",
+		"COLLECTION_MODE=push",
+		"PROM_NAMESPACE=pylon-tech",
+		"FETCH_RETRIES=-1",
+		"LOG_VERBOSE=yes please",
+		"FETCH_CONCURRENCY=0",
+		"READY_INTERVALS=0",
+		"LOG_LEVEL=trace",
+		"LOG_FORMAT=logfmt",
+		"METRIC_UNITS=imperial",
+		"TEMP_SCALE=kelvin",
+	})
+	if err == nil {
+		t.Fatal("Load accepted invalid values")
+	}
+	for _, name := range []string{"REFRESH_SECONDS", "COLLECTION_MODE", "PROM_NAMESPACE", "FETCH_RETRIES", "LOG_VERBOSE", "FETCH_CONCURRENCY", "READY_INTERVALS", "LOG_LEVEL", "LOG_FORMAT", "METRIC_UNITS", "TEMP_SCALE"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("error %q does not mention %s", err, name)
+		}
+	}
+}
+
+func TestLoadRejectsUnknownTimeoutCommands(t *testing.T) {
+	_, err := Load(nil, []string{"FETCH_TIMEOUT_BATT=25s", "FETCH_TIMEOUT_PWRSYS=abc", "FETCH_TIMEOUT_SECONDS=10"})
+	if err == nil {
+		t.Fatal("Load accepted FETCH_TIMEOUT_BATT")
+	}
+	for _, name := range []string{"FETCH_TIMEOUT_BATT", "FETCH_TIMEOUT_PWRSYS"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("error %q does not mention %s", err, name)
+		}
+	}
+	if strings.Contains(err.Error(), "FETCH_TIMEOUT_SECONDS") {
+		t.Errorf("error %q rejects the legacy FETCH_TIMEOUT_SECONDS", err)
+	}
+
+	cfg, err := Load(nil, []string{"FETCH_TIMEOUT_SOH=40s", "FETCH_TIMEOUT_Log=1m"})
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.Fetch.CommandTimeouts["soh"] != 40*time.Second || cfg.Fetch.CommandTimeouts["log"] != time.Minute {
+		t.Errorf("command timeouts = %v", cfg.Fetch.CommandTimeouts)
+	}
+}
+
+func TestLoadSampleMaxGap(t *testing.T) {
+	tests := []struct {
+		env  []string
+		want time.Duration
+	}{
+		{nil, 5 * time.Minute}, // Collector mode: scrapes set the pace, not REFRESH_SECONDS
+		{[]string{"REFRESH_SECONDS=30"}, 5 * time.Minute},
+		{[]string{"COLLECTION_MODE=ticker", "REFRESH_SECONDS=30"}, 90 * time.Second},
+		{[]string{"COLLECTION_MODE=ticker", "SAMPLE_MAX_GAP=2m"}, 2 * time.Minute},
+		{[]string{"SAMPLE_MAX_GAP=15m"}, 15 * time.Minute},
+	}
+	for _, tt := range tests {
+		cfg, err := Load(nil, tt.env)
+		if err != nil {
+			t.Fatalf("Load(%v) returned error: %v", tt.env, err)
+		}
+		if cfg.SampleMaxGap != tt.want {
+			t.Errorf("Load(%v).SampleMaxGap = %s, want %s", tt.env, cfg.SampleMaxGap, tt.want)
+		}
+	}
+}
+
+func TestLoadLogLevel(t *testing.T) {
+	tests := []struct {
+		args    []string
+		environ []string
+		want    string
+	}{
+		{nil, nil, "info"},
+		{nil, []string{"LOG_VERBOSE=true"}, "debug"},
+		{nil, []string{"LOG_VERBOSE=true", "LOG_LEVEL=WARN"}, "warn"},
+		{[]string{"-log-level", "error"}, []string{"LOG_LEVEL=debug"}, "error"},
+		{[]string{"-verbose"}, nil, "debug"},
+	}
+	for _, tt := range tests {
+		cfg, err := Load(tt.args, tt.environ)
+		if err != nil {
+			t.Fatalf("Load(%v, %v) returned error: %v", tt.args, tt.environ, err)
+		}
+		if cfg.LogLevel != tt.want || cfg.LogFormat != "text" {
+			t.Errorf("Load(%v, %v): level %q, format %q, want %q and text", tt.args, tt.environ, cfg.LogLevel, cfg.LogFormat, tt.want)
+		}
+	}
+}
+
+func TestStringRedactsSecrets(t *testing.T) {
+	cfg, err := Load(nil, []string{"MQTT_BROKER=tcp://broker:1883", "MQTT_PASSWORD=hunter2", "GRPC_TOKEN=s3cret", "DEVICE_TOKEN=t0ken", "INFLUX_TOKEN=1nflux"})
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	out := cfg.String()
+	if strings.Contains(out, "hunter2") || strings.Contains(out, "s3cret") || strings.Contains(out, "t0ken") || strings.Contains(out, "1nflux") {
+		t.Fatalf("String() leaks a secret: %s", out)
+	}
+	if !strings.Contains(out, "mqtt-password=<redacted>") || !strings.Contains(out, "mqtt-broker=tcp://broker:1883") {
+		t.Fatalf("String() = %s", out)
+	}
+}
+
+func TestLoadDeviceAuth(t *testing.T) {
+	cfg, err := Load(nil, []string{"DEVICE_USERNAME=admin", "DEVICE_PASSWORD=secret", "DEVICE_CA_FILE=/etc/pylontech/ca.pem"})
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.Fetch.Username != "admin" || cfg.Fetch.Password != "secret" || cfg.Fetch.Scheme != "https" {
+		t.Errorf("fetch = %+v, want basic auth over https", cfg.Fetch)
+	}
+
+	_, err = Load(nil, []string{"DEVICE_USERNAME=admin", "DEVICE_TOKEN=abc", "DEVICE_TLS_INSECURE_SKIP_VERIFY=maybe"})
+	if err == nil {
+		t.Fatal("Load accepted basic auth together with a token")
+	}
+	for _, name := range []string{"DEVICE_TOKEN", "DEVICE_TLS_INSECURE_SKIP_VERIFY"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("error %q does not mention %s", err, name)
+		}
+	}
+}
+
+func TestLoadReplayAndDump(t *testing.T) {
+	cfg, err := Load([]string{"-dump-raw", "captures"}, []string{"DEVICE_MODE=file", "FIXTURE_DIR=testdata/us5000"})
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.Fetch.Mode != "file" || cfg.Fetch.FixtureDir != "testdata/us5000" || cfg.Fetch.DumpDir != "captures" {
+		t.Errorf("fetch = %+v, want file replay and raw dumps", cfg.Fetch)
+	}
+}
+
+func TestLoadCellVoltBuckets(t *testing.T) {
+	cfg, err := Load(nil, nil)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if b := cfg.Metrics.CellVoltBuckets; len(b) != 53 || b[0] != 2.5 || b[1] != 2.525 || b[52] != 3.8 {
+		t.Fatalf("default buckets = %v, want 2.5 to 3.8 V in 25 mV steps", b)
+	}
+
+	cfg, err = Load(nil, []string{"CELL_VOLT_BUCKETS=3.0:3.6:0.1"})
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if want := []float64{3, 3.1, 3.2, 3.3, 3.4, 3.5, 3.6}; !reflect.DeepEqual(cfg.Metrics.CellVoltBuckets, want) {
+		t.Fatalf("buckets = %v, want %v", cfg.Metrics.CellVoltBuckets, want)
+	}
+	if !strings.Contains(cfg.String(), "cell-volt-buckets=3:3.6:0.1") {
+		t.Errorf("String() = %s, want the bucket spec", cfg)
+	}
+
+	for _, raw := range []string{"3.6:3.0:0.1", "2.5:3.8", "2.5:3.8:0", "2.5:3.8:x"} {
+		if _, err := Load(nil, []string{"CELL_VOLT_BUCKETS=" + raw}); err == nil || !strings.Contains(err.Error(), "CELL_VOLT_BUCKETS") {
+			t.Errorf("CELL_VOLT_BUCKETS=%s: error = %v", raw, err)
+		}
+	}
+}
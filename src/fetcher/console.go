@@ -0,0 +1,58 @@
+package fetcher
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Console failures that are not transport errors. They are wrapped with the
+// offending line, so use errors.Is to tell them apart.
+var (
+	// ErrConsoleBusy is returned when the console is still busy with a
+	// previous command; the command is retried.
+	ErrConsoleBusy = errors.New("console busy")
+	// ErrInvalidCommand is returned when the firmware rejects the command.
+	// It is not retried.
+	ErrInvalidCommand = errors.New("invalid command")
+	// ErrUnexpectedContent is returned for an empty response or one that is
+	// not console text, such as an HTML error page of the dongle.
+	ErrUnexpectedContent = errors.New("unexpected content")
+)
+
+// busyMessages and invalidCommandMessages are lower-case fragments of the
+// console's error lines.
+var (
+	busyMessages           = []string{"command is not complete", "system is busy", "console busy"}
+	invalidCommandMessages = []string{"invalid command", "unknown command"}
+)
+
+// checkConsoleOutput returns an error wrapping one of the console errors
+// above when lines are not the regular output of a command.
+func checkConsoleOutput(lines []string) error {
+	if len(lines) == 0 {
+		return fmt.Errorf("%w: empty response", ErrUnexpectedContent)
+	}
+	for _, line := range lines {
+		lower := strings.ToLower(line)
+		switch {
+		case strings.HasPrefix(lower, "<!doctype") || strings.HasPrefix(lower, "<html") ||
+			strings.HasPrefix(lower, "<head") || strings.HasPrefix(lower, "<body"):
+			return fmt.Errorf("%w: HTML instead of console output", ErrUnexpectedContent)
+		case containsAny(lower, busyMessages):
+			return fmt.Errorf("%w: %s", ErrConsoleBusy, line)
+		case containsAny(lower, invalidCommandMessages):
+			return fmt.Errorf("%w: %s", ErrInvalidCommand, line)
+		}
+	}
+	return nil
+}
+
+func containsAny(s string, fragments []string) bool {
+	for _, fragment := range fragments {
+		if strings.Contains(s, fragment) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"pylontech_exporter/src/config"
+)
+
+// Fetcher runs the console commands of one device. Device implements it for
+// the HTTP dongle, the serial console and replayed fixtures.
+type Fetcher interface {
+	// BeginCycle is called before the commands of a collection cycle.
+	BeginCycle()
+	FetchConsoleOutput(ctx context.Context, command string) ([]string, error)
+}
+
+// Device is one battery stack with its own console. Each device has its
+// own endpoints and HTTP session, so devices can be queried concurrently
+// and a failing one does not affect the others.
+type Device struct {
+	// Name is the value of the device label of all metrics of the stack.
+	Name string
+
+	endpoints  *endpointSet // nil for the serial console and replay
+	session    *session
+	fixtureDir string // DEVICE_MODE=file replays the command output from here
+
+	// console is held shared by the commands in flight, and exclusively
+	// once paged is set; see fetchFromEndpoint.
+	console sync.RWMutex
+	paged   atomic.Bool
+}
+
+// settings is the fetcher configuration, see Configure.
+var settings = config.Default().Fetch
+
+// Configure sets the device, transport and retry settings. It must be called
+// before the first device is loaded.
+func Configure(cfg config.Fetch) {
+	settings = cfg
+}
+
+// logger receives retries, failovers and session changes; see SetLogger.
+var logger = slog.Default()
+
+// SetLogger sets the logger of the fetcher. Like Configure it must be called
+// before the first device is loaded.
+func SetLogger(l *slog.Logger) {
+	logger = l
+}
+
+var (
+	devicesOnce sync.Once
+	devices     []*Device
+	devicesErr  error
+)
+
+// LoadDevices returns the configured devices. DEVICES lists named stacks as
+// "garage=192.168.1.10:80,basement=192.168.1.11"; a comma-separated
+// DEVICE_IP is a shorthand that names each stack after its address.
+// Otherwise there is a single device named DEVICE_NAME (default "default")
+// reached through DEVICE_IP, DEVICE_ENDPOINTS or DEVICE_MODE=serial, or
+// replayed from FIXTURE_DIR with DEVICE_MODE=file.
+func LoadDevices() ([]*Device, error) {
+	devicesOnce.Do(func() {
+		devices, devicesErr = loadDevices()
+	})
+	return devices, devicesErr
+}
+
+func loadDevices() ([]*Device, error) {
+	multiple := settings.Devices
+	if multiple == "" && strings.Contains(settings.DeviceIP, ",") {
+		for _, ip := range strings.Split(settings.DeviceIP, ",") {
+			if ip = strings.TrimSpace(ip); ip != "" {
+				multiple += ip + "=" + ip + ","
+			}
+		}
+	}
+
+	if multiple == "" {
+		name := settings.DeviceName
+		device := &Device{Name: name, session: &session{device: name}}
+		if settings.Mode == "file" {
+			logger.Info("Replaying console output from fixtures", "device", name, "dir", settings.FixtureDir)
+			device.fixtureDir = settings.FixtureDir
+			return []*Device{device}, nil
+		}
+		if serialMode() {
+			return []*Device{device}, nil
+		}
+		endpoints, err := configuredEndpoints()
+		if err != nil {
+			return nil, err
+		}
+		device.endpoints = newEndpointSet(name, endpoints, device.session)
+		return []*Device{device}, nil
+	}
+
+	if settings.Mode != "http" {
+		return nil, fmt.Errorf("DEVICE_MODE=%s supports a single device, unset DEVICES", settings.Mode)
+	}
+	var result []*Device
+	seen := map[string]bool{}
+	for _, entry := range strings.Split(multiple, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, endpoint, ok := strings.Cut(entry, "=")
+		name, endpoint = strings.TrimSpace(name), strings.TrimSpace(endpoint)
+		if !ok || name == "" || endpoint == "" {
+			return nil, fmt.Errorf("invalid DEVICES entry '%s', expected name=host[:port]", entry)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("device name '%s' is used more than once", name)
+		}
+		seen[name] = true
+
+		device := &Device{Name: name, session: &session{device: name}}
+		device.endpoints = newEndpointSet(name, []string{withDefaultPort(endpoint, settings.DevicePort)}, device.session)
+		result = append(result, device)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no devices configured in DEVICES")
+	}
+	for _, device := range result {
+		logger.Info("Monitoring device", "device", device.Name, "endpoint", device.endpoints.current())
+	}
+	return result, nil
+}
+
+// BeginCycle pins the endpoint used by all commands of the device's next
+// collection cycle; see endpointSet.beginCycle.
+func (d *Device) BeginCycle() {
+	if d.endpoints != nil {
+		d.endpoints.beginCycle()
+	}
+}
+
+// ResetSession drops the device's session cookies.
+func (d *Device) ResetSession() {
+	d.session.reset()
+}
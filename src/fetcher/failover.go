@@ -0,0 +1,152 @@
+package fetcher
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"pylontech_exporter/src/metrics"
+)
+
+const (
+	preferredProbeEvery = 30 * time.Second
+	probeTimeout        = 3 * time.Second
+)
+
+// endpointSet is the ordered list of endpoints of one device. The first one
+// is preferred; the others are used after repeated failures.
+type endpointSet struct {
+	mu            sync.Mutex
+	device        string
+	session       *session
+	endpoints     []string // host:port
+	active        int      // endpoint used by the current cycle
+	failures      int      // consecutive failures on the active endpoint
+	failoverAfter int
+	lastProbe     time.Time
+	probing       bool // a probe of the preferred endpoint is in flight
+	preferredUp   bool // the last probe reached the preferred endpoint
+}
+
+func newEndpointSet(device string, endpoints []string, sess *session) *endpointSet {
+	set := &endpointSet{device: device, session: sess, endpoints: endpoints, failoverAfter: settings.FailoverAfter}
+	set.publish()
+	return set
+}
+
+// configuredEndpoints returns DEVICE_ENDPOINTS ("ip:port,ip:port") or, if
+// unset, DEVICE_IP/DEVICE_PORT followed by
+// DEVICE_FALLBACK_IP/DEVICE_FALLBACK_PORT. These are the endpoints of the
+// single device used without DEVICES.
+func configuredEndpoints() ([]string, error) {
+	var endpoints []string
+	if len(settings.Endpoints) > 0 {
+		for _, endpoint := range settings.Endpoints {
+			endpoints = append(endpoints, withDefaultPort(endpoint, "80"))
+		}
+	} else {
+		if settings.DeviceIP == "" {
+			return nil, fmt.Errorf("DEVICE_IP not set")
+		}
+		port := settings.DevicePort
+		endpoints = append(endpoints, net.JoinHostPort(settings.DeviceIP, port))
+
+		if settings.FallbackIP != "" {
+			fallbackPort := settings.FallbackPort
+			if fallbackPort == "" {
+				fallbackPort = port
+			}
+			endpoints = append(endpoints, net.JoinHostPort(settings.FallbackIP, fallbackPort))
+		}
+	}
+
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no device endpoints configured")
+	}
+	return endpoints, nil
+}
+
+// withDefaultPort appends port to an endpoint given without one.
+func withDefaultPort(endpoint, port string) string {
+	if _, _, err := net.SplitHostPort(endpoint); err != nil {
+		return net.JoinHostPort(endpoint, port)
+	}
+	return endpoint
+}
+
+// beginCycle pins the endpoint used by all commands of the next collection
+// cycle, so commands of one cycle are never spread across endpoints. While a
+// fallback is active, the preferred endpoint is probed in the background (at
+// most every 30 seconds); the cycle after a successful probe switches back.
+func (set *endpointSet) beginCycle() {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+
+	if set.failures >= set.failoverAfter && len(set.endpoints) > 1 {
+		next := (set.active + 1) % len(set.endpoints)
+		logger.Warn("Endpoint failed repeatedly, switching to the next one", "device", set.device, "endpoint", set.endpoints[set.active], "failures", set.failures, "next", set.endpoints[next])
+		set.switchTo(next)
+		return
+	}
+	if set.active == 0 {
+		return
+	}
+
+	if set.preferredUp {
+		logger.Info("Preferred endpoint is reachable again, switching back", "device", set.device, "endpoint", set.endpoints[0], "previous", set.endpoints[set.active])
+		set.switchTo(0)
+		return
+	}
+	if !set.probing && time.Since(set.lastProbe) >= preferredProbeEvery {
+		set.lastProbe = time.Now()
+		set.probing = true
+		go set.probePreferred()
+	}
+}
+
+// probePreferred dials the preferred endpoint without holding the lock, so
+// an unreachable endpoint never delays a cycle by the probe timeout.
+func (set *endpointSet) probePreferred() {
+	conn, err := net.DialTimeout("tcp", set.endpoints[0], probeTimeout)
+	if err == nil {
+		conn.Close()
+	}
+
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	set.probing = false
+	set.preferredUp = err == nil && set.active != 0
+}
+
+// current returns the endpoint pinned for the current cycle.
+func (set *endpointSet) current() string {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	return set.endpoints[set.active]
+}
+
+// recordResult tracks consecutive failures of the active endpoint.
+func (set *endpointSet) recordResult(err error) {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	if err != nil {
+		set.failures++
+	} else {
+		set.failures = 0
+	}
+}
+
+func (set *endpointSet) switchTo(idx int) {
+	set.active = idx
+	set.failures = 0
+	set.lastProbe = time.Now()
+	set.preferredUp = false
+	set.publish()
+	// Session cookies belong to the endpoint that issued them
+	set.session.reset()
+}
+
+func (set *endpointSet) publish() {
+	metrics.SetActiveEndpoint(set.device, set.endpoints, set.active)
+}
@@ -0,0 +1,70 @@
+package fetcher
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// waitForProbe waits until the background probe of the preferred endpoint
+// finished.
+func waitForProbe(t *testing.T, set *endpointSet) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * probeTimeout); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		set.mu.Lock()
+		probing := set.probing
+		set.mu.Unlock()
+		if !probing {
+			return
+		}
+	}
+	t.Fatal("probe of the preferred endpoint did not finish")
+}
+
+func TestEndpointSetFailsOverAndBack(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	preferred := listener.Addr().String()
+	listener.Close()
+	set := &endpointSet{device: "test", session: &session{device: "test"}, endpoints: []string{preferred, "127.0.0.1:1"}, failoverAfter: 2}
+
+	set.recordResult(errors.New("refused"))
+	set.beginCycle()
+	if got := set.current(); got != preferred {
+		t.Fatalf("current = %s after one failure, want the preferred endpoint", got)
+	}
+	set.recordResult(errors.New("refused"))
+	set.beginCycle()
+	if got := set.current(); got != "127.0.0.1:1" {
+		t.Fatalf("current = %s after %d failures, want the fallback", got, set.failoverAfter)
+	}
+
+	// The preferred endpoint is still down: the probe runs in the background
+	// and the cycle stays on the fallback.
+	set.lastProbe = time.Time{}
+	set.beginCycle()
+	waitForProbe(t, set)
+	set.beginCycle()
+	if got := set.current(); got != "127.0.0.1:1" {
+		t.Fatalf("current = %s while the preferred endpoint is down, want the fallback", got)
+	}
+
+	listener, err = net.Listen("tcp", preferred)
+	if err != nil {
+		t.Skipf("could not listen on %s again: %v", preferred, err)
+	}
+	defer listener.Close()
+	set.lastProbe = time.Time{}
+	set.beginCycle()
+	if got := set.current(); got != "127.0.0.1:1" {
+		t.Fatalf("current = %s in the cycle that started the probe, want the fallback", got)
+	}
+	waitForProbe(t, set)
+	set.beginCycle()
+	if got := set.current(); got != preferred {
+		t.Fatalf("current = %s after a successful probe, want the preferred endpoint", got)
+	}
+}
@@ -1,58 +1,277 @@
 package fetcher
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
-	"os"
 	"strings"
 	"time"
+
+	"pylontech_exporter/src/metrics"
 )
 
 // FetchConsoleOutput fetches lines of text from the device's console output.
 // It takes a command (e.g., "bat", "pwr") as input.
-func FetchConsoleOutput(command string) ([]string, error) {
-	ip := os.Getenv("DEVICE_IP")
-	if ip == "" {
-		return nil, fmt.Errorf("DEVICE_IP not set in environment")
+// Requests go to the endpoint pinned by the last BeginCycle call, or to the
+// serial console with DEVICE_MODE=serial. Failed attempts are retried with
+// exponential backoff as configured by FETCH_RETRIES and FETCH_BACKOFF_MS;
+// cancelling ctx aborts the request in flight and any further attempts.
+// With DEVICE_MODE=file the output is read from a fixture, see fetchFromFile.
+// Output that is not a regular command output yields ErrConsoleBusy,
+// ErrInvalidCommand or ErrUnexpectedContent; a rejected command is not
+// retried.
+func (d *Device) FetchConsoleOutput(ctx context.Context, command string) ([]string, error) {
+	if d.fixtureDir != "" {
+		lines, err := fetchFromFile(d.fixtureDir, command)
+		if err != nil {
+			return nil, err
+		}
+		return lines, checkConsoleOutput(lines)
 	}
-	// Ensure DEVICE_PORT is also configurable, defaulting if not set
-	port := os.Getenv("DEVICE_PORT")
-	if port == "" {
-		port = "80" // Default HTTP port
+
+	var lines []string
+	var err error
+	for attempt := 0; ; attempt++ {
+		lines, err = d.fetchOnce(ctx, command)
+		if err == nil {
+			err = checkConsoleOutput(lines)
+		}
+		if err == nil || errors.Is(err, ErrInvalidCommand) || attempt >= settings.Retries || ctx.Err() != nil {
+			break
+		}
+
+		delay := settings.Backoff << attempt
+		logger.Warn("Fetch failed, retrying", "device", d.Name, "command", command, "attempt", attempt+1, "attempts", settings.Retries+1, "delay", delay.String(), "error", err)
+		metrics.RecordRetry(d.Name, command)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("fetching '%s' cancelled: %w", command, ctx.Err())
+		case <-time.After(delay):
+		}
 	}
 
-	requestURL, err := buildRequestURL(ip, port, command)
+	// A cancelled fetch says nothing about the endpoint's health, and a
+	// console that answers busy or rejects the command is reachable
+	if d.endpoints != nil && ctx.Err() == nil {
+		if errors.Is(err, ErrConsoleBusy) || errors.Is(err, ErrInvalidCommand) {
+			d.endpoints.recordResult(nil)
+		} else {
+			d.endpoints.recordResult(err)
+		}
+	}
+	return lines, err
+}
+
+func (d *Device) fetchOnce(ctx context.Context, command string) ([]string, error) {
+	if d.endpoints == nil {
+		return fetchFromSerial(ctx, d.Name, command)
+	}
+	return d.fetchFromEndpoint(ctx, d.endpoints.current(), command)
+}
+
+// maxConsolePages bounds the pages followed for a single command, so a
+// console that keeps printing the paging prompt cannot stall a cycle.
+const maxConsolePages = 64
+
+// errPagedOutput is returned by fetchPages when it meets the paging prompt
+// without holding the console exclusively.
+var errPagedOutput = errors.New("output continues on another page")
+
+// fetchFromEndpoint runs command on endpoint. The console continues paged
+// output with an empty command, which it cannot tell apart between commands
+// in flight at the same time. Commands therefore run concurrently only until
+// the first output of the device is paged; from then on each command holds
+// the console exclusively, and the command that met the prompt is sent again.
+func (d *Device) fetchFromEndpoint(ctx context.Context, endpoint, command string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, CommandTimeout(command))
+	defer cancel()
+
+	if !d.paged.Load() {
+		d.console.RLock()
+		lines, err := d.fetchPages(ctx, endpoint, command, false)
+		d.console.RUnlock()
+		if !errors.Is(err, errPagedOutput) {
+			return lines, err
+		}
+		if !d.paged.Swap(true) {
+			logger.Info("Console output is paged, sending commands one at a time", "device", d.Name, "command", command)
+		}
+	}
+	d.console.Lock()
+	defer d.console.Unlock()
+	return d.fetchPages(ctx, endpoint, command, true)
+}
+
+// fetchPages sends command and joins its pages. Output longer than one
+// console page ends with the paging prompt; the remaining pages are
+// requested with an empty command, so a row split across a page boundary is
+// whole again. Unless exclusive is set, the prompt yields errPagedOutput.
+func (d *Device) fetchPages(ctx context.Context, endpoint, command string, exclusive bool) ([]string, error) {
+	var output strings.Builder
+	page, err := d.fetchPage(ctx, endpoint, command, command)
+	for pages := 1; err == nil; pages++ {
+		idx := strings.Index(page, string(pagingPrompt))
+		if idx >= 0 && !exclusive {
+			return nil, errPagedOutput // Not dumped, the command is sent again
+		}
+		if idx < 0 {
+			output.WriteString(page)
+			if settings.DumpDir != "" {
+				dumpRaw(d.Name, command, []byte(output.String()))
+			}
+			return splitConsoleLines(output.String()), nil
+		}
+		if pages >= maxConsolePages {
+			return nil, fmt.Errorf("output of '%s' did not end after %d pages", command, maxConsolePages)
+		}
+		// The prompt is printed on a line of its own after the page
+		output.WriteString(strings.TrimSuffix(strings.TrimSuffix(page[:idx], "\n"), "\r"))
+
+		page, err = d.fetchPage(ctx, endpoint, "", command)
+		if err == nil {
+			page = dropRepeatedLines(page, completeLines(output.String()))
+		}
+	}
+	return nil, err
+}
+
+// fetchPage sends code to the console and returns the response body.
+// command names the console command in metrics.
+func (d *Device) fetchPage(ctx context.Context, endpoint, code, command string) (string, error) {
+	client := d.session.deviceClient()
+	requestURL, err := buildRequestURL(endpoint, code)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
-	// Create an HTTP client with a timeout
-	client := http.Client{
-		Timeout: 15 * time.Second,
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request for %s: %w", requestURL, err)
 	}
 
-	resp, err := client.Get(requestURL)
+	authorize(req)
+
+	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get data from %s: %w", requestURL, err)
+		// The url.Error would repeat the URL, including a query token
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return "", fmt.Errorf("failed to get data from %s: %w", requestURL, err)
 	}
 	defer resp.Body.Close()
+	metrics.RecordDeviceResponse(d.Name, command, resp.StatusCode)
+	d.session.logNewCookies(resp)
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		// The session expired or was rejected; start over on the next request
+		d.session.reset()
+		return "", &AuthError{StatusCode: resp.StatusCode, URL: requestURL}
+	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("received non-200 status code %d from %s", resp.StatusCode, requestURL)
+		return "", fmt.Errorf("received non-200 status code %d from %s", resp.StatusCode, requestURL)
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("error reading response body: %w", err)
+		return "", fmt.Errorf("error reading response body: %w", err)
+	}
+	return string(body), nil
+}
+
+// AuthError is returned when the device rejects a request with 401 or 403,
+// e.g. because the credentials are missing, wrong or expired.
+type AuthError struct {
+	StatusCode int
+	URL        string
+}
+
+func (e *AuthError) Error() string {
+	return fmt.Sprintf("device rejected the credentials with status code %d from %s", e.StatusCode, e.URL)
+}
+
+// authorize adds the configured credentials to a device request:
+// DEVICE_USERNAME/DEVICE_PASSWORD as basic auth, or DEVICE_TOKEN as bearer
+// token or, with DEVICE_TOKEN_PARAM, as query parameter.
+func authorize(req *http.Request) {
+	switch {
+	case settings.Username != "":
+		req.SetBasicAuth(settings.Username, settings.Password)
+	case settings.Token != "" && settings.TokenParam != "":
+		query := req.URL.Query()
+		query.Set(settings.TokenParam, settings.Token)
+		req.URL.RawQuery = strings.ReplaceAll(query.Encode(), "+", "%20")
+	case settings.Token != "":
+		req.Header.Set("Authorization", "Bearer "+settings.Token)
+	}
+}
+
+// completeLines returns the trimmed lines of output that are terminated by
+// a line break; a trailing partial row is left out.
+func completeLines(output string) map[string]bool {
+	lines := map[string]bool{}
+	end := strings.LastIndex(output, "\n")
+	if end < 0 {
+		return lines
+	}
+	for _, line := range splitConsoleLines(output[:end]) {
+		lines[line] = true
+	}
+	return lines
+}
+
+// dropRepeatedLines removes the leading lines of a continuation page that
+// were already printed, such as the column headers repeated on every page.
+// Leading line breaks are kept, as they end the last row of the previous
+// page.
+func dropRepeatedLines(page string, printed map[string]bool) string {
+	var breaks strings.Builder
+	for {
+		line, rest, found := strings.Cut(page, "\n")
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case !found:
+			return breaks.String() + page
+		case trimmed == "":
+			breaks.WriteString(line + "\n")
+		case printed[trimmed]:
+		default:
+			return breaks.String() + page
+		}
+		page = rest
 	}
+}
 
-	return splitConsoleLines(string(body)), nil
+// CommandTimeout returns the fetch timeout for a single attempt of a
+// command. A per-command override such as FETCH_TIMEOUT_PWR or
+// FETCH_TIMEOUT_BAT (named after the first word of the command) takes
+// precedence over FETCH_TIMEOUT.
+func CommandTimeout(command string) time.Duration {
+	if fields := strings.Fields(command); len(fields) > 0 {
+		if timeout, ok := settings.CommandTimeouts[strings.ToLower(fields[0])]; ok {
+			return timeout
+		}
+	}
+	return settings.Timeout
+}
+
+// CommandDeadline returns how long a command may take including all retries
+// and their backoff.
+func CommandDeadline(command string) time.Duration {
+	total := CommandTimeout(command) * time.Duration(settings.Retries+1)
+	for attempt := 0; attempt < settings.Retries; attempt++ {
+		total += settings.Backoff << attempt
+	}
+	return total
 }
 
-func buildRequestURL(ip, port, command string) (string, error) {
-	baseURL := fmt.Sprintf("http://%s:%s/req", ip, port)
+func buildRequestURL(endpoint, command string) (string, error) {
+	baseURL := fmt.Sprintf("%s://%s/req", deviceScheme, endpoint)
 	parsedURL, err := url.Parse(baseURL)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse base URL %s: %w", baseURL, err)
@@ -0,0 +1,315 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"pylontech_exporter/src/parser"
+)
+
+// pagedConsole serves the first page for the command and the following
+// pages for the empty continuation command, like the HTTP dongle. Sending the
+// command again starts over.
+func pagedConsole(t *testing.T, command string, pages ...string) (*Device, string) {
+	t.Helper()
+	next := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code := r.URL.Query().Get("code")
+		if code == command {
+			next = 0
+		}
+		if (next == 0) != (code == command) || next >= len(pages) {
+			t.Errorf("unexpected request code=%q for page %d", code, next+1)
+			http.Error(w, "unexpected", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(pages[next]))
+		next++
+	}))
+	t.Cleanup(server.Close)
+	return &Device{Name: "test", session: &session{device: "test"}}, strings.TrimPrefix(server.URL, "http://")
+}
+
+func TestFetchJoinsPagesSplitInsideARow(t *testing.T) {
+	device, endpoint := pagedConsole(t, "bat 1",
+		"bat 1\r\n@\r\nBattery  Volt  Curr   Tempr  Base State\r\n0        3301  -1459  21000  Dischg\r\n1        3302  -14\r\nPress [Enter] to be continued,other key to exit\r\n$$",
+		"@\r\nBattery  Volt  Curr   Tempr  Base State\r\n59  21000  Dischg\r\n2        3303  -1459  21000  Dischg\r\nCommand completed successfully\r\n$$",
+	)
+
+	lines, err := device.fetchFromEndpoint(context.Background(), endpoint, "bat 1")
+	if err != nil {
+		t.Fatalf("fetchFromEndpoint returned error: %v", err)
+	}
+	want := []string{
+		"bat 1",
+		"@",
+		"Battery  Volt  Curr   Tempr  Base State",
+		"0        3301  -1459  21000  Dischg",
+		"1        3302  -1459  21000  Dischg",
+		"2        3303  -1459  21000  Dischg",
+		"Command completed successfully",
+		"$$",
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Fatalf("lines = %q\nwant %q", lines, want)
+	}
+}
+
+func TestFetchKeepsRowsEndingAtPageBoundary(t *testing.T) {
+	device, endpoint := pagedConsole(t, "pwr",
+		"pwr\r\n@\r\nPower Volt\r\n1     51516\r\n\r\nPress [Enter] to be continued\r\n$$",
+		"Power Volt\r\n2     51517\r\n\r\nPress [Enter] to be continued\r\n$$",
+		"\r\n3     51518\r\nCommand completed successfully\r\n$$",
+	)
+
+	lines, err := device.fetchFromEndpoint(context.Background(), endpoint, "pwr")
+	if err != nil {
+		t.Fatalf("fetchFromEndpoint returned error: %v", err)
+	}
+	want := []string{"pwr", "@", "Power Volt", "1     51516", "2     51517", "3     51518", "Command completed successfully", "$$"}
+	if !reflect.DeepEqual(lines, want) {
+		t.Fatalf("lines = %q\nwant %q", lines, want)
+	}
+}
+
+func TestFetchStopsAfterMaxPages(t *testing.T) {
+	pages := make([]string, maxConsolePages)
+	for i := range pages {
+		pages[i] = "0  3300\r\nPress [Enter] to be continued\r\n"
+	}
+	device, endpoint := pagedConsole(t, "bat 1", pages...)
+
+	if _, err := device.fetchFromEndpoint(context.Background(), endpoint, "bat 1"); err == nil {
+		t.Fatal("fetchFromEndpoint accepted output that never ends")
+	}
+}
+
+func TestFetchSerializesPagedCommands(t *testing.T) {
+	// Like the dongle, the console keeps one output: a command replaces it
+	// and the empty command continues whichever was sent last
+	outputs := map[string][]string{
+		"bat 1": {"bat 1\r\n0  3301\r\n\r\nPress [Enter] to be continued\r\n", "1  3302\r\n$$"},
+		"bat 2": {"bat 2\r\n0  3401\r\n\r\nPress [Enter] to be continued\r\n", "1  3402\r\n$$"},
+	}
+	var mu sync.Mutex
+	current, next := "", 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		if code := r.URL.Query().Get("code"); code != "" {
+			current, next = code, 0
+		}
+		pages := outputs[current]
+		page := ""
+		if next < len(pages) {
+			page = pages[next]
+		}
+		next++
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond) // Let the other command interleave
+		w.Write([]byte(page))
+	}))
+	t.Cleanup(server.Close)
+	device := &Device{Name: "test", session: &session{device: "test"}}
+	endpoint := strings.TrimPrefix(server.URL, "http://")
+
+	for round := 0; round < 3; round++ {
+		var wg sync.WaitGroup
+		results := make([][]string, 3)
+		errs := make([]error, 3)
+		for unit := 1; unit <= 2; unit++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				results[unit], errs[unit] = device.fetchFromEndpoint(context.Background(), endpoint, "bat "+strconv.Itoa(unit))
+			}()
+		}
+		wg.Wait()
+		for unit := 1; unit <= 2; unit++ {
+			volt := 3200 + 100*unit
+			want := []string{"bat " + strconv.Itoa(unit), "0  " + strconv.Itoa(volt+1), "1  " + strconv.Itoa(volt+2), "$$"}
+			if errs[unit] != nil || !reflect.DeepEqual(results[unit], want) {
+				t.Fatalf("round %d: bat %d = %q, %v, want %q", round+1, unit, results[unit], errs[unit], want)
+			}
+		}
+	}
+}
+
+// configureAuth sets the device credentials for the rest of the test.
+func configureAuth(t *testing.T, username, password, token, tokenParam string) {
+	t.Helper()
+	previous := settings
+	settings.Username, settings.Password, settings.Token, settings.TokenParam = username, password, token, tokenParam
+	t.Cleanup(func() { settings = previous })
+}
+
+func TestFetchSendsCredentials(t *testing.T) {
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		got = append(got, user+":"+pass+"|"+r.Header.Get("Authorization")+"|"+r.URL.Query().Get("token")+"|"+r.URL.Query().Get("code"))
+		w.Write([]byte("pwr\r\n$$"))
+	}))
+	defer server.Close()
+	endpoint := strings.TrimPrefix(server.URL, "http://")
+	device := &Device{Name: "test", session: &session{device: "test"}}
+
+	configureAuth(t, "admin", "secret", "", "")
+	device.fetchFromEndpoint(context.Background(), endpoint, "bat 1")
+	configureAuth(t, "", "", "abc", "")
+	device.fetchFromEndpoint(context.Background(), endpoint, "bat 1")
+	configureAuth(t, "", "", "abc", "token")
+	device.fetchFromEndpoint(context.Background(), endpoint, "bat 1")
+
+	want := []string{
+		"admin:secret|Basic YWRtaW46c2VjcmV0||bat 1",
+		":|Bearer abc||bat 1",
+		":||abc|bat 1",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("requests = %q\nwant %q", got, want)
+	}
+}
+
+func TestFetchReturnsAuthError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}))
+	defer server.Close()
+	device := &Device{Name: "test", session: &session{device: "test"}}
+
+	_, err := device.fetchFromEndpoint(context.Background(), strings.TrimPrefix(server.URL, "http://"), "pwr")
+	var authErr *AuthError
+	if !errors.As(err, &authErr) || authErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("error = %v, want an AuthError with status 401", err)
+	}
+}
+
+func TestCheckConsoleOutput(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  error
+	}{
+		{"regular output", []string{"pwr", "@", "Power Volt", "1     51516", "$$"}, nil},
+		{"busy", []string{"bat 1", "Command is not complete", "$$"}, ErrConsoleBusy},
+		{"invalid command", []string{"soh 1", "Invalid command or fail to excute.", "$$"}, ErrInvalidCommand},
+		{"HTML page", []string{"<!DOCTYPE html>", "<html><body>500 Internal Error</body></html>"}, ErrUnexpectedContent},
+		{"empty", nil, ErrUnexpectedContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkConsoleOutput(tt.lines)
+			if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("checkConsoleOutput = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// consoleServer answers every request with the next of responses and
+// returns a device using it as its only endpoint.
+func consoleServer(t *testing.T, responses ...string) (*Device, *int) {
+	t.Helper()
+	previous := settings
+	settings.Retries, settings.Backoff = 2, 0
+	t.Cleanup(func() { settings = previous })
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(responses[min(requests, len(responses)-1)]))
+		requests++
+	}))
+	t.Cleanup(server.Close)
+	sess := &session{device: "test"}
+	endpoint := strings.TrimPrefix(server.URL, "http://")
+	return &Device{Name: "test", session: sess, endpoints: newEndpointSet("test", []string{endpoint}, sess)}, &requests
+}
+
+func TestFetchRetriesBusyConsole(t *testing.T) {
+	device, requests := consoleServer(t, "pwr\r\nCommand is not complete\r\n$$", "pwr\r\n@\r\n1  51516\r\n$$")
+
+	lines, err := device.FetchConsoleOutput(context.Background(), "pwr")
+	if err != nil || *requests != 2 {
+		t.Fatalf("FetchConsoleOutput = %q, %v after %d requests, want the second response", lines, err, *requests)
+	}
+}
+
+func TestFetchDoesNotRetryInvalidCommand(t *testing.T) {
+	device, requests := consoleServer(t, "soh 1\r\nInvalid command or fail to excute.\r\n$$")
+
+	_, err := device.FetchConsoleOutput(context.Background(), "soh 1")
+	if !errors.Is(err, ErrInvalidCommand) || *requests != 1 {
+		t.Fatalf("FetchConsoleOutput error %v after %d requests, want ErrInvalidCommand after one", err, *requests)
+	}
+}
+
+func TestFetchRejectsHTMLErrorPage(t *testing.T) {
+	device, requests := consoleServer(t, "<html><head><title>Error</title></head><body>Server busy</body></html>")
+
+	_, err := device.FetchConsoleOutput(context.Background(), "pwr")
+	if !errors.Is(err, ErrUnexpectedContent) || *requests != 3 {
+		t.Fatalf("FetchConsoleOutput error %v after %d requests, want ErrUnexpectedContent after all attempts", err, *requests)
+	}
+}
+
+func TestFetchReplaysFixtures(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "bat+1.txt"), []byte("bat 1\r\n@\r\n0  3301  -1459\r\n$$\r\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	device := &Device{Name: "test", fixtureDir: dir}
+
+	lines, err := device.FetchConsoleOutput(context.Background(), "bat 1")
+	if err != nil {
+		t.Fatalf("FetchConsoleOutput returned error: %v", err)
+	}
+	if want := []string{"bat 1", "@", "0  3301  -1459", "$$"}; !reflect.DeepEqual(lines, want) {
+		t.Fatalf("lines = %q, want %q", lines, want)
+	}
+	if _, err := device.FetchConsoleOutput(context.Background(), "pwr"); err == nil {
+		t.Fatal("FetchConsoleOutput replayed a missing fixture")
+	}
+}
+
+func TestFetchDumpsPagedOutputForReplay(t *testing.T) {
+	dir := t.TempDir()
+	previous := settings
+	settings.DumpDir = dir
+	t.Cleanup(func() { settings = previous })
+	device, endpoint := pagedConsole(t, "bat 1",
+		"bat 1\r\n@\r\nBattery  Volt  Curr   Tempr  Base State\r\n0        3301  -1459  21000  Dischg\r\n1        3302  -14\r\nPress [Enter] to be continued,other key to exit\r\n$$",
+		"@\r\nBattery  Volt  Curr   Tempr  Base State\r\n59  21000  Dischg\r\nCommand completed successfully\r\n$$",
+	)
+
+	fetched, err := device.fetchFromEndpoint(context.Background(), endpoint, "bat 1")
+	if err != nil {
+		t.Fatalf("fetchFromEndpoint returned error: %v", err)
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, "test"))
+	if err != nil || len(entries) != 1 || entries[0].Name() != "bat+1.txt" {
+		t.Fatalf("dump directory holds %v (%v), want test/bat+1.txt", entries, err)
+	}
+
+	replay := &Device{Name: "test", fixtureDir: filepath.Join(dir, "test")}
+	replayed, err := replay.FetchConsoleOutput(context.Background(), "bat 1")
+	if err != nil {
+		t.Fatalf("FetchConsoleOutput of the dump returned error: %v", err)
+	}
+	if !reflect.DeepEqual(replayed, fetched) {
+		t.Fatalf("replayed %q\nfetched %q", replayed, fetched)
+	}
+	rows, err := parser.ParseBAT(replayed)
+	if err != nil || len(rows) != 2 || rows[1].Volt != 3302 || rows[1].Curr != -1459 {
+		t.Fatalf("ParseBAT of the replay = %+v (%v), want both cells of the paged output", rows, err)
+	}
+}
@@ -0,0 +1,41 @@
+package fetcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fixtureName is the file holding the output of command, with spaces
+// replaced by "+": "pwr.txt", "bat+1.txt".
+func fixtureName(command string) string {
+	return strings.Join(strings.Fields(command), "+") + ".txt"
+}
+
+// fetchFromFile replays the output of command from dir instead of asking a
+// device (DEVICE_MODE=file), e.g. to develop the parsers against fixtures
+// captured with -dump-raw.
+func fetchFromFile(dir, command string) ([]string, error) {
+	path := filepath.Join(dir, fixtureName(command))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to replay '%s': %w", command, err)
+	}
+	return splitConsoleLines(string(data)), nil
+}
+
+// dumpRaw writes the console output of command, all pages joined, to
+// DUMP_RAW_DIR (-dump-raw) as <device>/<fixture>, so the device directory
+// replays as FIXTURE_DIR with DEVICE_MODE=file. Each fetch overwrites the
+// previous output. Failing to write is logged and does not affect the fetch.
+func dumpRaw(device, command string, output []byte) {
+	dir := filepath.Join(settings.DumpDir, device)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		logger.Error("Could not dump raw output", "device", device, "command", command, "error", err)
+		return
+	}
+	if err := os.WriteFile(filepath.Join(dir, fixtureName(command)), output, 0o644); err != nil {
+		logger.Error("Could not dump raw output", "device", device, "command", command, "error", err)
+	}
+}
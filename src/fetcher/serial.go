@@ -0,0 +1,168 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"pylontech_exporter/src/metrics"
+)
+
+var (
+	// promptPattern matches the console prompt ("pylon>", "pylon_debug>")
+	// at the end of the buffered output.
+	promptPattern = regexp.MustCompile(`pylon\w*>\s*$`)
+	pagingPrompt  = []byte("Press [Enter] to be continued")
+)
+
+// serialConsole is a console reached through its RS232 port. Commands are
+// serialised; the port stays open between commands and is reopened after
+// an error.
+type serialConsole struct {
+	mu   sync.Mutex
+	path string
+	baud int
+	port *os.File
+}
+
+var (
+	serialOnce sync.Once
+	serial     *serialConsole
+)
+
+// serialMode reports whether DEVICE_MODE=serial selects the serial console
+// instead of HTTP.
+func serialMode() bool {
+	serialOnce.Do(func() {
+		if settings.Mode != "serial" {
+			return
+		}
+		console := &serialConsole{path: settings.SerialPort, baud: settings.SerialBaud}
+		logger.Info("Using serial console", "port", console.path, "baud", console.baud)
+		serial = console
+	})
+	return serial != nil
+}
+
+// errGarbledOutput is returned for console output that does not start with
+// the echoed command, e.g. the rest of an earlier, aborted command.
+var errGarbledOutput = errors.New("console output does not start with the echoed command")
+
+func fetchFromSerial(ctx context.Context, device, command string) ([]string, error) {
+	serial.mu.Lock()
+	defer serial.mu.Unlock()
+
+	if serial.port == nil {
+		port, err := openSerialPort(serial.path, serial.baud)
+		if err != nil {
+			metrics.RecordSerialResponse(device, command, "reset")
+			return nil, fmt.Errorf("failed to open serial port %s: %w", serial.path, err)
+		}
+		serial.port = port
+	}
+
+	deadline := time.Now().Add(CommandTimeout(command))
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	// Cancelling ctx interrupts a pending read
+	port := serial.port
+	stop := context.AfterFunc(ctx, func() { port.SetDeadline(time.Now()) })
+	defer stop()
+	lines, err := serial.run(command, deadline)
+	metrics.RecordSerialResponse(device, command, serialOutcome(err))
+	if err != nil {
+		// The console may be mid-output; start from a clean port next time
+		serial.port.Close()
+		serial.port = nil
+		return nil, err
+	}
+	return lines, nil
+}
+
+// serialOutcome classifies the result of a serial command for
+// scraper_serial_responses_total: ok, timeout (no prompt before the
+// deadline), garbled (output without the echoed command) or reset (the port
+// failed and is reopened).
+func serialOutcome(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, errGarbledOutput):
+		return "garbled"
+	default:
+		return "reset"
+	}
+}
+
+// run sends command, answers paging prompts and reads until the console
+// prompt returns or the deadline passes.
+func (c *serialConsole) run(command string, deadline time.Time) ([]string, error) {
+	discardInput(c.port)
+	if err := c.port.SetDeadline(deadline); err != nil {
+		return nil, fmt.Errorf("serial port does not support timeouts: %w", err)
+	}
+
+	if _, err := c.port.WriteString(command + "\r"); err != nil {
+		return nil, fmt.Errorf("failed to write to serial port: %w", err)
+	}
+
+	var output bytes.Buffer
+	chunk := make([]byte, 512)
+	for {
+		n, err := c.port.Read(chunk)
+		if n > 0 {
+			output.Write(chunk[:n])
+			if idx := bytes.Index(output.Bytes(), pagingPrompt); idx >= 0 {
+				// Drop the paging prompt and ask for the next page
+				rest := append([]byte(nil), output.Bytes()[idx+len(pagingPrompt):]...)
+				output.Truncate(idx)
+				output.Write(rest)
+				if _, err := c.port.WriteString("\r"); err != nil {
+					return nil, fmt.Errorf("failed to write to serial port: %w", err)
+				}
+				continue
+			}
+			if promptPattern.Match(output.Bytes()) {
+				return consoleLinesFromSerial(output.String(), command)
+			}
+		}
+		if err != nil {
+			if os.IsTimeout(err) {
+				return nil, fmt.Errorf("timed out waiting for the console prompt after '%s': %w", command, err)
+			}
+			return nil, fmt.Errorf("failed to read from serial port: %w", err)
+		}
+	}
+}
+
+// consoleLinesFromSerial removes the echoed command and the prompt from the
+// raw console output.
+func consoleLinesFromSerial(raw, command string) ([]string, error) {
+	lines := splitConsoleLines(promptPattern.ReplaceAllString(raw, ""))
+	if len(lines) == 0 || !strings.HasSuffix(lines[0], command) {
+		return nil, fmt.Errorf("%w '%s'", errGarbledOutput, command)
+	}
+	return lines[1:], nil
+}
+
+// discardInput drops output left over from an earlier, aborted command.
+func discardInput(port *os.File) {
+	deadline := time.Now().Add(50 * time.Millisecond)
+	port.SetReadDeadline(deadline)
+	defer port.SetReadDeadline(time.Time{})
+	buf := make([]byte, 256)
+	for {
+		if _, err := port.Read(buf); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,111 @@
+//go:build linux
+
+package fetcher
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sys/unix"
+
+	"pylontech_exporter/src/metrics"
+)
+
+// serialPair connects the serial console to the returned end of a socket
+// pair, which plays the device.
+func serialPair(t *testing.T) *os.File {
+	t.Helper()
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_NONBLOCK, 0)
+	if err != nil {
+		t.Skipf("socketpair: %v", err)
+	}
+	port, device := os.NewFile(uintptr(fds[0]), "port"), os.NewFile(uintptr(fds[1]), "device")
+	previous := serial
+	serial = &serialConsole{path: "test", port: port}
+	t.Cleanup(func() {
+		if serial.port != nil {
+			serial.port.Close()
+		}
+		serial = previous
+		device.Close()
+	})
+	return device
+}
+
+// answer replies to the next command with reply once the command arrived.
+func answer(t *testing.T, device *os.File, reply string) {
+	t.Helper()
+	go func() {
+		buf := make([]byte, 64)
+		device.SetReadDeadline(time.Now().Add(time.Second))
+		if _, err := device.Read(buf); err != nil {
+			return
+		}
+		device.WriteString(reply)
+	}()
+}
+
+func serialResponses(t *testing.T, registry prometheus.Gatherer, outcome string) float64 {
+	t.Helper()
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather returned error: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != "devicemon_scraper_serial_responses_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "outcome" && label.GetValue() == outcome {
+					return metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+func TestFetchFromSerialRecordsOutcomes(t *testing.T) {
+	registry, err := metrics.InitMetrics()
+	if err != nil {
+		t.Fatalf("InitMetrics returned error: %v", err)
+	}
+	previous := settings
+	settings.Timeout = 200 * time.Millisecond
+	t.Cleanup(func() { settings = previous })
+
+	device := serialPair(t)
+	answer(t, device, "pwr\r\n@\r\nPower Volt\r\n1     51516\r\n$$\r\npylon>")
+	lines, err := fetchFromSerial(context.Background(), "test", "pwr")
+	if err != nil {
+		t.Fatalf("fetchFromSerial returned error: %v", err)
+	}
+	if want := []string{"@", "Power Volt", "1     51516", "$$"}; !reflect.DeepEqual(lines, want) {
+		t.Fatalf("lines = %q\nwant %q", lines, want)
+	}
+
+	// The tail of an earlier command instead of the echo
+	answer(t, device, "2     51517\r\n$$\r\npylon>")
+	if _, err := fetchFromSerial(context.Background(), "test", "pwr"); err == nil {
+		t.Fatal("fetchFromSerial accepted output without the echoed command")
+	}
+	if serial.port != nil {
+		t.Fatal("port is kept open after garbled output")
+	}
+
+	serialPair(t)
+	if _, err := fetchFromSerial(context.Background(), "test", "pwr"); err == nil {
+		t.Fatal("fetchFromSerial returned without a console prompt")
+	}
+
+	for outcome, want := range map[string]float64{"ok": 1, "garbled": 1, "timeout": 1, "reset": 0} {
+		if got := serialResponses(t, registry, outcome); got != want {
+			t.Errorf("serial_responses_total{outcome=%q} = %v, want %v", outcome, got, want)
+		}
+	}
+}
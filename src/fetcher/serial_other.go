@@ -0,0 +1,12 @@
+//go:build !linux
+
+package fetcher
+
+import (
+	"fmt"
+	"os"
+)
+
+func openSerialPort(path string, baud int) (*os.File, error) {
+	return nil, fmt.Errorf("the serial console is only supported on Linux")
+}
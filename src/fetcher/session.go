@@ -0,0 +1,60 @@
+package fetcher
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"sync"
+)
+
+// session is the HTTP client of one device. Some console web bridges hand
+// out a session cookie on the first request and answer later requests
+// without it with an empty table, so all commands of a device share one
+// client whose cookie jar survives across commands and cycles.
+type session struct {
+	mu          sync.Mutex
+	device      string
+	client      *http.Client
+	seenCookies map[string]bool
+}
+
+// deviceClient returns the session's client, creating it on first use.
+func (s *session) deviceClient() *http.Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client == nil {
+		jar, _ := cookiejar.New(nil) // Only fails for a non-nil options argument
+		s.client = &http.Client{Transport: deviceTransport(), Jar: jar}
+		s.seenCookies = map[string]bool{}
+	}
+	return s.client
+}
+
+// reset drops all session cookies, so the next request starts a new
+// session. It is called when the device rejects the session or the active
+// endpoint changes.
+func (s *session) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client != nil {
+		logger.Info("Resetting HTTP session cookies", "device", s.device)
+	}
+	s.client = nil
+}
+
+// logNewCookies logs the names (never the values) of cookies set by the
+// device for the first time in the current session.
+func (s *session) logNewCookies(resp *http.Response) {
+	cookies := resp.Cookies()
+	if len(cookies) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, cookie := range cookies {
+		if s.seenCookies[cookie.Name] {
+			continue
+		}
+		s.seenCookies[cookie.Name] = true
+		logger.Debug("Device set a session cookie", "device", s.device, "cookie", cookie.Name)
+	}
+}
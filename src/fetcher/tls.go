@@ -0,0 +1,179 @@
+package fetcher
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/youmark/pkcs8"
+)
+
+// clientCertStore holds the client certificate presented to the device (or
+// the TLS gateway in front of it). It is read on every handshake, so a
+// reload takes effect for the next connection without a restart.
+type clientCertStore struct {
+	mu       sync.RWMutex
+	certFile string
+	keyFile  string
+	cert     *tls.Certificate
+}
+
+var (
+	transportOnce sync.Once
+	transport     *http.Transport
+	clientCerts   *clientCertStore
+	deviceScheme  = "http"
+)
+
+// deviceTransport returns the transport shared by all device requests. It
+// speaks HTTPS when DEVICE_SCHEME=https, a client certificate is configured
+// via DEVICE_TLS_CERT_FILE/DEVICE_TLS_KEY_FILE or the device certificate is
+// checked against DEVICE_CA_FILE.
+func deviceTransport() *http.Transport {
+	transportOnce.Do(func() {
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+		if settings.Scheme == "https" {
+			deviceScheme = "https"
+		}
+
+		tlsConfig := &tls.Config{
+			MinVersion:         tls.VersionTLS12,
+			InsecureSkipVerify: settings.TLSInsecureSkipVerify,
+		}
+		if settings.TLSInsecureSkipVerify {
+			logger.Warn("DEVICE_TLS_INSECURE_SKIP_VERIFY is set, the device certificate is not verified")
+		}
+		if settings.CAFile != "" {
+			pool, err := loadCAPool(settings.CAFile)
+			if err != nil {
+				logger.Error("Could not load the device CA certificates", "error", err)
+			} else {
+				tlsConfig.RootCAs = pool
+			}
+		}
+		if settings.TLSCertFile != "" && settings.TLSKeyFile != "" {
+			clientCerts = &clientCertStore{certFile: settings.TLSCertFile, keyFile: settings.TLSKeyFile}
+			if err := clientCerts.load(); err != nil {
+				logger.Error("Could not load the device client certificate", "error", err)
+			}
+			tlsConfig.GetClientCertificate = clientCerts.get
+		}
+		transport.TLSClientConfig = tlsConfig
+	})
+	return transport
+}
+
+// loadCAPool reads the PEM certificates the device certificate must chain
+// to, e.g. the self-signed certificate of the dongle itself.
+func loadCAPool(caFile string) (*x509.CertPool, error) {
+	caPEM, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no PEM certificates found in %s", caFile)
+	}
+	return pool, nil
+}
+
+// ReloadTLS re-reads the client certificate files and drops idle
+// connections, so rotated certificates are used for the next request. The
+// previous certificate stays in use if the new files cannot be loaded.
+func ReloadTLS() error {
+	deviceTransport()
+	if clientCerts == nil {
+		return nil
+	}
+	if err := clientCerts.load(); err != nil {
+		return err
+	}
+	transport.CloseIdleConnections()
+	logger.Info("Reloaded the device client certificate", "file", clientCerts.certFile)
+	return nil
+}
+
+func (store *clientCertStore) load() error {
+	cert, err := loadClientCertificate(store.certFile, store.keyFile, settings.TLSKeyPassphrase)
+	if err != nil {
+		return err
+	}
+	store.mu.Lock()
+	store.cert = cert
+	store.mu.Unlock()
+	return nil
+}
+
+func (store *clientCertStore) get(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	if store.cert == nil {
+		// An empty certificate lets the server decide whether to reject us.
+		return &tls.Certificate{}, nil
+	}
+	return store.cert, nil
+}
+
+// loadClientCertificate reads a PEM certificate chain and private key. An
+// "ENCRYPTED PRIVATE KEY" (PKCS#8) block is decrypted with passphrase.
+func loadClientCertificate(certFile, keyFile, passphrase string) (*tls.Certificate, error) {
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client certificate: %w", err)
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client key: %w", err)
+	}
+
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", keyFile)
+	}
+	if block.Type == "ENCRYPTED PRIVATE KEY" {
+		if passphrase == "" {
+			return nil, fmt.Errorf("%s is encrypted but DEVICE_TLS_KEY_PASSPHRASE is not set", keyFile)
+		}
+		key, err := pkcs8.ParsePKCS8PrivateKey(block.Bytes, []byte(passphrase))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt client key: %w", err)
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode client key: %w", err)
+		}
+		keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client key pair: %w", err)
+	}
+	return &cert, nil
+}
+
+// IsTLSError reports whether err comes from the TLS handshake rather than
+// from the network or the device.
+func IsTLSError(err error) bool {
+	var (
+		alertErr  tls.AlertError
+		recordErr tls.RecordHeaderError
+		verifyErr *tls.CertificateVerificationError
+		unknownCA x509.UnknownAuthorityError
+		hostErr   x509.HostnameError
+		invalid   x509.CertificateInvalidError
+		opErr     *net.OpError
+	)
+	if errors.As(err, &alertErr) || errors.As(err, &recordErr) || errors.As(err, &verifyErr) ||
+		errors.As(err, &unknownCA) || errors.As(err, &hostErr) || errors.As(err, &invalid) {
+		return true
+	}
+	// Alerts received from the peer are wrapped as "remote error: tls: ..."
+	return errors.As(err, &opErr) && opErr.Op == "remote error"
+}
@@ -0,0 +1,849 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.5
+// 	protoc        (unknown)
+// source: pylontech.proto
+
+package pylontechpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type GetSnapshotRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetSnapshotRequest) Reset() {
+	*x = GetSnapshotRequest{}
+	mi := &file_pylontech_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetSnapshotRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetSnapshotRequest) ProtoMessage() {}
+
+func (x *GetSnapshotRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pylontech_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetSnapshotRequest.ProtoReflect.Descriptor instead.
+func (*GetSnapshotRequest) Descriptor() ([]byte, []int) {
+	return file_pylontech_proto_rawDescGZIP(), []int{0}
+}
+
+type StreamSnapshotsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamSnapshotsRequest) Reset() {
+	*x = StreamSnapshotsRequest{}
+	mi := &file_pylontech_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamSnapshotsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamSnapshotsRequest) ProtoMessage() {}
+
+func (x *StreamSnapshotsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pylontech_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamSnapshotsRequest.ProtoReflect.Descriptor instead.
+func (*StreamSnapshotsRequest) Descriptor() ([]byte, []int) {
+	return file_pylontech_proto_rawDescGZIP(), []int{1}
+}
+
+type Snapshot struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	CollectedAt   *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=collected_at,json=collectedAt,proto3" json:"collected_at,omitempty"`
+	Power         []*PowerStatus         `protobuf:"bytes,2,rep,name=power,proto3" json:"power,omitempty"`
+	Batteries     []*BatteryUnit         `protobuf:"bytes,3,rep,name=batteries,proto3" json:"batteries,omitempty"`
+	System        *SystemStatus          `protobuf:"bytes,4,opt,name=system,proto3" json:"system,omitempty"` // Unset until pwrsys was parsed
+	Summary       *Summary               `protobuf:"bytes,5,opt,name=summary,proto3" json:"summary,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Snapshot) Reset() {
+	*x = Snapshot{}
+	mi := &file_pylontech_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Snapshot) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Snapshot) ProtoMessage() {}
+
+func (x *Snapshot) ProtoReflect() protoreflect.Message {
+	mi := &file_pylontech_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Snapshot.ProtoReflect.Descriptor instead.
+func (*Snapshot) Descriptor() ([]byte, []int) {
+	return file_pylontech_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Snapshot) GetCollectedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CollectedAt
+	}
+	return nil
+}
+
+func (x *Snapshot) GetPower() []*PowerStatus {
+	if x != nil {
+		return x.Power
+	}
+	return nil
+}
+
+func (x *Snapshot) GetBatteries() []*BatteryUnit {
+	if x != nil {
+		return x.Batteries
+	}
+	return nil
+}
+
+func (x *Snapshot) GetSystem() *SystemStatus {
+	if x != nil {
+		return x.System
+	}
+	return nil
+}
+
+func (x *Snapshot) GetSummary() *Summary {
+	if x != nil {
+		return x.Summary
+	}
+	return nil
+}
+
+type PowerStatus struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Volt          int32                  `protobuf:"varint,2,opt,name=volt,proto3" json:"volt,omitempty"` // mV
+	Curr          int32                  `protobuf:"varint,3,opt,name=curr,proto3" json:"curr,omitempty"` // mA
+	Temp          int32                  `protobuf:"varint,4,opt,name=temp,proto3" json:"temp,omitempty"` // milli-degrees Celsius
+	BaseState     int32                  `protobuf:"varint,5,opt,name=base_state,json=baseState,proto3" json:"base_state,omitempty"`
+	VoltState     string                 `protobuf:"bytes,6,opt,name=volt_state,json=voltState,proto3" json:"volt_state,omitempty"`
+	CurrState     string                 `protobuf:"bytes,7,opt,name=curr_state,json=currState,proto3" json:"curr_state,omitempty"`
+	TempState     string                 `protobuf:"bytes,8,opt,name=temp_state,json=tempState,proto3" json:"temp_state,omitempty"`
+	Coulomb       int32                  `protobuf:"varint,9,opt,name=coulomb,proto3" json:"coulomb,omitempty"` // %
+	BvState       string                 `protobuf:"bytes,10,opt,name=bv_state,json=bvState,proto3" json:"bv_state,omitempty"`
+	BtState       string                 `protobuf:"bytes,11,opt,name=bt_state,json=btState,proto3" json:"bt_state,omitempty"`
+	MosTemp       string                 `protobuf:"bytes,12,opt,name=mos_temp,json=mosTemp,proto3" json:"mos_temp,omitempty"`
+	MtState       string                 `protobuf:"bytes,13,opt,name=mt_state,json=mtState,proto3" json:"mt_state,omitempty"`
+	HeaterActive  int32                  `protobuf:"varint,14,opt,name=heater_active,json=heaterActive,proto3" json:"heater_active,omitempty"`
+	HeaterCurr    int32                  `protobuf:"varint,15,opt,name=heater_curr,json=heaterCurr,proto3" json:"heater_curr,omitempty"` // mA
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PowerStatus) Reset() {
+	*x = PowerStatus{}
+	mi := &file_pylontech_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PowerStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PowerStatus) ProtoMessage() {}
+
+func (x *PowerStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_pylontech_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PowerStatus.ProtoReflect.Descriptor instead.
+func (*PowerStatus) Descriptor() ([]byte, []int) {
+	return file_pylontech_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *PowerStatus) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *PowerStatus) GetVolt() int32 {
+	if x != nil {
+		return x.Volt
+	}
+	return 0
+}
+
+func (x *PowerStatus) GetCurr() int32 {
+	if x != nil {
+		return x.Curr
+	}
+	return 0
+}
+
+func (x *PowerStatus) GetTemp() int32 {
+	if x != nil {
+		return x.Temp
+	}
+	return 0
+}
+
+func (x *PowerStatus) GetBaseState() int32 {
+	if x != nil {
+		return x.BaseState
+	}
+	return 0
+}
+
+func (x *PowerStatus) GetVoltState() string {
+	if x != nil {
+		return x.VoltState
+	}
+	return ""
+}
+
+func (x *PowerStatus) GetCurrState() string {
+	if x != nil {
+		return x.CurrState
+	}
+	return ""
+}
+
+func (x *PowerStatus) GetTempState() string {
+	if x != nil {
+		return x.TempState
+	}
+	return ""
+}
+
+func (x *PowerStatus) GetCoulomb() int32 {
+	if x != nil {
+		return x.Coulomb
+	}
+	return 0
+}
+
+func (x *PowerStatus) GetBvState() string {
+	if x != nil {
+		return x.BvState
+	}
+	return ""
+}
+
+func (x *PowerStatus) GetBtState() string {
+	if x != nil {
+		return x.BtState
+	}
+	return ""
+}
+
+func (x *PowerStatus) GetMosTemp() string {
+	if x != nil {
+		return x.MosTemp
+	}
+	return ""
+}
+
+func (x *PowerStatus) GetMtState() string {
+	if x != nil {
+		return x.MtState
+	}
+	return ""
+}
+
+func (x *PowerStatus) GetHeaterActive() int32 {
+	if x != nil {
+		return x.HeaterActive
+	}
+	return 0
+}
+
+func (x *PowerStatus) GetHeaterCurr() int32 {
+	if x != nil {
+		return x.HeaterCurr
+	}
+	return 0
+}
+
+type BatteryUnit struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Unit          string                 `protobuf:"bytes,1,opt,name=unit,proto3" json:"unit,omitempty"` // e.g. "bat1"
+	Cells         []*BatteryStatus       `protobuf:"bytes,2,rep,name=cells,proto3" json:"cells,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatteryUnit) Reset() {
+	*x = BatteryUnit{}
+	mi := &file_pylontech_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatteryUnit) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatteryUnit) ProtoMessage() {}
+
+func (x *BatteryUnit) ProtoReflect() protoreflect.Message {
+	mi := &file_pylontech_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatteryUnit.ProtoReflect.Descriptor instead.
+func (*BatteryUnit) Descriptor() ([]byte, []int) {
+	return file_pylontech_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *BatteryUnit) GetUnit() string {
+	if x != nil {
+		return x.Unit
+	}
+	return ""
+}
+
+func (x *BatteryUnit) GetCells() []*BatteryStatus {
+	if x != nil {
+		return x.Cells
+	}
+	return nil
+}
+
+type BatteryStatus struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Volt          int32                  `protobuf:"varint,2,opt,name=volt,proto3" json:"volt,omitempty"` // mV
+	Curr          int32                  `protobuf:"varint,3,opt,name=curr,proto3" json:"curr,omitempty"` // mA
+	Temp          int32                  `protobuf:"varint,4,opt,name=temp,proto3" json:"temp,omitempty"` // milli-degrees Celsius
+	BaseState     int32                  `protobuf:"varint,5,opt,name=base_state,json=baseState,proto3" json:"base_state,omitempty"`
+	VoltState     string                 `protobuf:"bytes,6,opt,name=volt_state,json=voltState,proto3" json:"volt_state,omitempty"`
+	CurrState     string                 `protobuf:"bytes,7,opt,name=curr_state,json=currState,proto3" json:"curr_state,omitempty"`
+	TempState     string                 `protobuf:"bytes,8,opt,name=temp_state,json=tempState,proto3" json:"temp_state,omitempty"`
+	Soc           int32                  `protobuf:"varint,9,opt,name=soc,proto3" json:"soc,omitempty"`          // %
+	Coulomb       int32                  `protobuf:"varint,10,opt,name=coulomb,proto3" json:"coulomb,omitempty"` // mAh
+	Bal           string                 `protobuf:"bytes,11,opt,name=bal,proto3" json:"bal,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatteryStatus) Reset() {
+	*x = BatteryStatus{}
+	mi := &file_pylontech_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatteryStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatteryStatus) ProtoMessage() {}
+
+func (x *BatteryStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_pylontech_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatteryStatus.ProtoReflect.Descriptor instead.
+func (*BatteryStatus) Descriptor() ([]byte, []int) {
+	return file_pylontech_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *BatteryStatus) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *BatteryStatus) GetVolt() int32 {
+	if x != nil {
+		return x.Volt
+	}
+	return 0
+}
+
+func (x *BatteryStatus) GetCurr() int32 {
+	if x != nil {
+		return x.Curr
+	}
+	return 0
+}
+
+func (x *BatteryStatus) GetTemp() int32 {
+	if x != nil {
+		return x.Temp
+	}
+	return 0
+}
+
+func (x *BatteryStatus) GetBaseState() int32 {
+	if x != nil {
+		return x.BaseState
+	}
+	return 0
+}
+
+func (x *BatteryStatus) GetVoltState() string {
+	if x != nil {
+		return x.VoltState
+	}
+	return ""
+}
+
+func (x *BatteryStatus) GetCurrState() string {
+	if x != nil {
+		return x.CurrState
+	}
+	return ""
+}
+
+func (x *BatteryStatus) GetTempState() string {
+	if x != nil {
+		return x.TempState
+	}
+	return ""
+}
+
+func (x *BatteryStatus) GetSoc() int32 {
+	if x != nil {
+		return x.Soc
+	}
+	return 0
+}
+
+func (x *BatteryStatus) GetCoulomb() int32 {
+	if x != nil {
+		return x.Coulomb
+	}
+	return 0
+}
+
+func (x *BatteryStatus) GetBal() string {
+	if x != nil {
+		return x.Bal
+	}
+	return ""
+}
+
+type SystemStatus struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	ChargeEnabled    int32                  `protobuf:"varint,1,opt,name=charge_enabled,json=chargeEnabled,proto3" json:"charge_enabled,omitempty"`
+	DischargeEnabled int32                  `protobuf:"varint,2,opt,name=discharge_enabled,json=dischargeEnabled,proto3" json:"discharge_enabled,omitempty"`
+	ChargeVoltLimit  int32                  `protobuf:"varint,3,opt,name=charge_volt_limit,json=chargeVoltLimit,proto3" json:"charge_volt_limit,omitempty"` // mV
+	ChargeCurrLimit  int32                  `protobuf:"varint,4,opt,name=charge_curr_limit,json=chargeCurrLimit,proto3" json:"charge_curr_limit,omitempty"` // mA
+	DsgCurrLimit     int32                  `protobuf:"varint,5,opt,name=dsg_curr_limit,json=dsgCurrLimit,proto3" json:"dsg_curr_limit,omitempty"`          // mA
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *SystemStatus) Reset() {
+	*x = SystemStatus{}
+	mi := &file_pylontech_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SystemStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SystemStatus) ProtoMessage() {}
+
+func (x *SystemStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_pylontech_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SystemStatus.ProtoReflect.Descriptor instead.
+func (*SystemStatus) Descriptor() ([]byte, []int) {
+	return file_pylontech_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *SystemStatus) GetChargeEnabled() int32 {
+	if x != nil {
+		return x.ChargeEnabled
+	}
+	return 0
+}
+
+func (x *SystemStatus) GetDischargeEnabled() int32 {
+	if x != nil {
+		return x.DischargeEnabled
+	}
+	return 0
+}
+
+func (x *SystemStatus) GetChargeVoltLimit() int32 {
+	if x != nil {
+		return x.ChargeVoltLimit
+	}
+	return 0
+}
+
+func (x *SystemStatus) GetChargeCurrLimit() int32 {
+	if x != nil {
+		return x.ChargeCurrLimit
+	}
+	return 0
+}
+
+func (x *SystemStatus) GetDsgCurrLimit() int32 {
+	if x != nil {
+		return x.DsgCurrLimit
+	}
+	return 0
+}
+
+// Summary matches GET /api/v1/summary.
+type Summary struct {
+	state                    protoimpl.MessageState `protogen:"open.v1"`
+	SocPercent               *float64               `protobuf:"fixed64,1,opt,name=soc_percent,json=socPercent,proto3,oneof" json:"soc_percent,omitempty"`
+	AvailableDischargePowerW *float64               `protobuf:"fixed64,2,opt,name=available_discharge_power_w,json=availableDischargePowerW,proto3,oneof" json:"available_discharge_power_w,omitempty"`
+	NetPowerW                float64                `protobuf:"fixed64,3,opt,name=net_power_w,json=netPowerW,proto3" json:"net_power_w,omitempty"`
+	AlarmActive              bool                   `protobuf:"varint,4,opt,name=alarm_active,json=alarmActive,proto3" json:"alarm_active,omitempty"`
+	SnapshotAgeSeconds       float64                `protobuf:"fixed64,5,opt,name=snapshot_age_seconds,json=snapshotAgeSeconds,proto3" json:"snapshot_age_seconds,omitempty"`
+	unknownFields            protoimpl.UnknownFields
+	sizeCache                protoimpl.SizeCache
+}
+
+func (x *Summary) Reset() {
+	*x = Summary{}
+	mi := &file_pylontech_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Summary) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Summary) ProtoMessage() {}
+
+func (x *Summary) ProtoReflect() protoreflect.Message {
+	mi := &file_pylontech_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Summary.ProtoReflect.Descriptor instead.
+func (*Summary) Descriptor() ([]byte, []int) {
+	return file_pylontech_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Summary) GetSocPercent() float64 {
+	if x != nil && x.SocPercent != nil {
+		return *x.SocPercent
+	}
+	return 0
+}
+
+func (x *Summary) GetAvailableDischargePowerW() float64 {
+	if x != nil && x.AvailableDischargePowerW != nil {
+		return *x.AvailableDischargePowerW
+	}
+	return 0
+}
+
+func (x *Summary) GetNetPowerW() float64 {
+	if x != nil {
+		return x.NetPowerW
+	}
+	return 0
+}
+
+func (x *Summary) GetAlarmActive() bool {
+	if x != nil {
+		return x.AlarmActive
+	}
+	return false
+}
+
+func (x *Summary) GetSnapshotAgeSeconds() float64 {
+	if x != nil {
+		return x.SnapshotAgeSeconds
+	}
+	return 0
+}
+
+var File_pylontech_proto protoreflect.FileDescriptor
+
+var file_pylontech_proto_rawDesc = string([]byte{
+	0x0a, 0x0f, 0x70, 0x79, 0x6c, 0x6f, 0x6e, 0x74, 0x65, 0x63, 0x68, 0x2e, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x12, 0x0c, 0x70, 0x79, 0x6c, 0x6f, 0x6e, 0x74, 0x65, 0x63, 0x68, 0x2e, 0x76, 0x31, 0x1a,
+	0x1f, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66,
+	0x2f, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x22, 0x14, 0x0a, 0x12, 0x47, 0x65, 0x74, 0x53, 0x6e, 0x61, 0x70, 0x73, 0x68, 0x6f, 0x74, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0x18, 0x0a, 0x16, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d,
+	0x53, 0x6e, 0x61, 0x70, 0x73, 0x68, 0x6f, 0x74, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x22, 0x98, 0x02, 0x0a, 0x08, 0x53, 0x6e, 0x61, 0x70, 0x73, 0x68, 0x6f, 0x74, 0x12, 0x3d, 0x0a,
+	0x0c, 0x63, 0x6f, 0x6c, 0x6c, 0x65, 0x63, 0x74, 0x65, 0x64, 0x5f, 0x61, 0x74, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52,
+	0x0b, 0x63, 0x6f, 0x6c, 0x6c, 0x65, 0x63, 0x74, 0x65, 0x64, 0x41, 0x74, 0x12, 0x2f, 0x0a, 0x05,
+	0x70, 0x6f, 0x77, 0x65, 0x72, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x19, 0x2e, 0x70, 0x79,
+	0x6c, 0x6f, 0x6e, 0x74, 0x65, 0x63, 0x68, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x6f, 0x77, 0x65, 0x72,
+	0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x05, 0x70, 0x6f, 0x77, 0x65, 0x72, 0x12, 0x37, 0x0a,
+	0x09, 0x62, 0x61, 0x74, 0x74, 0x65, 0x72, 0x69, 0x65, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x0b,
+	0x32, 0x19, 0x2e, 0x70, 0x79, 0x6c, 0x6f, 0x6e, 0x74, 0x65, 0x63, 0x68, 0x2e, 0x76, 0x31, 0x2e,
+	0x42, 0x61, 0x74, 0x74, 0x65, 0x72, 0x79, 0x55, 0x6e, 0x69, 0x74, 0x52, 0x09, 0x62, 0x61, 0x74,
+	0x74, 0x65, 0x72, 0x69, 0x65, 0x73, 0x12, 0x32, 0x0a, 0x06, 0x73, 0x79, 0x73, 0x74, 0x65, 0x6d,
+	0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x70, 0x79, 0x6c, 0x6f, 0x6e, 0x74, 0x65,
+	0x63, 0x68, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x79, 0x73, 0x74, 0x65, 0x6d, 0x53, 0x74, 0x61, 0x74,
+	0x75, 0x73, 0x52, 0x06, 0x73, 0x79, 0x73, 0x74, 0x65, 0x6d, 0x12, 0x2f, 0x0a, 0x07, 0x73, 0x75,
+	0x6d, 0x6d, 0x61, 0x72, 0x79, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x15, 0x2e, 0x70, 0x79,
+	0x6c, 0x6f, 0x6e, 0x74, 0x65, 0x63, 0x68, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x75, 0x6d, 0x6d, 0x61,
+	0x72, 0x79, 0x52, 0x07, 0x73, 0x75, 0x6d, 0x6d, 0x61, 0x72, 0x79, 0x22, 0xa1, 0x03, 0x0a, 0x0b,
+	0x50, 0x6f, 0x77, 0x65, 0x72, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x0e, 0x0a, 0x02, 0x69,
+	0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x05, 0x52, 0x02, 0x69, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x76,
+	0x6f, 0x6c, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x52, 0x04, 0x76, 0x6f, 0x6c, 0x74, 0x12,
+	0x12, 0x0a, 0x04, 0x63, 0x75, 0x72, 0x72, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x04, 0x63,
+	0x75, 0x72, 0x72, 0x12, 0x12, 0x0a, 0x04, 0x74, 0x65, 0x6d, 0x70, 0x18, 0x04, 0x20, 0x01, 0x28,
+	0x05, 0x52, 0x04, 0x74, 0x65, 0x6d, 0x70, 0x12, 0x1d, 0x0a, 0x0a, 0x62, 0x61, 0x73, 0x65, 0x5f,
+	0x73, 0x74, 0x61, 0x74, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x05, 0x52, 0x09, 0x62, 0x61, 0x73,
+	0x65, 0x53, 0x74, 0x61, 0x74, 0x65, 0x12, 0x1d, 0x0a, 0x0a, 0x76, 0x6f, 0x6c, 0x74, 0x5f, 0x73,
+	0x74, 0x61, 0x74, 0x65, 0x18, 0x06, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x76, 0x6f, 0x6c, 0x74,
+	0x53, 0x74, 0x61, 0x74, 0x65, 0x12, 0x1d, 0x0a, 0x0a, 0x63, 0x75, 0x72, 0x72, 0x5f, 0x73, 0x74,
+	0x61, 0x74, 0x65, 0x18, 0x07, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x63, 0x75, 0x72, 0x72, 0x53,
+	0x74, 0x61, 0x74, 0x65, 0x12, 0x1d, 0x0a, 0x0a, 0x74, 0x65, 0x6d, 0x70, 0x5f, 0x73, 0x74, 0x61,
+	0x74, 0x65, 0x18, 0x08, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x74, 0x65, 0x6d, 0x70, 0x53, 0x74,
+	0x61, 0x74, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x63, 0x6f, 0x75, 0x6c, 0x6f, 0x6d, 0x62, 0x18, 0x09,
+	0x20, 0x01, 0x28, 0x05, 0x52, 0x07, 0x63, 0x6f, 0x75, 0x6c, 0x6f, 0x6d, 0x62, 0x12, 0x19, 0x0a,
+	0x08, 0x62, 0x76, 0x5f, 0x73, 0x74, 0x61, 0x74, 0x65, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x07, 0x62, 0x76, 0x53, 0x74, 0x61, 0x74, 0x65, 0x12, 0x19, 0x0a, 0x08, 0x62, 0x74, 0x5f, 0x73,
+	0x74, 0x61, 0x74, 0x65, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x62, 0x74, 0x53, 0x74,
+	0x61, 0x74, 0x65, 0x12, 0x19, 0x0a, 0x08, 0x6d, 0x6f, 0x73, 0x5f, 0x74, 0x65, 0x6d, 0x70, 0x18,
+	0x0c, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x6d, 0x6f, 0x73, 0x54, 0x65, 0x6d, 0x70, 0x12, 0x19,
+	0x0a, 0x08, 0x6d, 0x74, 0x5f, 0x73, 0x74, 0x61, 0x74, 0x65, 0x18, 0x0d, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x07, 0x6d, 0x74, 0x53, 0x74, 0x61, 0x74, 0x65, 0x12, 0x23, 0x0a, 0x0d, 0x68, 0x65, 0x61,
+	0x74, 0x65, 0x72, 0x5f, 0x61, 0x63, 0x74, 0x69, 0x76, 0x65, 0x18, 0x0e, 0x20, 0x01, 0x28, 0x05,
+	0x52, 0x0c, 0x68, 0x65, 0x61, 0x74, 0x65, 0x72, 0x41, 0x63, 0x74, 0x69, 0x76, 0x65, 0x12, 0x1f,
+	0x0a, 0x0b, 0x68, 0x65, 0x61, 0x74, 0x65, 0x72, 0x5f, 0x63, 0x75, 0x72, 0x72, 0x18, 0x0f, 0x20,
+	0x01, 0x28, 0x05, 0x52, 0x0a, 0x68, 0x65, 0x61, 0x74, 0x65, 0x72, 0x43, 0x75, 0x72, 0x72, 0x22,
+	0x54, 0x0a, 0x0b, 0x42, 0x61, 0x74, 0x74, 0x65, 0x72, 0x79, 0x55, 0x6e, 0x69, 0x74, 0x12, 0x12,
+	0x0a, 0x04, 0x75, 0x6e, 0x69, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x75, 0x6e,
+	0x69, 0x74, 0x12, 0x31, 0x0a, 0x05, 0x63, 0x65, 0x6c, 0x6c, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28,
+	0x0b, 0x32, 0x1b, 0x2e, 0x70, 0x79, 0x6c, 0x6f, 0x6e, 0x74, 0x65, 0x63, 0x68, 0x2e, 0x76, 0x31,
+	0x2e, 0x42, 0x61, 0x74, 0x74, 0x65, 0x72, 0x79, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x05,
+	0x63, 0x65, 0x6c, 0x6c, 0x73, 0x22, 0x95, 0x02, 0x0a, 0x0d, 0x42, 0x61, 0x74, 0x74, 0x65, 0x72,
+	0x79, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x05, 0x52, 0x02, 0x69, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x76, 0x6f, 0x6c, 0x74, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x05, 0x52, 0x04, 0x76, 0x6f, 0x6c, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x63,
+	0x75, 0x72, 0x72, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x04, 0x63, 0x75, 0x72, 0x72, 0x12,
+	0x12, 0x0a, 0x04, 0x74, 0x65, 0x6d, 0x70, 0x18, 0x04, 0x20, 0x01, 0x28, 0x05, 0x52, 0x04, 0x74,
+	0x65, 0x6d, 0x70, 0x12, 0x1d, 0x0a, 0x0a, 0x62, 0x61, 0x73, 0x65, 0x5f, 0x73, 0x74, 0x61, 0x74,
+	0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x05, 0x52, 0x09, 0x62, 0x61, 0x73, 0x65, 0x53, 0x74, 0x61,
+	0x74, 0x65, 0x12, 0x1d, 0x0a, 0x0a, 0x76, 0x6f, 0x6c, 0x74, 0x5f, 0x73, 0x74, 0x61, 0x74, 0x65,
+	0x18, 0x06, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x76, 0x6f, 0x6c, 0x74, 0x53, 0x74, 0x61, 0x74,
+	0x65, 0x12, 0x1d, 0x0a, 0x0a, 0x63, 0x75, 0x72, 0x72, 0x5f, 0x73, 0x74, 0x61, 0x74, 0x65, 0x18,
+	0x07, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x63, 0x75, 0x72, 0x72, 0x53, 0x74, 0x61, 0x74, 0x65,
+	0x12, 0x1d, 0x0a, 0x0a, 0x74, 0x65, 0x6d, 0x70, 0x5f, 0x73, 0x74, 0x61, 0x74, 0x65, 0x18, 0x08,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x74, 0x65, 0x6d, 0x70, 0x53, 0x74, 0x61, 0x74, 0x65, 0x12,
+	0x10, 0x0a, 0x03, 0x73, 0x6f, 0x63, 0x18, 0x09, 0x20, 0x01, 0x28, 0x05, 0x52, 0x03, 0x73, 0x6f,
+	0x63, 0x12, 0x18, 0x0a, 0x07, 0x63, 0x6f, 0x75, 0x6c, 0x6f, 0x6d, 0x62, 0x18, 0x0a, 0x20, 0x01,
+	0x28, 0x05, 0x52, 0x07, 0x63, 0x6f, 0x75, 0x6c, 0x6f, 0x6d, 0x62, 0x12, 0x10, 0x0a, 0x03, 0x62,
+	0x61, 0x6c, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x62, 0x61, 0x6c, 0x22, 0xe0, 0x01,
+	0x0a, 0x0c, 0x53, 0x79, 0x73, 0x74, 0x65, 0x6d, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x25,
+	0x0a, 0x0e, 0x63, 0x68, 0x61, 0x72, 0x67, 0x65, 0x5f, 0x65, 0x6e, 0x61, 0x62, 0x6c, 0x65, 0x64,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0d, 0x63, 0x68, 0x61, 0x72, 0x67, 0x65, 0x45, 0x6e,
+	0x61, 0x62, 0x6c, 0x65, 0x64, 0x12, 0x2b, 0x0a, 0x11, 0x64, 0x69, 0x73, 0x63, 0x68, 0x61, 0x72,
+	0x67, 0x65, 0x5f, 0x65, 0x6e, 0x61, 0x62, 0x6c, 0x65, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x05,
+	0x52, 0x10, 0x64, 0x69, 0x73, 0x63, 0x68, 0x61, 0x72, 0x67, 0x65, 0x45, 0x6e, 0x61, 0x62, 0x6c,
+	0x65, 0x64, 0x12, 0x2a, 0x0a, 0x11, 0x63, 0x68, 0x61, 0x72, 0x67, 0x65, 0x5f, 0x76, 0x6f, 0x6c,
+	0x74, 0x5f, 0x6c, 0x69, 0x6d, 0x69, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0f, 0x63,
+	0x68, 0x61, 0x72, 0x67, 0x65, 0x56, 0x6f, 0x6c, 0x74, 0x4c, 0x69, 0x6d, 0x69, 0x74, 0x12, 0x2a,
+	0x0a, 0x11, 0x63, 0x68, 0x61, 0x72, 0x67, 0x65, 0x5f, 0x63, 0x75, 0x72, 0x72, 0x5f, 0x6c, 0x69,
+	0x6d, 0x69, 0x74, 0x18, 0x04, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0f, 0x63, 0x68, 0x61, 0x72, 0x67,
+	0x65, 0x43, 0x75, 0x72, 0x72, 0x4c, 0x69, 0x6d, 0x69, 0x74, 0x12, 0x24, 0x0a, 0x0e, 0x64, 0x73,
+	0x67, 0x5f, 0x63, 0x75, 0x72, 0x72, 0x5f, 0x6c, 0x69, 0x6d, 0x69, 0x74, 0x18, 0x05, 0x20, 0x01,
+	0x28, 0x05, 0x52, 0x0c, 0x64, 0x73, 0x67, 0x43, 0x75, 0x72, 0x72, 0x4c, 0x69, 0x6d, 0x69, 0x74,
+	0x22, 0x98, 0x02, 0x0a, 0x07, 0x53, 0x75, 0x6d, 0x6d, 0x61, 0x72, 0x79, 0x12, 0x24, 0x0a, 0x0b,
+	0x73, 0x6f, 0x63, 0x5f, 0x70, 0x65, 0x72, 0x63, 0x65, 0x6e, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x01, 0x48, 0x00, 0x52, 0x0a, 0x73, 0x6f, 0x63, 0x50, 0x65, 0x72, 0x63, 0x65, 0x6e, 0x74, 0x88,
+	0x01, 0x01, 0x12, 0x42, 0x0a, 0x1b, 0x61, 0x76, 0x61, 0x69, 0x6c, 0x61, 0x62, 0x6c, 0x65, 0x5f,
+	0x64, 0x69, 0x73, 0x63, 0x68, 0x61, 0x72, 0x67, 0x65, 0x5f, 0x70, 0x6f, 0x77, 0x65, 0x72, 0x5f,
+	0x77, 0x18, 0x02, 0x20, 0x01, 0x28, 0x01, 0x48, 0x01, 0x52, 0x18, 0x61, 0x76, 0x61, 0x69, 0x6c,
+	0x61, 0x62, 0x6c, 0x65, 0x44, 0x69, 0x73, 0x63, 0x68, 0x61, 0x72, 0x67, 0x65, 0x50, 0x6f, 0x77,
+	0x65, 0x72, 0x57, 0x88, 0x01, 0x01, 0x12, 0x1e, 0x0a, 0x0b, 0x6e, 0x65, 0x74, 0x5f, 0x70, 0x6f,
+	0x77, 0x65, 0x72, 0x5f, 0x77, 0x18, 0x03, 0x20, 0x01, 0x28, 0x01, 0x52, 0x09, 0x6e, 0x65, 0x74,
+	0x50, 0x6f, 0x77, 0x65, 0x72, 0x57, 0x12, 0x21, 0x0a, 0x0c, 0x61, 0x6c, 0x61, 0x72, 0x6d, 0x5f,
+	0x61, 0x63, 0x74, 0x69, 0x76, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0b, 0x61, 0x6c,
+	0x61, 0x72, 0x6d, 0x41, 0x63, 0x74, 0x69, 0x76, 0x65, 0x12, 0x30, 0x0a, 0x14, 0x73, 0x6e, 0x61,
+	0x70, 0x73, 0x68, 0x6f, 0x74, 0x5f, 0x61, 0x67, 0x65, 0x5f, 0x73, 0x65, 0x63, 0x6f, 0x6e, 0x64,
+	0x73, 0x18, 0x05, 0x20, 0x01, 0x28, 0x01, 0x52, 0x12, 0x73, 0x6e, 0x61, 0x70, 0x73, 0x68, 0x6f,
+	0x74, 0x41, 0x67, 0x65, 0x53, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x73, 0x42, 0x0e, 0x0a, 0x0c, 0x5f,
+	0x73, 0x6f, 0x63, 0x5f, 0x70, 0x65, 0x72, 0x63, 0x65, 0x6e, 0x74, 0x42, 0x1e, 0x0a, 0x1c, 0x5f,
+	0x61, 0x76, 0x61, 0x69, 0x6c, 0x61, 0x62, 0x6c, 0x65, 0x5f, 0x64, 0x69, 0x73, 0x63, 0x68, 0x61,
+	0x72, 0x67, 0x65, 0x5f, 0x70, 0x6f, 0x77, 0x65, 0x72, 0x5f, 0x77, 0x32, 0xa7, 0x01, 0x0a, 0x09,
+	0x54, 0x65, 0x6c, 0x65, 0x6d, 0x65, 0x74, 0x72, 0x79, 0x12, 0x47, 0x0a, 0x0b, 0x47, 0x65, 0x74,
+	0x53, 0x6e, 0x61, 0x70, 0x73, 0x68, 0x6f, 0x74, 0x12, 0x20, 0x2e, 0x70, 0x79, 0x6c, 0x6f, 0x6e,
+	0x74, 0x65, 0x63, 0x68, 0x2e, 0x76, 0x31, 0x2e, 0x47, 0x65, 0x74, 0x53, 0x6e, 0x61, 0x70, 0x73,
+	0x68, 0x6f, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x16, 0x2e, 0x70, 0x79, 0x6c,
+	0x6f, 0x6e, 0x74, 0x65, 0x63, 0x68, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x6e, 0x61, 0x70, 0x73, 0x68,
+	0x6f, 0x74, 0x12, 0x51, 0x0a, 0x0f, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x53, 0x6e, 0x61, 0x70,
+	0x73, 0x68, 0x6f, 0x74, 0x73, 0x12, 0x24, 0x2e, 0x70, 0x79, 0x6c, 0x6f, 0x6e, 0x74, 0x65, 0x63,
+	0x68, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x53, 0x6e, 0x61, 0x70, 0x73,
+	0x68, 0x6f, 0x74, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x16, 0x2e, 0x70, 0x79,
+	0x6c, 0x6f, 0x6e, 0x74, 0x65, 0x63, 0x68, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x6e, 0x61, 0x70, 0x73,
+	0x68, 0x6f, 0x74, 0x30, 0x01, 0x42, 0x38, 0x5a, 0x36, 0x70, 0x79, 0x6c, 0x6f, 0x6e, 0x74, 0x65,
+	0x63, 0x68, 0x5f, 0x65, 0x78, 0x70, 0x6f, 0x72, 0x74, 0x65, 0x72, 0x2f, 0x73, 0x72, 0x63, 0x2f,
+	0x67, 0x72, 0x70, 0x63, 0x61, 0x70, 0x69, 0x2f, 0x70, 0x79, 0x6c, 0x6f, 0x6e, 0x74, 0x65, 0x63,
+	0x68, 0x70, 0x62, 0x3b, 0x70, 0x79, 0x6c, 0x6f, 0x6e, 0x74, 0x65, 0x63, 0x68, 0x70, 0x62, 0x62,
+	0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+})
+
+var (
+	file_pylontech_proto_rawDescOnce sync.Once
+	file_pylontech_proto_rawDescData []byte
+)
+
+func file_pylontech_proto_rawDescGZIP() []byte {
+	file_pylontech_proto_rawDescOnce.Do(func() {
+		file_pylontech_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_pylontech_proto_rawDesc), len(file_pylontech_proto_rawDesc)))
+	})
+	return file_pylontech_proto_rawDescData
+}
+
+var file_pylontech_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_pylontech_proto_goTypes = []any{
+	(*GetSnapshotRequest)(nil),     // 0: pylontech.v1.GetSnapshotRequest
+	(*StreamSnapshotsRequest)(nil), // 1: pylontech.v1.StreamSnapshotsRequest
+	(*Snapshot)(nil),               // 2: pylontech.v1.Snapshot
+	(*PowerStatus)(nil),            // 3: pylontech.v1.PowerStatus
+	(*BatteryUnit)(nil),            // 4: pylontech.v1.BatteryUnit
+	(*BatteryStatus)(nil),          // 5: pylontech.v1.BatteryStatus
+	(*SystemStatus)(nil),           // 6: pylontech.v1.SystemStatus
+	(*Summary)(nil),                // 7: pylontech.v1.Summary
+	(*timestamppb.Timestamp)(nil),  // 8: google.protobuf.Timestamp
+}
+var file_pylontech_proto_depIdxs = []int32{
+	8, // 0: pylontech.v1.Snapshot.collected_at:type_name -> google.protobuf.Timestamp
+	3, // 1: pylontech.v1.Snapshot.power:type_name -> pylontech.v1.PowerStatus
+	4, // 2: pylontech.v1.Snapshot.batteries:type_name -> pylontech.v1.BatteryUnit
+	6, // 3: pylontech.v1.Snapshot.system:type_name -> pylontech.v1.SystemStatus
+	7, // 4: pylontech.v1.Snapshot.summary:type_name -> pylontech.v1.Summary
+	5, // 5: pylontech.v1.BatteryUnit.cells:type_name -> pylontech.v1.BatteryStatus
+	0, // 6: pylontech.v1.Telemetry.GetSnapshot:input_type -> pylontech.v1.GetSnapshotRequest
+	1, // 7: pylontech.v1.Telemetry.StreamSnapshots:input_type -> pylontech.v1.StreamSnapshotsRequest
+	2, // 8: pylontech.v1.Telemetry.GetSnapshot:output_type -> pylontech.v1.Snapshot
+	2, // 9: pylontech.v1.Telemetry.StreamSnapshots:output_type -> pylontech.v1.Snapshot
+	8, // [8:10] is the sub-list for method output_type
+	6, // [6:8] is the sub-list for method input_type
+	6, // [6:6] is the sub-list for extension type_name
+	6, // [6:6] is the sub-list for extension extendee
+	0, // [0:6] is the sub-list for field type_name
+}
+
+func init() { file_pylontech_proto_init() }
+func file_pylontech_proto_init() {
+	if File_pylontech_proto != nil {
+		return
+	}
+	file_pylontech_proto_msgTypes[7].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_pylontech_proto_rawDesc), len(file_pylontech_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   8,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_pylontech_proto_goTypes,
+		DependencyIndexes: file_pylontech_proto_depIdxs,
+		MessageInfos:      file_pylontech_proto_msgTypes,
+	}.Build()
+	File_pylontech_proto = out.File
+	file_pylontech_proto_goTypes = nil
+	file_pylontech_proto_depIdxs = nil
+}
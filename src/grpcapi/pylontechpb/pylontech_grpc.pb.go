@@ -0,0 +1,175 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: pylontech.proto
+
+package pylontechpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Telemetry_GetSnapshot_FullMethodName     = "/pylontech.v1.Telemetry/GetSnapshot"
+	Telemetry_StreamSnapshots_FullMethodName = "/pylontech.v1.Telemetry/StreamSnapshots"
+)
+
+// TelemetryClient is the client API for Telemetry service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Telemetry serves the exporter's latest collected device data. Fields
+// mirror the parser structs; -1 keeps meaning "not reported".
+type TelemetryClient interface {
+	// GetSnapshot returns the latest snapshot, or UNAVAILABLE while nothing
+	// has been collected yet.
+	GetSnapshot(ctx context.Context, in *GetSnapshotRequest, opts ...grpc.CallOption) (*Snapshot, error)
+	// StreamSnapshots sends one snapshot per completed collection cycle.
+	StreamSnapshots(ctx context.Context, in *StreamSnapshotsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Snapshot], error)
+}
+
+type telemetryClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTelemetryClient(cc grpc.ClientConnInterface) TelemetryClient {
+	return &telemetryClient{cc}
+}
+
+func (c *telemetryClient) GetSnapshot(ctx context.Context, in *GetSnapshotRequest, opts ...grpc.CallOption) (*Snapshot, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Snapshot)
+	err := c.cc.Invoke(ctx, Telemetry_GetSnapshot_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *telemetryClient) StreamSnapshots(ctx context.Context, in *StreamSnapshotsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Snapshot], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Telemetry_ServiceDesc.Streams[0], Telemetry_StreamSnapshots_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamSnapshotsRequest, Snapshot]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Telemetry_StreamSnapshotsClient = grpc.ServerStreamingClient[Snapshot]
+
+// TelemetryServer is the server API for Telemetry service.
+// All implementations must embed UnimplementedTelemetryServer
+// for forward compatibility.
+//
+// Telemetry serves the exporter's latest collected device data. Fields
+// mirror the parser structs; -1 keeps meaning "not reported".
+type TelemetryServer interface {
+	// GetSnapshot returns the latest snapshot, or UNAVAILABLE while nothing
+	// has been collected yet.
+	GetSnapshot(context.Context, *GetSnapshotRequest) (*Snapshot, error)
+	// StreamSnapshots sends one snapshot per completed collection cycle.
+	StreamSnapshots(*StreamSnapshotsRequest, grpc.ServerStreamingServer[Snapshot]) error
+	mustEmbedUnimplementedTelemetryServer()
+}
+
+// UnimplementedTelemetryServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedTelemetryServer struct{}
+
+func (UnimplementedTelemetryServer) GetSnapshot(context.Context, *GetSnapshotRequest) (*Snapshot, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSnapshot not implemented")
+}
+func (UnimplementedTelemetryServer) StreamSnapshots(*StreamSnapshotsRequest, grpc.ServerStreamingServer[Snapshot]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamSnapshots not implemented")
+}
+func (UnimplementedTelemetryServer) mustEmbedUnimplementedTelemetryServer() {}
+func (UnimplementedTelemetryServer) testEmbeddedByValue()                   {}
+
+// UnsafeTelemetryServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TelemetryServer will
+// result in compilation errors.
+type UnsafeTelemetryServer interface {
+	mustEmbedUnimplementedTelemetryServer()
+}
+
+func RegisterTelemetryServer(s grpc.ServiceRegistrar, srv TelemetryServer) {
+	// If the following call pancis, it indicates UnimplementedTelemetryServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Telemetry_ServiceDesc, srv)
+}
+
+func _Telemetry_GetSnapshot_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSnapshotRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TelemetryServer).GetSnapshot(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Telemetry_GetSnapshot_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TelemetryServer).GetSnapshot(ctx, req.(*GetSnapshotRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Telemetry_StreamSnapshots_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamSnapshotsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TelemetryServer).StreamSnapshots(m, &grpc.GenericServerStream[StreamSnapshotsRequest, Snapshot]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Telemetry_StreamSnapshotsServer = grpc.ServerStreamingServer[Snapshot]
+
+// Telemetry_ServiceDesc is the grpc.ServiceDesc for Telemetry service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Telemetry_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "pylontech.v1.Telemetry",
+	HandlerType: (*TelemetryServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetSnapshot",
+			Handler:    _Telemetry_GetSnapshot_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamSnapshots",
+			Handler:       _Telemetry_StreamSnapshots_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "pylontech.proto",
+}
@@ -0,0 +1,197 @@
+// Package grpcapi serves the latest snapshot over gRPC for consumers that do
+// not scrape Prometheus.
+package grpcapi
+
+//go:generate protoc -I ../../proto --go_out=pylontechpb --go_opt=paths=source_relative --go-grpc_out=pylontechpb --go-grpc_opt=paths=source_relative pylontech.proto
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"pylontech_exporter/src/api"
+	"pylontech_exporter/src/grpcapi/pylontechpb"
+	"pylontech_exporter/src/parser"
+	"pylontech_exporter/src/snapshot"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Config holds the settings of the gRPC server. TLS and a token are
+// mandatory.
+type Config struct {
+	ListenAddr string
+	CertFile   string
+	KeyFile    string
+	Token      string
+}
+
+// Serve listens on cfg.ListenAddr and serves the Telemetry service until the
+// listener fails.
+func Serve(cfg Config, store *snapshot.Store) error {
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return fmt.Errorf("a TLS certificate and key are required")
+	}
+	if cfg.Token == "" {
+		return fmt.Errorf("a token is required")
+	}
+
+	creds, err := credentials.NewServerTLSFromFile(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	listener, err := net.Listen("tcp", cfg.ListenAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", cfg.ListenAddr, err)
+	}
+	return newServer(store, cfg.Token, grpc.Creds(creds)).Serve(listener)
+}
+
+func newServer(store *snapshot.Store, token string, opts ...grpc.ServerOption) *grpc.Server {
+	auth := tokenAuth(token)
+	opts = append(opts,
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if err := auth(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := auth(ss.Context()); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	)
+
+	server := grpc.NewServer(opts...)
+	pylontechpb.RegisterTelemetryServer(server, &telemetryServer{store: store})
+	return server
+}
+
+// tokenAuth accepts requests carrying "authorization: Bearer <token>".
+func tokenAuth(token string) func(context.Context) error {
+	expected := []byte("Bearer " + token)
+	return func(ctx context.Context) error {
+		md, _ := metadata.FromIncomingContext(ctx)
+		for _, value := range md.Get("authorization") {
+			if subtle.ConstantTimeCompare([]byte(strings.TrimSpace(value)), expected) == 1 {
+				return nil
+			}
+		}
+		return status.Error(codes.Unauthenticated, "missing or invalid token")
+	}
+}
+
+type telemetryServer struct {
+	pylontechpb.UnimplementedTelemetryServer
+	store *snapshot.Store
+}
+
+func (s *telemetryServer) GetSnapshot(context.Context, *pylontechpb.GetSnapshotRequest) (*pylontechpb.Snapshot, error) {
+	latest, ok := s.store.Latest()
+	if !ok {
+		return nil, status.Error(codes.Unavailable, "no data collected yet")
+	}
+	return toProto(latest, time.Now()), nil
+}
+
+func (s *telemetryServer) StreamSnapshots(_ *pylontechpb.StreamSnapshotsRequest, stream grpc.ServerStreamingServer[pylontechpb.Snapshot]) error {
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-s.store.CycleDone():
+		}
+
+		latest, ok := s.store.Latest()
+		if !ok {
+			continue
+		}
+		if err := stream.Send(toProto(latest, time.Now())); err != nil {
+			return err
+		}
+	}
+}
+
+func toProto(latest snapshot.Snapshot, now time.Time) *pylontechpb.Snapshot {
+	msg := &pylontechpb.Snapshot{CollectedAt: timestamppb.New(latest.CollectedAt)}
+
+	for _, p := range latest.Power {
+		msg.Power = append(msg.Power, &pylontechpb.PowerStatus{
+			Id:           int32(p.ID),
+			Volt:         int32(p.Volt),
+			Curr:         int32(p.Curr),
+			Temp:         int32(p.Temp),
+			BaseState:    int32(p.BaseState),
+			VoltState:    p.VoltState,
+			CurrState:    p.CurrState,
+			TempState:    p.TempState,
+			Coulomb:      int32(p.Coulomb),
+			BvState:      p.BVState,
+			BtState:      p.BTState,
+			MosTemp:      p.MosTemp,
+			MtState:      p.MTState,
+			HeaterActive: int32(p.HeaterActive),
+			HeaterCurr:   int32(p.HeaterCurr),
+		})
+	}
+
+	units := make([]string, 0, len(latest.Batteries))
+	for unit := range latest.Batteries {
+		units = append(units, unit)
+	}
+	sort.Strings(units)
+	for _, unit := range units {
+		msg.Batteries = append(msg.Batteries, &pylontechpb.BatteryUnit{Unit: unit, Cells: batteriesToProto(latest.Batteries[unit])})
+	}
+
+	if latest.System != nil {
+		msg.System = &pylontechpb.SystemStatus{
+			ChargeEnabled:    int32(latest.System.ChargeEnabled),
+			DischargeEnabled: int32(latest.System.DischargeEnabled),
+			ChargeVoltLimit:  int32(latest.System.ChargeVoltLimit),
+			ChargeCurrLimit:  int32(latest.System.ChargeCurrLimit),
+			DsgCurrLimit:     int32(latest.System.DsgCurrLimit),
+		}
+	}
+
+	summary := api.BuildSummary(latest, now)
+	msg.Summary = &pylontechpb.Summary{
+		SocPercent:               summary.SOCPercent,
+		AvailableDischargePowerW: summary.AvailableDischargePowerW,
+		NetPowerW:                summary.NetPowerW,
+		AlarmActive:              summary.AlarmActive,
+		SnapshotAgeSeconds:       summary.SnapshotAgeSeconds,
+	}
+	return msg
+}
+
+func batteriesToProto(batteries []parser.BatteryStatus) []*pylontechpb.BatteryStatus {
+	cells := make([]*pylontechpb.BatteryStatus, 0, len(batteries))
+	for _, b := range batteries {
+		cells = append(cells, &pylontechpb.BatteryStatus{
+			Id:        int32(b.ID),
+			Volt:      int32(b.Volt),
+			Curr:      int32(b.Curr),
+			Temp:      int32(b.Temp),
+			BaseState: int32(b.BaseState),
+			VoltState: b.VoltState,
+			CurrState: b.CurrState,
+			TempState: b.TempState,
+			Soc:       int32(b.SOC),
+			Coulomb:   int32(b.Coulomb),
+			Bal:       b.BAL,
+		})
+	}
+	return cells
+}
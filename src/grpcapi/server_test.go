@@ -0,0 +1,96 @@
+package grpcapi
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"pylontech_exporter/src/grpcapi/pylontechpb"
+	"pylontech_exporter/src/parser"
+	"pylontech_exporter/src/snapshot"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newTestClient(t *testing.T, store *snapshot.Store) pylontechpb.TelemetryClient {
+	t.Helper()
+
+	listener := bufconn.Listen(1 << 20)
+	server := newServer(store, "secret")
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("NewClient returned error: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pylontechpb.NewTelemetryClient(conn)
+}
+
+func TestGetSnapshotRequiresToken(t *testing.T) {
+	store := snapshot.NewStore()
+	store.SetPower([]parser.PowerStatus{{ID: 1, Volt: 50000, Curr: -2000, Coulomb: 80}})
+	client := newTestClient(t, store)
+
+	_, err := client.GetSnapshot(context.Background(), &pylontechpb.GetSnapshotRequest{})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("GetSnapshot without token: got %v, want Unauthenticated", err)
+	}
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer secret")
+	got, err := client.GetSnapshot(ctx, &pylontechpb.GetSnapshotRequest{})
+	if err != nil {
+		t.Fatalf("GetSnapshot returned error: %v", err)
+	}
+	if len(got.Power) != 1 || got.Power[0].Volt != 50000 {
+		t.Fatalf("Power = %v, want one module at 50000 mV", got.Power)
+	}
+	if got.Summary.GetNetPowerW() != -100 || got.Summary.GetSocPercent() != 80 {
+		t.Fatalf("Summary = %v, want net_power_w -100 and soc_percent 80", got.Summary)
+	}
+}
+
+func TestStreamSnapshotsSendsPerCycle(t *testing.T) {
+	store := snapshot.NewStore()
+	client := newTestClient(t, store)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer secret")
+	stream, err := client.StreamSnapshots(ctx, &pylontechpb.StreamSnapshotsRequest{})
+	if err != nil {
+		t.Fatalf("StreamSnapshots returned error: %v", err)
+	}
+
+	// The stream starts waiting only after the handler runs, so keep completing cycles until one is received.
+	received := make(chan *pylontechpb.Snapshot, 1)
+	go func() {
+		if msg, err := stream.Recv(); err == nil {
+			received <- msg
+		}
+	}()
+	store.SetPower([]parser.PowerStatus{{ID: 3, Volt: 51000}})
+	for {
+		store.CompleteCycle()
+		select {
+		case msg := <-received:
+			if len(msg.Power) != 1 || msg.Power[0].Id != 3 {
+				t.Fatalf("Power = %v, want module 3", msg.Power)
+			}
+			return
+		case <-ctx.Done():
+			t.Fatal("no snapshot received after completed cycles")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Package influx pushes the latest snapshot of each device to InfluxDB 2.x,
+// or anything else accepting its /api/v2/write endpoint such as
+// VictoriaMetrics, in line protocol.
+package influx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"pylontech_exporter/src/parser"
+	"pylontech_exporter/src/snapshot"
+)
+
+// writeTimeout bounds each write attempt.
+const writeTimeout = 10 * time.Second
+
+// Config holds the server settings. Only URL is required; InfluxDB also
+// needs Token, Org and Bucket.
+type Config struct {
+	URL    string // e.g. http://192.168.1.5:8086
+	Token  string
+	Org    string
+	Bucket string
+}
+
+// Device is a stack whose snapshots are written.
+type Device struct {
+	Name  string
+	Store *snapshot.Store
+}
+
+// writer sends the points of every device after each collection cycle. It
+// runs beside the collection loop, which never waits for the server.
+type writer struct {
+	endpoint string
+	token    string
+	client   *http.Client
+}
+
+// Start writes the snapshot of each device after every completed collection
+// cycle, all points of a cycle in one gzip-compressed request.
+func Start(cfg Config, devices []Device) error {
+	w, err := newWriter(cfg)
+	if err != nil {
+		return err
+	}
+	for _, device := range devices {
+		go w.run(device)
+	}
+	return nil
+}
+
+func newWriter(cfg Config) (*writer, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid INFLUX_URL '%s', expected e.g. http://host:8086", cfg.URL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/api/v2/write"
+	query := url.Values{"precision": {"ns"}}
+	if cfg.Org != "" {
+		query.Set("org", cfg.Org)
+	}
+	if cfg.Bucket != "" {
+		query.Set("bucket", cfg.Bucket)
+	}
+	u.RawQuery = query.Encode()
+	return &writer{endpoint: u.String(), token: cfg.Token, client: &http.Client{Timeout: writeTimeout}}, nil
+}
+
+func (w *writer) run(device Device) {
+	for {
+		<-device.Store.CycleDone()
+		latest, ok := device.Store.Latest()
+		if !ok || latest.Stale {
+			continue
+		}
+		body := points(device.Name, latest)
+		if len(body) == 0 {
+			continue
+		}
+		if err := w.write(context.Background(), body); err != nil {
+			slog.Warn("InfluxDB write failed", "device", device.Name, "error", err)
+		}
+	}
+}
+
+// write sends the line protocol in body, retrying once when the server
+// answers with a 5xx status.
+func (w *writer) write(ctx context.Context, body []byte) error {
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write(body)
+	zw.Close()
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		var retry bool
+		retry, err = w.post(ctx, compressed.Bytes())
+		if !retry {
+			return err
+		}
+	}
+	return err
+}
+
+// post sends one write request and reports whether it is worth retrying.
+func (w *writer) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	req.Header.Set("Content-Encoding", "gzip")
+	if w.token != "" {
+		req.Header.Set("Authorization", "Token "+w.token)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		io.Copy(io.Discard, resp.Body)
+		return false, nil
+	}
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return resp.StatusCode >= 500, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(message)))
+}
+
+// points renders the power rows and battery cells of a snapshot in line
+// protocol, timestamped with the collection time.
+func points(device string, s snapshot.Snapshot) []byte {
+	var b bytes.Buffer
+	ts := strconv.FormatInt(s.CollectedAt.UnixNano(), 10)
+	for _, status := range s.Power {
+		b.WriteString("pylontech_power,device=" + escapeTag(device) + ",unit=bat" + strconv.Itoa(status.ID))
+		b.WriteString(" volt=" + strconv.Itoa(status.Volt) + "i")
+		b.WriteString(",curr=" + strconv.Itoa(status.Curr) + "i")
+		b.WriteString(",temp=" + strconv.Itoa(status.Temp) + "i")
+		if status.Coulomb >= 0 {
+			b.WriteString(",soc=" + strconv.Itoa(status.Coulomb) + "i")
+		}
+		b.WriteString(",base_state=" + quoteField(parser.BaseStateName(status.BaseState)))
+		b.WriteString(" " + ts + "\n")
+	}
+	for _, status := range s.Power {
+		unit := "bat" + strconv.Itoa(status.ID)
+		for _, cell := range s.Batteries[unit] {
+			b.WriteString("pylontech_battery,device=" + escapeTag(device) + ",unit=" + unit + ",id=" + strconv.Itoa(cell.ID))
+			b.WriteString(" volt=" + strconv.Itoa(cell.Volt) + "i")
+			b.WriteString(",curr=" + strconv.Itoa(cell.Curr) + "i")
+			b.WriteString(",temp=" + strconv.Itoa(cell.Temp) + "i")
+			if cell.SOC >= 0 {
+				b.WriteString(",soc=" + strconv.Itoa(cell.SOC) + "i")
+			}
+			if cell.Coulomb >= 0 {
+				b.WriteString(",coulomb=" + strconv.Itoa(cell.Coulomb) + "i")
+			}
+			b.WriteString(",base_state=" + quoteField(parser.BaseStateName(cell.BaseState)))
+			b.WriteString(" " + ts + "\n")
+		}
+	}
+	return b.Bytes()
+}
+
+var tagEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+func escapeTag(value string) string {
+	return tagEscaper.Replace(value)
+}
+
+var fieldEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`)
+
+func quoteField(value string) string {
+	return `"` + fieldEscaper.Replace(value) + `"`
+}
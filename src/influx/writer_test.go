@@ -0,0 +1,91 @@
+package influx
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"pylontech_exporter/src/parser"
+	"pylontech_exporter/src/snapshot"
+)
+
+var testSnapshot = snapshot.Snapshot{
+	CollectedAt: time.Unix(1700000000, 0),
+	Power: []parser.PowerStatus{
+		{ID: 1, Volt: 49512, Curr: -1250, Temp: 23000, BaseState: 1, Coulomb: 87},
+	},
+	Batteries: map[string][]parser.BatteryStatus{
+		"bat1": {
+			{ID: 3, Volt: 3312, Curr: -1520, Temp: 21000, BaseState: 1, SOC: 87, Coulomb: 3450},
+			{ID: 4, Volt: 3310, Curr: -1520, Temp: 21000, BaseState: 1, SOC: -1, Coulomb: -1},
+		},
+	},
+}
+
+func TestPoints(t *testing.T) {
+	got := string(points("garage 1", testSnapshot))
+	want := `pylontech_power,device=garage\ 1,unit=bat1 volt=49512i,curr=-1250i,temp=23000i,soc=87i,base_state="Dischg" 1700000000000000000
+pylontech_battery,device=garage\ 1,unit=bat1,id=3 volt=3312i,curr=-1520i,temp=21000i,soc=87i,coulomb=3450i,base_state="Dischg" 1700000000000000000
+pylontech_battery,device=garage\ 1,unit=bat1,id=4 volt=3310i,curr=-1520i,temp=21000i,base_state="Dischg" 1700000000000000000
+`
+	if got != want {
+		t.Fatalf("points =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestWriteRetriesOnceOnServerError(t *testing.T) {
+	var requests []string
+	status := http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Errorf("body is not gzip-compressed: %v", err)
+			return
+		}
+		body, _ := io.ReadAll(zr)
+		requests = append(requests, r.URL.Path+"?"+r.URL.RawQuery+" "+r.Header.Get("Authorization")+" "+string(body))
+		w.WriteHeader(status)
+		status = http.StatusNoContent
+	}))
+	defer server.Close()
+
+	w, err := newWriter(Config{URL: server.URL, Token: "secret", Org: "home", Bucket: "battery"})
+	if err != nil {
+		t.Fatalf("newWriter returned error: %v", err)
+	}
+	if err := w.write(context.Background(), []byte("m v=1i 1\n")); err != nil {
+		t.Fatalf("write returned error: %v", err)
+	}
+	want := "/api/v2/write?bucket=battery&org=home&precision=ns Token secret m v=1i 1\n"
+	if len(requests) != 2 || requests[0] != want || requests[1] != want {
+		t.Fatalf("requests = %q, want the same write twice: %q", requests, want)
+	}
+}
+
+func TestWriteDoesNotRetryClientErrors(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Error(w, `{"message":"bucket not found"}`, http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	w, _ := newWriter(Config{URL: server.URL})
+	err := w.write(context.Background(), []byte("m v=1i 1\n"))
+	if err == nil || !strings.Contains(err.Error(), "bucket not found") || requests != 1 {
+		t.Fatalf("write error %v after %d requests, want one failed request", err, requests)
+	}
+}
+
+func TestNewWriterRejectsInvalidURL(t *testing.T) {
+	for _, raw := range []string{"192.168.1.5:8086", "udp://host:8089", "http://"} {
+		if _, err := newWriter(Config{URL: raw}); err == nil {
+			t.Errorf("newWriter accepted %q", raw)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"pylontech_exporter/src/parser"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// cellAggregates summarises the cells of one unit. Cells whose voltage or
+// SOC was not reported are left out of the figures derived from it instead
+// of pulling the minimum or average down to zero.
+type cellAggregates struct {
+	voltCount                 int
+	voltMin, voltMax, voltSum int
+	tempCount                 int
+	tempMin, tempMax          int
+	currCount, currSum        int
+	powerCount                int
+	powerSum                  float64 // W
+	socCount, socSum          int
+}
+
+// cellPower is the power of a cell in W, negative while discharging.
+func cellPower(status parser.BatteryStatus) float64 {
+	return float64(status.Volt) * float64(status.Curr) / 1e6
+}
+
+func aggregateCells(statuses []parser.BatteryStatus) cellAggregates {
+	var agg cellAggregates
+	for _, status := range statuses {
+		if status.Volt > 0 {
+			if agg.voltCount == 0 || status.Volt < agg.voltMin {
+				agg.voltMin = status.Volt
+			}
+			if agg.voltCount == 0 || status.Volt > agg.voltMax {
+				agg.voltMax = status.Volt
+			}
+			agg.voltSum += status.Volt
+			agg.voltCount++
+			agg.powerSum += cellPower(status)
+			agg.powerCount++
+		}
+		if status.SOC >= 0 {
+			agg.socSum += status.SOC
+			agg.socCount++
+		}
+
+		// Currents and temperatures may legitimately be zero or negative;
+		// rows where either failed to parse are already dropped by the parser.
+		agg.currSum += status.Curr
+		agg.currCount++
+		if agg.tempCount == 0 || status.Temp < agg.tempMin {
+			agg.tempMin = status.Temp
+		}
+		if agg.tempCount == 0 || status.Temp > agg.tempMax {
+			agg.tempMax = status.Temp
+		}
+		agg.tempCount++
+	}
+	return agg
+}
+
+// ObserveCellVoltages adds every reported cell voltage of a unit to the cell
+// voltage histogram. It is called once per collected bat output, so the
+// histogram counts samples of the device rather than Prometheus scrapes.
+func ObserveCellVoltages(device, unitLabel string, statuses []parser.BatteryStatus) {
+	for _, status := range statuses {
+		if status.Volt > 0 {
+			observeHistogram(batteryCellVoltHistogram, float64(status.Volt)/1000, device, unitLabel)
+		}
+	}
+}
+
+func cellAggregateVecs() []*prometheus.GaugeVec {
+	return []*prometheus.GaugeVec{
+		batteryCellVoltMin, batteryCellVoltMax, batteryCellVoltAvg, batteryCellVoltDelta,
+		batteryCellTempMin, batteryCellTempMax, batteryCellTempDelta,
+		batteryUnitPower, batteryUnitCurr, batteryUnitSOCAvg, batteryUnitCharging, batteryUnitDischarging,
+	}
+}
+
+// UpdateCellAggregates exports the min/max/avg/delta cell voltage and the
+// min/max/delta cell temperature of a unit from its complete bat output, so
+// a weak cell shows up as a single per-unit delta. It also exports the unit
+// power, current and average SOC and whether the unit charges or discharges.
+func UpdateCellAggregates(device, unitLabel string, statuses []parser.BatteryStatus) {
+	agg := aggregateCells(statuses)
+
+	if agg.voltCount > 0 {
+		setGauge(batteryCellVoltMin, float64(agg.voltMin), device, unitLabel)
+		setGauge(batteryCellVoltMax, float64(agg.voltMax), device, unitLabel)
+		setGauge(batteryCellVoltAvg, float64(agg.voltSum)/float64(agg.voltCount), device, unitLabel)
+		setGauge(batteryCellVoltDelta, float64(agg.voltMax-agg.voltMin), device, unitLabel)
+	} else {
+		deleteSeries([]*prometheus.GaugeVec{batteryCellVoltMin, batteryCellVoltMax, batteryCellVoltAvg, batteryCellVoltDelta}, device, unitLabel)
+	}
+
+	if agg.tempCount > 0 {
+		setGauge(batteryCellTempMin, milliToCelsius(agg.tempMin), device, unitLabel)
+		setGauge(batteryCellTempMax, milliToCelsius(agg.tempMax), device, unitLabel)
+		setGauge(batteryCellTempDelta, milliToCelsius(agg.tempMax-agg.tempMin), device, unitLabel)
+	} else {
+		deleteSeries([]*prometheus.GaugeVec{batteryCellTempMin, batteryCellTempMax, batteryCellTempDelta}, device, unitLabel)
+	}
+
+	if agg.powerCount > 0 {
+		setGauge(batteryUnitPower, agg.powerSum, device, unitLabel)
+	} else {
+		deleteSeries([]*prometheus.GaugeVec{batteryUnitPower}, device, unitLabel)
+	}
+	if agg.socCount > 0 {
+		setGauge(batteryUnitSOCAvg, float64(agg.socSum)/float64(agg.socCount), device, unitLabel)
+	} else {
+		deleteSeries([]*prometheus.GaugeVec{batteryUnitSOCAvg}, device, unitLabel)
+	}
+	if agg.currCount > 0 {
+		curr := float64(agg.currSum) / float64(agg.currCount)
+		charging, discharging := 0.0, 0.0
+		if curr > 0 {
+			charging = 1
+		} else if curr < 0 {
+			discharging = 1
+		}
+		setGauge(batteryUnitCurr, curr, device, unitLabel)
+		setGauge(batteryUnitCharging, charging, device, unitLabel)
+		setGauge(batteryUnitDischarging, discharging, device, unitLabel)
+	} else {
+		deleteSeries([]*prometheus.GaugeVec{batteryUnitCurr, batteryUnitCharging, batteryUnitDischarging}, device, unitLabel)
+	}
+}
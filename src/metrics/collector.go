@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector runs a collection cycle on every scrape and then exports the
+// metric families updated by it, so scrapes never see data older than the
+// scrape itself and the device is only queried while someone is scraping.
+type Collector struct {
+	collect  func(context.Context) error
+	timeout  time.Duration
+	families collectorList
+	// busy is held while a cycle runs, also past a scrape's timeout, so
+	// concurrent scrapes never query the console at the same time.
+	busy         chan struct{}
+	durationDesc *prometheus.Desc
+	upDesc       *prometheus.Desc
+}
+
+// collectorList collects the metric families registered through the
+// metricRegistrar in collector mode instead of adding them to the registry.
+type collectorList []prometheus.Collector
+
+func (l *collectorList) Register(c prometheus.Collector) error {
+	*l = append(*l, c)
+	return nil
+}
+
+func (l *collectorList) MustRegister(cs ...prometheus.Collector) {
+	*l = append(*l, cs...)
+}
+
+func (l *collectorList) Unregister(prometheus.Collector) bool {
+	return false
+}
+
+// InitCollector initializes all metrics like InitMetrics, but registers a
+// Collector that calls collect on every scrape, bounded by timeout. collect
+// returns an error when the device could not be read, which is exported as
+// <namespace>_up 0.
+func InitCollector(collect func(context.Context) error, timeout time.Duration) (*prometheus.Registry, error) {
+	namespace := settings.Namespace
+	collector := &Collector{
+		collect: collect,
+		timeout: timeout,
+		busy:    make(chan struct{}, 1),
+		durationDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "scrape_duration_seconds"),
+			"Duration of the collection cycle run for this scrape.",
+			nil, nil,
+		),
+		upDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "up"),
+			"1 if the device could be read during this scrape, 0 otherwise.",
+			nil, nil,
+		),
+	}
+
+	reg := prometheus.NewRegistry()
+	if err := initMetrics(reg, &collector.families); err != nil {
+		return nil, err
+	}
+	if err := reg.Register(collector); err != nil {
+		return nil, err
+	}
+	return reg, nil
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, family := range c.families {
+		family.Describe(ch)
+	}
+	ch <- c.durationDesc
+	ch <- c.upDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	var err error
+	select {
+	case c.busy <- struct{}{}:
+		done := make(chan error, 1)
+		go func() {
+			defer func() { <-c.busy }()
+			done <- c.collect(ctx)
+		}()
+		select {
+		case err = <-done:
+		case <-ctx.Done():
+			err = fmt.Errorf("collection did not finish within %s", c.timeout)
+		}
+	case <-ctx.Done():
+		err = fmt.Errorf("previous collection still running after %s", c.timeout)
+	}
+
+	up := 1.0
+	if err != nil {
+		logger.Error("Scrape collection failed", "error", err)
+		up = 0
+	}
+
+	for _, family := range c.families {
+		family.Collect(ch)
+	}
+	ch <- prometheus.MustNewConstMetric(c.durationDesc, prometheus.GaugeValue, time.Since(start).Seconds())
+	ch <- prometheus.MustNewConstMetric(c.upDesc, prometheus.GaugeValue, up)
+}
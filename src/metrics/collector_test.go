@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCollectorRunsCycleOnScrape(t *testing.T) {
+	cycles := 0
+	var cycleErr error
+	registry, err := InitCollector(func(context.Context) error {
+		cycles++
+		UpdateModuleCounts("default", cycles, 0, 0)
+		return cycleErr
+	}, time.Second)
+	if err != nil {
+		t.Fatalf("InitCollector returned error: %v", err)
+	}
+
+	if got := gaugeValue(t, registry, "devicemon_system_modules_present"); got != 1 {
+		t.Fatalf("modules_present = %v, want 1 from the first scrape's cycle", got)
+	}
+	if got := gaugeValue(t, registry, "devicemon_up"); got != 1 {
+		t.Fatalf("up = %v, want 1", got)
+	}
+
+	cycleErr = errors.New("pwr failed")
+	if got := gaugeValue(t, registry, "devicemon_up"); got != 0 {
+		t.Fatalf("up = %v, want 0 after a failed cycle", got)
+	}
+	if cycles != 3 {
+		t.Fatalf("cycles = %d, want one per scrape", cycles)
+	}
+}
+
+func TestCollectorTimesOutAndSerialisesCycles(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	registry, err := InitCollector(func(context.Context) error {
+		<-release
+		return nil
+	}, 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("InitCollector returned error: %v", err)
+	}
+
+	// The first cycle times out and keeps running; the second scrape must not start another one.
+	for i := 0; i < 2; i++ {
+		if got := gaugeValue(t, registry, "devicemon_up"); got != 0 {
+			t.Fatalf("scrape %d: up = %v, want 0 while the cycle hangs", i, got)
+		}
+	}
+}
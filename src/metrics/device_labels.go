@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// deviceModels holds the model and firmware major version of each device,
+// derived from its info output. They are added to the series of the device
+// at gather time, so every device keeps one constant value per label without
+// changing the label set of the families.
+var deviceModels = struct {
+	sync.RWMutex
+	labels map[string][]*dto.LabelPair // device -> model and firmware_major
+}{labels: map[string][]*dto.LabelPair{}}
+
+// SetDeviceModel sets the model and firmware_major labels of the battery and
+// power series of a device. Empty values leave the label out.
+func SetDeviceModel(device, model, firmwareMajor string) {
+	var labels []*dto.LabelPair
+	for _, pair := range [][2]string{{"model", model}, {"firmware_major", firmwareMajor}} {
+		if pair[1] != "" {
+			labels = append(labels, &dto.LabelPair{Name: &pair[0], Value: &pair[1]})
+		}
+	}
+	deviceModels.Lock()
+	defer deviceModels.Unlock()
+	deviceModels.labels[device] = labels
+}
+
+// resetDeviceModel forgets the model and firmware major version of a device.
+func resetDeviceModel(device string) {
+	deviceModels.Lock()
+	defer deviceModels.Unlock()
+	delete(deviceModels.labels, device)
+}
+
+// WithDeviceLabels returns a Gatherer that adds the labels set by
+// SetDeviceModel to the battery and power series gathered from g.
+func WithDeviceLabels(g prometheus.Gatherer) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := g.Gather()
+		deviceModels.RLock()
+		defer deviceModels.RUnlock()
+		if len(deviceModels.labels) == 0 {
+			return families, err
+		}
+		for _, family := range families {
+			name := strings.TrimPrefix(family.GetName(), settings.Namespace+"_")
+			if !strings.HasPrefix(name, "battery_") && !strings.HasPrefix(name, "power_") {
+				continue
+			}
+			for _, metric := range family.GetMetric() {
+				addDeviceLabels(metric)
+			}
+		}
+		return families, err
+	})
+}
+
+func addDeviceLabels(metric *dto.Metric) {
+	var extra []*dto.LabelPair
+	for _, label := range metric.GetLabel() {
+		if label.GetName() == "device" {
+			extra = deviceModels.labels[label.GetValue()]
+			break
+		}
+	}
+	if len(extra) == 0 {
+		return
+	}
+	metric.Label = append(metric.Label, extra...)
+	sort.Slice(metric.Label, func(i, j int) bool { return metric.Label[i].GetName() < metric.Label[j].GetName() })
+}
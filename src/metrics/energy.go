@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"pylontech_exporter/src/parser"
+)
+
+var (
+	stackEnergyMu sync.Mutex
+	stackEnergy   = map[string]*energyIntegrator{}
+)
+
+// energyIntegrator integrates stack power into charged and discharged
+// watt-hours. Each interval is integrated with the trapezoidal rule; the
+// half of each sample is booked by the sign of its current.
+type energyIntegrator struct {
+	lastPower  float64
+	lastSample time.Time
+}
+
+// sample feeds one power reading in W and returns the charged and discharged
+// energy in Wh since the previous reading.
+func (e *energyIntegrator) sample(now time.Time, power float64, maxGap time.Duration) (charged, discharged float64) {
+	if dt := now.Sub(e.lastSample); !e.lastSample.IsZero() && dt > 0 && dt <= maxGap {
+		for _, p := range []float64{e.lastPower, power} {
+			wh := p / 2 * dt.Hours()
+			if wh > 0 {
+				charged += wh
+			} else {
+				discharged -= wh
+			}
+		}
+	}
+	e.lastPower = power
+	e.lastSample = now
+	return charged, discharged
+}
+
+// UpdateStackPower exports the parsed power output and adds the energy since
+// the previous sample to the charged and discharged counters.
+func UpdateStackPower(device string, now time.Time, status parser.StackPower) {
+	setGauge(stackVolt, float64(status.Volt), device)
+	setGauge(stackCurr, float64(status.Curr), device)
+	setGauge(stackPower, status.Power, device)
+
+	power := math.Copysign(math.Abs(status.Power), float64(status.Curr)) // The current decides the direction
+	stackEnergyMu.Lock()
+	integrator, ok := stackEnergy[device]
+	if !ok {
+		integrator = &energyIntegrator{}
+		stackEnergy[device] = integrator
+	}
+	charged, discharged := integrator.sample(now, power, currentSampleMaxGap())
+	stackEnergyMu.Unlock()
+
+	// Adding 0 on the first sample creates the series, so increase() covers
+	// the first interval.
+	addCounter(stackEnergyCharged, charged, device)
+	addCounter(stackEnergyDischarged, discharged, device)
+}
+
+// PauseStackEnergy skips the integration of the current interval, e.g.
+// because the power output of a cycle could not be read. Integration
+// resumes with the second sample after the pause.
+func PauseStackEnergy(device string) {
+	stackEnergyMu.Lock()
+	defer stackEnergyMu.Unlock()
+	delete(stackEnergy, device)
+}
+
+// resetStackEnergy forgets all integration state.
+func resetStackEnergy() {
+	stackEnergyMu.Lock()
+	defer stackEnergyMu.Unlock()
+	stackEnergy = map[string]*energyIntegrator{}
+}
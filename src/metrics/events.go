@@ -0,0 +1,173 @@
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"pylontech_exporter/src/parser"
+)
+
+// eventMark is the high-water mark of the event log of one device: the time
+// of the newest counted entry and the keys of all entries of that second, so
+// entries logged within the same second are still counted once each when
+// they show up in different reads.
+type eventMark struct {
+	Time time.Time `json:"time"`
+	Keys []string  `json:"keys"`
+}
+
+// events holds the marks by device. The log always prints its full history,
+// so only entries past the mark are counted. With a state file the marks
+// survive a restart; without one the first read of each device only sets the
+// mark, since the history cannot be told apart from new entries.
+var events = struct {
+	sync.Mutex
+	path  string
+	marks map[string]eventMark
+}{marks: map[string]eventMark{}}
+
+// LoadEventState sets the file the marks are saved in after each change and
+// reads the marks saved by a previous run. A missing file is not an error;
+// an empty path keeps the marks in memory only. After an error the marks
+// start out empty and the file is overwritten with the next change.
+func LoadEventState(path string) error {
+	events.Lock()
+	defer events.Unlock()
+	events.path = path
+	events.marks = map[string]eventMark{}
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	marks := map[string]eventMark{}
+	if err := json.Unmarshal(data, &marks); err != nil {
+		return err
+	}
+	events.marks = marks
+	return nil
+}
+
+// UpdateEvents counts the entries of a 'log' output that are newer than the
+// mark of the device and exports the time of the newest entry of each unit
+// and event type. Entries dated before the mark, e.g. after the device clock
+// was set back, are not counted. The returned error is one of saving the
+// state file; the metrics are updated regardless.
+func UpdateEvents(device string, entries []parser.Event) error {
+	sorted := append([]parser.Event(nil), entries...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Time.Before(sorted[j].Time) })
+
+	events.Lock()
+	defer events.Unlock()
+
+	mark, known := events.marks[device]
+	seen := map[string]bool{}
+	for _, key := range mark.Keys {
+		seen[key] = true
+	}
+	next := eventMark{Time: mark.Time, Keys: append([]string(nil), mark.Keys...)}
+	changed := !known
+	for _, entry := range sorted {
+		unit, eventType := eventLabels(entry)
+		key := unit + "|" + eventType
+		switch {
+		case entry.Time.After(next.Time):
+			next = eventMark{Time: entry.Time}
+			seen = map[string]bool{}
+		case entry.Time.Before(next.Time):
+			continue
+		case seen[key]:
+			continue
+		}
+		seen[key] = true
+		next.Keys = append(next.Keys, key)
+		changed = true
+		if known {
+			incCounter(batteryEvents, device, unit, eventType)
+		} else {
+			addCounter(batteryEvents, 0, device, unit, eventType)
+		}
+	}
+
+	newest := map[[2]string]time.Time{}
+	for _, entry := range sorted {
+		unit, eventType := eventLabels(entry)
+		newest[[2]string{unit, eventType}] = entry.Time
+	}
+	for labels, at := range newest {
+		setGauge(batteryLastEvent, float64(at.Unix()), device, labels[0], labels[1])
+	}
+
+	if !changed {
+		return nil
+	}
+	events.marks[device] = next
+	return saveEventState()
+}
+
+// saveEventState writes the marks to the state file, if one is set, through
+// a temporary file so a crash never leaves a truncated file behind. The
+// caller holds the lock.
+func saveEventState() error {
+	if events.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(events.marks)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(events.path), filepath.Base(events.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // Fails harmlessly once renamed
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), events.path)
+}
+
+// eventLabels returns the unit and type labels of an entry. The type is
+// lower-cased with every run of other characters than letters and digits
+// replaced by an underscore, e.g. "Cell OV" becomes cell_ov.
+func eventLabels(entry parser.Event) (unit, eventType string) {
+	unit = "stack"
+	if entry.Module > 0 {
+		unit = "bat" + strconv.Itoa(entry.Module)
+	}
+	var b strings.Builder
+	pending := false
+	for _, r := range strings.ToLower(entry.Type) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if pending && b.Len() > 0 {
+				b.WriteByte('_')
+			}
+			pending = false
+			b.WriteRune(r)
+		} else {
+			pending = true
+		}
+	}
+	if b.Len() == 0 {
+		return unit, "unknown"
+	}
+	return unit, b.String()
+}
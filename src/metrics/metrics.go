@@ -1,19 +1,31 @@
 package metrics
 
 import (
-	"log"
-	"os"
+	"log/slog"
 	"strconv"
 	"strings"
+	"time"
 
+	"pylontech_exporter/src/config"
 	"pylontech_exporter/src/parser"
+	"pylontech_exporter/src/version"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 )
 
 var (
 	// General metric for tracking errors
 	scrapeErrors *prometheus.CounterVec
+	// Device HTTP responses by command and status code
+	deviceHTTPResponses *prometheus.CounterVec
+	fetchRetries        *prometheus.CounterVec
+	serialResponses     *prometheus.CounterVec
+	fetchTimeout        *prometheus.GaugeVec
+
+	deviceIdentityMismatch *prometheus.GaugeVec
+	deviceActiveEndpoint   *prometheus.GaugeVec
+	metricEnabled          *prometheus.GaugeVec
 
 	// Battery Metrics
 	batteryVolt               *prometheus.GaugeVec
@@ -23,12 +35,70 @@ var (
 	batterySOC                *prometheus.GaugeVec
 	batteryCoulomb            *prometheus.GaugeVec
 	batteryBalanceActiveCount *prometheus.GaugeVec
+	batterySOCEstimated       *prometheus.GaugeVec
+	batterySOCDrift           *prometheus.GaugeVec
+	batteryCellVoltMin        *prometheus.GaugeVec
+	batteryCellVoltMax        *prometheus.GaugeVec
+	batteryCellVoltAvg        *prometheus.GaugeVec
+	batteryCellVoltDelta      *prometheus.GaugeVec
+	batteryCellTempMin        *prometheus.GaugeVec
+	batteryCellTempMax        *prometheus.GaugeVec
+	batteryCellTempDelta      *prometheus.GaugeVec
+	batteryCellVoltHistogram  *prometheus.HistogramVec
+	batteryPower              *prometheus.GaugeVec
+	batteryUnitPower          *prometheus.GaugeVec
+	batteryUnitCurr           *prometheus.GaugeVec
+	batteryUnitSOCAvg         *prometheus.GaugeVec
+	batteryUnitCharging       *prometheus.GaugeVec
+	batteryUnitDischarging    *prometheus.GaugeVec
+	batteryHeaterActive       *prometheus.GaugeVec
+	batteryHeaterCurr         *prometheus.GaugeVec
 	batteryStatCycles         *prometheus.GaugeVec
 	batteryStatSOH            *prometheus.GaugeVec
 	batteryStatDsgCap         *prometheus.GaugeVec
 	batteryStatChgCurrSec     *prometheus.GaugeVec
 	batteryStatDsgCurrSec     *prometheus.GaugeVec
 	batteryStatSocSec         *prometheus.GaugeVec
+	batterySOHPercent         *prometheus.GaugeVec
+	batteryCycleCount         *prometheus.GaugeVec
+	batteryEvents             *prometheus.CounterVec
+	batteryLastEvent          *prometheus.GaugeVec
+	batteryVoltState          *prometheus.GaugeVec
+	batteryCurrState          *prometheus.GaugeVec
+	batteryTempState          *prometheus.GaugeVec
+	batteryAlarmTransitions   *prometheus.CounterVec
+
+	// System Metrics
+	systemChargeEnabled    *prometheus.GaugeVec
+	systemDischargeEnabled *prometheus.GaugeVec
+	systemChgVoltLimit     *prometheus.GaugeVec
+	systemChgCurrLimit     *prometheus.GaugeVec
+	systemDsgCurrLimit     *prometheus.GaugeVec
+	systemModulesExpected  *prometheus.GaugeVec
+	systemModulesPresent   *prometheus.GaugeVec
+	systemModulesMissing   *prometheus.GaugeVec
+	batteryUnitIgnored     *prometheus.GaugeVec
+	batteryPresent         *prometheus.GaugeVec
+	powerPresent           *prometheus.GaugeVec
+	batteryInfo            *prometheus.GaugeVec
+	batterySpecCapacity    *prometheus.GaugeVec
+	batteryUnitDisabled    *prometheus.GaugeVec
+	batteryUnitFailStreak  *prometheus.GaugeVec
+	batteryUnitBackoff     *prometheus.GaugeVec
+	commandUp              *prometheus.GaugeVec
+	commandLastSuccess     *prometheus.GaugeVec
+	commandDuration        *prometheus.GaugeVec
+	unitLastSuccess        *prometheus.GaugeVec
+	commandSupported       *prometheus.GaugeVec
+	unitTopologyAge        *prometheus.GaugeVec
+	unitTopologySource     *prometheus.GaugeVec
+
+	// Stack Metrics
+	stackVolt             *prometheus.GaugeVec
+	stackCurr             *prometheus.GaugeVec
+	stackPower            *prometheus.GaugeVec
+	stackEnergyCharged    *prometheus.CounterVec
+	stackEnergyDischarged *prometheus.CounterVec
 
 	// Power Supply Metrics
 	powerVolt      *prometheus.GaugeVec
@@ -37,256 +107,995 @@ var (
 	powerBaseState *prometheus.GaugeVec
 	powerSOC       *prometheus.GaugeVec
 	powerMosTemp   *prometheus.GaugeVec
+	powerVoltState *prometheus.GaugeVec
+	powerCurrState *prometheus.GaugeVec
+	powerTempState *prometheus.GaugeVec
+	powerBVState   *prometheus.GaugeVec
+	powerBTState   *prometheus.GaugeVec
+	powerMTState   *prometheus.GaugeVec
+	// Alarm transitions of pwr rows
+	powerAlarmTransitions *prometheus.CounterVec
 )
 
-func getNamespace() string {
-	ns := os.Getenv("PROM_NAMESPACE")
-	if ns == "" {
-		ns = "devicemon" // fallback if not set
-	}
-	return ns
+// settings is the metrics configuration, see Configure.
+var settings = config.Default().Metrics
+
+// Configure sets the namespace, the disabled metric families and the
+// units. It takes effect with the next InitMetrics or InitCollector call.
+func Configure(cfg config.Metrics) {
+	settings = cfg
+}
+
+// logger receives the few problems found while exporting; see SetLogger.
+var logger = slog.Default()
+
+// SetLogger sets the logger of the metrics package.
+func SetLogger(l *slog.Logger) {
+	logger = l
+}
+
+// milliToCelsius converts a signed milli-degree reading to degrees Celsius.
+func milliToCelsius(milli int) float64 {
+	return float64(milli) / 1000.0
 }
 
 // InitMetrics initializes all Prometheus metrics and returns a custom registry.
-func InitMetrics() *prometheus.Registry {
-	namespace := getNamespace()
+// Metric families listed in DISABLE_METRICS are not registered; an unknown
+// name in that list is returned as an error.
+func InitMetrics() (*prometheus.Registry, error) {
 	reg := prometheus.NewRegistry() // Create a new custom registry
+	if err := initMetrics(reg, reg); err != nil {
+		return nil, err
+	}
+	return reg, nil
+}
 
-	scrapeErrors = prometheus.NewCounterVec(
+// initMetrics creates the metric families and registers them with families;
+// exporter_metric_enabled always goes straight into reg.
+func initMetrics(reg *prometheus.Registry, families prometheus.Registerer) error {
+	namespace := settings.Namespace
+	registrar := newMetricRegistrar(families, namespace, settings.Disabled)
+	resetPresence()
+	resetStates()
+	resetStackEnergy()
+
+	scrapeErrors = registrar.counterVec(
 		prometheus.CounterOpts{
 			Namespace: namespace,
 			Subsystem: "scraper",
 			Name:      "errors_total",
 			Help:      "Total number of errors encountered during data scraping or parsing.",
 		},
-		[]string{"type"}, // e.g., "bat_fetch", "pwr_parse"
+		[]string{"device", "type"}, // e.g., "bat_fetch", "pwr_parse"
+	)
+
+	deviceHTTPResponses = registrar.counterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "scraper",
+			Name:      "device_http_responses_total",
+			Help:      "Total number of HTTP responses received from the device console endpoint, by command and status code.",
+		},
+		[]string{"device", "command", "code"}, // e.g., "bat", "200"
+	)
+
+	fetchRetries = registrar.counterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "scraper",
+			Name:      "retries_total",
+			Help:      "Total number of console requests that were retried after a failed attempt, by command.",
+		},
+		[]string{"device", "command"},
+	)
+
+	serialResponses = registrar.counterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "scraper",
+			Name:      "serial_responses_total",
+			Help:      "Total number of console commands sent over the serial port, by command and outcome (ok, timeout, garbled or reset).",
+		},
+		[]string{"device", "command", "outcome"},
+	)
+
+	fetchTimeout = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "fetch_timeout_seconds",
+			Help:      "Effective timeout of a single console request attempt, by command (FETCH_TIMEOUT or its FETCH_TIMEOUT_<COMMAND> override).",
+		},
+		[]string{"command"},
+	)
+
+	deviceIdentityMismatch = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "device",
+			Name:      "identity_mismatch",
+			Help:      "1 if the connected device's barcode does not match EXPECTED_DEVICE_SERIAL, 0 if it matches. Only exported when configured.",
+		},
+		[]string{"device"},
+	)
+
+	deviceActiveEndpoint = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "device",
+			Name:      "active_endpoint",
+			Help:      "1 for the device endpoint currently used for console commands, 0 for configured standby endpoints.",
+		},
+		[]string{"device", "endpoint"},
+	)
+
+	commandUp = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "scraper",
+			Name:      "command_up",
+			Help:      "1 if the last fetch and parse of the console command succeeded, 0 otherwise.",
+		},
+		[]string{"device", "command"},
+	)
+
+	commandSupported = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "scraper",
+			Name:      "command_supported",
+			Help:      "0 for auxiliary console commands the firmware rejected as unknown; they are not fetched again until restart.",
+		},
+		[]string{"device", "command"},
+	)
+
+	commandLastSuccess = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "scraper",
+			Name:      "command_last_success_timestamp_seconds",
+			Help:      "Unix time of the last successful run of a console command (bat: all units succeeded).",
+		},
+		[]string{"device", "command"},
+	)
+
+	commandDuration = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "scraper",
+			Name:      "command_duration_seconds",
+			Help:      "Duration of the last run of a console command including parsing; for per-unit commands the run over all units.",
+		},
+		[]string{"device", "command"},
+	)
+
+	unitLastSuccess = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "scraper",
+			Name:      "unit_last_success_timestamp_seconds",
+			Help:      "Unix time of the last successful fetch and parse of a per-unit console command (bat, stat, soh, info) for a unit.",
+		},
+		[]string{"device", "command", "unit"},
+	)
+
+	unitTopologyAge = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "scraper",
+			Name:      "unit_topology_age_seconds",
+			Help:      "Seconds since the unit count used for bat collection was last confirmed by pwr.",
+		},
+		[]string{"device"},
+	)
+
+	unitTopologySource = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "scraper",
+			Name:      "unit_topology_source",
+			Help:      "1 for the source of the unit count used in the last cycle: pwr (fresh), cache (pwr failed or shrink not yet confirmed) or none.",
+		},
+		[]string{"device", "source"},
 	)
-	reg.MustRegister(scrapeErrors)
 
 	// --- Battery Metrics Initialization ---
-	batteryVolt = prometheus.NewGaugeVec(
+	batteryVolt = registrar.gaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
 			Subsystem: "battery",
 			Name:      "volt",
 			Help:      "Battery voltage in millivolts.",
 		},
-		[]string{"unit", "id"},
+		[]string{"device", "unit", "id"},
 	)
-	reg.MustRegister(batteryVolt)
 
-	batteryCurr = prometheus.NewGaugeVec(
+	batteryCurr = registrar.gaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
 			Subsystem: "battery",
 			Name:      "curr",
 			Help:      "Battery current in milliamps.",
 		},
-		[]string{"unit", "id"},
+		[]string{"device", "unit", "id"},
 	)
-	reg.MustRegister(batteryCurr)
 
-	batteryTemp = prometheus.NewGaugeVec(
+	batteryTemp = registrar.gaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
 			Subsystem: "battery",
 			Name:      "temp_celsius",
-			Help:      "Battery temperature in degrees Celsius. Assumes input is milli-degrees C (e.g., 17000 -> 17.0 C).",
+			Help:      "Battery temperature in degrees Celsius, normalized from the device profile's reporting unit (may be negative).",
 		},
-		[]string{"unit", "id"},
+		[]string{"device", "unit", "id"},
 	)
-	reg.MustRegister(batteryTemp)
 
-	batteryBaseState = prometheus.NewGaugeVec(
+	batteryBaseState = registrar.gaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
 			Subsystem: "battery",
 			Name:      "base_state",
 			Help:      "Battery base state code (0: Charge, 1: Dischg, 2: Idle, 3: Balance, -1: Unknown).",
 		},
-		[]string{"unit", "id"},
+		[]string{"device", "unit", "id"},
 	)
-	reg.MustRegister(batteryBaseState)
 
-	batterySOC = prometheus.NewGaugeVec(
+	batteryVoltState = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "battery",
+			Name:      "volt_state",
+			Help:      "Cell voltage state from 'bat' (e.g. Normal, Low, High, OverVolt, UnderVolt): 1 for the current state, 0 for other states seen before.",
+		},
+		[]string{"device", "unit", "id", "state"},
+	)
+
+	batteryCurrState = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "battery",
+			Name:      "curr_state",
+			Help:      "Cell current state from 'bat': 1 for the current state, 0 for other states seen before.",
+		},
+		[]string{"device", "unit", "id", "state"},
+	)
+
+	batteryTempState = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "battery",
+			Name:      "temp_state",
+			Help:      "Cell temperature state from 'bat': 1 for the current state, 0 for other states seen before.",
+		},
+		[]string{"device", "unit", "id", "state"},
+	)
+
+	batteryAlarmTransitions = registrar.counterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "battery",
+			Name:      "alarm_transitions_total",
+			Help:      "Number of times a cell state field of 'bat' left Normal.",
+		},
+		[]string{"device", "unit", "id", "field"}, // field: volt, curr, temp
+	)
+
+	batterySOC = registrar.gaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
 			Subsystem: "battery",
 			Name:      "soc",
 			Help:      "Battery State of Charge in percent.",
 		},
-		[]string{"unit", "id"},
+		[]string{"device", "unit", "id"},
 	)
-	reg.MustRegister(batterySOC)
 
-	batteryCoulomb = prometheus.NewGaugeVec(
+	batteryCoulomb = registrar.gaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
 			Subsystem: "battery",
 			Name:      "coulomb",
 			Help:      "Battery remaining capacity in milliampere-hours.",
 		},
-		[]string{"unit", "id"},
+		[]string{"device", "unit", "id"},
 	)
-	reg.MustRegister(batteryCoulomb)
 
-	batteryBalanceActiveCount = prometheus.NewGaugeVec(
+	batteryBalanceActiveCount = registrar.gaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
 			Subsystem: "battery",
 			Name:      "bal_active_count",
 			Help:      "Number of active balancing channels. If BAL is 'N' or similar, this will be 0.",
 		},
-		[]string{"unit", "id"},
+		[]string{"device", "unit", "id"},
 	)
-	reg.MustRegister(batteryBalanceActiveCount)
 
-	batteryStatCycles = prometheus.NewGaugeVec(
+	batterySOCEstimated = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "battery",
+			Name:      "soc_estimated_percent",
+			Help:      "State of Charge estimated by integrating module current, re-anchored whenever the BMS reports 100%.",
+		},
+		[]string{"device", "unit"},
+	)
+
+	batterySOCDrift = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "battery",
+			Name:      "soc_drift_percent",
+			Help:      "Estimated minus BMS-reported State of Charge in percentage points.",
+		},
+		[]string{"device", "unit"},
+	)
+
+	batteryCellVoltMin = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "battery",
+			Name:      "cell_volt_min",
+			Help:      "Lowest cell voltage of the unit in millivolts.",
+		},
+		[]string{"device", "unit"},
+	)
+
+	batteryCellVoltMax = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "battery",
+			Name:      "cell_volt_max",
+			Help:      "Highest cell voltage of the unit in millivolts.",
+		},
+		[]string{"device", "unit"},
+	)
+
+	batteryCellVoltAvg = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "battery",
+			Name:      "cell_volt_avg",
+			Help:      "Average cell voltage of the unit in millivolts.",
+		},
+		[]string{"device", "unit"},
+	)
+
+	batteryCellVoltDelta = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "battery",
+			Name:      "cell_volt_delta",
+			Help:      "Difference between the highest and lowest cell voltage of the unit in millivolts.",
+		},
+		[]string{"device", "unit"},
+	)
+
+	batteryCellTempMin = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "battery",
+			Name:      "cell_temp_min_celsius",
+			Help:      "Lowest cell temperature of the unit in degrees Celsius.",
+		},
+		[]string{"device", "unit"},
+	)
+
+	batteryCellTempMax = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "battery",
+			Name:      "cell_temp_max_celsius",
+			Help:      "Highest cell temperature of the unit in degrees Celsius.",
+		},
+		[]string{"device", "unit"},
+	)
+
+	batteryCellTempDelta = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "battery",
+			Name:      "cell_temp_delta_celsius",
+			Help:      "Difference between the highest and lowest cell temperature of the unit in degrees Celsius.",
+		},
+		[]string{"device", "unit"},
+	)
+
+	batteryCellVoltHistogram = registrar.histogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "battery",
+			Name:      "cell_volt_distribution",
+			Help:      "Cell voltages of the unit in volts, observed once per collected bat output (buckets from CELL_VOLT_BUCKETS).",
+			Buckets:   settings.CellVoltBuckets,
+		},
+		[]string{"device", "unit"},
+	)
+
+	batteryPower = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "battery",
+			Name:      "power_watts",
+			Help:      "Power of the cell in watts, voltage times current; negative while discharging.",
+		},
+		[]string{"device", "unit", "id"},
+	)
+
+	batteryUnitPower = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "battery",
+			Name:      "unit_power_watts",
+			Help:      "Sum of the cell power of the unit in watts; cells without a voltage reading are left out.",
+		},
+		[]string{"device", "unit"},
+	)
+
+	batteryUnitCurr = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "battery",
+			Name:      "unit_curr_milliamps",
+			Help:      "Average cell current of the unit in milliamps. The cells are in series, so this is the module current.",
+		},
+		[]string{"device", "unit"},
+	)
+
+	batteryUnitSOCAvg = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "battery",
+			Name:      "unit_soc_avg",
+			Help:      "Average state of charge of the cells of the unit in percent; cells without a SOC reading are left out.",
+		},
+		[]string{"device", "unit"},
+	)
+
+	batteryUnitCharging = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "battery",
+			Name:      "unit_charging",
+			Help:      "Whether the unit current is positive (1) or not (0).",
+		},
+		[]string{"device", "unit"},
+	)
+
+	batteryUnitDischarging = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "battery",
+			Name:      "unit_discharging",
+			Help:      "Whether the unit current is negative (1) or not (0).",
+		},
+		[]string{"device", "unit"},
+	)
+
+	batteryHeaterActive = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "battery",
+			Name:      "heater_active",
+			Help:      "Whether the module's internal heater is currently heating (1) or not (0). Only exported on heater models.",
+		},
+		[]string{"device", "unit"},
+	)
+
+	batteryHeaterCurr = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "battery",
+			Name:      "heater_current_ma",
+			Help:      "Current drawn by the module's internal heater in milliamps. Only exported when the firmware reports it.",
+		},
+		[]string{"device", "unit"},
+	)
+
+	batterySOHPercent = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "battery",
+			Name:      "soh_percent",
+			Help:      "Battery module state of health in percent from soh output.",
+		},
+		[]string{"device", "unit"},
+	)
+
+	batteryCycleCount = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "battery",
+			Name:      "cycle_count",
+			Help:      "Battery module charge cycle count from soh output.",
+		},
+		[]string{"device", "unit"},
+	)
+
+	batteryStatCycles = registrar.gaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
 			Subsystem: "battery_stat",
 			Name:      "cycles",
 			Help:      "Battery cycle count from stat output.",
 		},
-		[]string{"unit"},
+		[]string{"device", "unit"},
 	)
-	reg.MustRegister(batteryStatCycles)
 
-	batteryStatSOH = prometheus.NewGaugeVec(
+	batteryStatSOH = registrar.gaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
 			Subsystem: "battery_stat",
 			Name:      "soh_percent",
 			Help:      "Battery state of health in percent from stat output.",
 		},
-		[]string{"unit"},
+		[]string{"device", "unit"},
 	)
-	reg.MustRegister(batteryStatSOH)
 
-	batteryStatDsgCap = prometheus.NewGaugeVec(
+	batteryStatDsgCap = registrar.gaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
 			Subsystem: "battery_stat",
 			Name:      "dsg_cap",
 			Help:      "Cumulative discharge capacity from stat output, in the device's reported units.",
 		},
-		[]string{"unit"},
+		[]string{"device", "unit"},
 	)
-	reg.MustRegister(batteryStatDsgCap)
 
-	batteryStatChgCurrSec = prometheus.NewGaugeVec(
+	batteryStatChgCurrSec = registrar.gaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
 			Subsystem: "battery_stat",
 			Name:      "chg_curr_secs",
 			Help:      "Charge current seconds by current range from stat output.",
 		},
-		[]string{"unit", "current_range"},
+		[]string{"device", "unit", "current_range"},
 	)
-	reg.MustRegister(batteryStatChgCurrSec)
 
-	batteryStatDsgCurrSec = prometheus.NewGaugeVec(
+	batteryStatDsgCurrSec = registrar.gaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
 			Subsystem: "battery_stat",
 			Name:      "dsg_curr_secs",
 			Help:      "Discharge current seconds by current range from stat output.",
 		},
-		[]string{"unit", "current_range"},
+		[]string{"device", "unit", "current_range"},
 	)
-	reg.MustRegister(batteryStatDsgCurrSec)
 
-	batteryStatSocSec = prometheus.NewGaugeVec(
+	batteryStatSocSec = registrar.gaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
 			Subsystem: "battery_stat",
 			Name:      "soc_secs",
 			Help:      "SOC seconds by SOC range (0-20, 20-60, gt60) from stat output.",
 		},
-		[]string{"unit", "soc_range"},
+		[]string{"device", "unit", "soc_range"},
+	)
+
+	batteryEvents = registrar.counterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "battery",
+			Name:      "events_total",
+			Help:      "Entries of the 'log' event log by event type, counting only entries added while the exporter was watching.",
+		},
+		[]string{"device", "unit", "type"}, // unit: batN, or stack for events without module
+	)
+
+	batteryLastEvent = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "battery",
+			Name:      "last_event_timestamp_seconds",
+			Help:      "Unix time of the newest 'log' entry by event type, read from the device clock in the exporter's time zone.",
+		},
+		[]string{"device", "unit", "type"},
+	)
+
+	// --- System Metrics Initialization ---
+	systemChargeEnabled = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "system",
+			Name:      "charge_enabled",
+			Help:      "Whether the BMS currently allows charging (1) or not (0), from pwrsys output.",
+		},
+		[]string{"device"},
+	)
+
+	systemDischargeEnabled = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "system",
+			Name:      "discharge_enabled",
+			Help:      "Whether the BMS currently allows discharging (1) or not (0), from pwrsys output.",
+		},
+		[]string{"device"},
+	)
+
+	systemChgVoltLimit = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "system",
+			Name:      "charge_voltage_limit_mv",
+			Help:      "Charge voltage requested by the BMS in millivolts, from pwrsys output.",
+		},
+		[]string{"device"},
+	)
+
+	systemChgCurrLimit = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "system",
+			Name:      "charge_current_limit_ma",
+			Help:      "Charge current limit advertised by the BMS in milliamps, from pwrsys output.",
+		},
+		[]string{"device"},
+	)
+
+	systemDsgCurrLimit = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "system",
+			Name:      "discharge_current_limit_ma",
+			Help:      "Discharge current limit advertised by the BMS in milliamps (magnitude), from pwrsys output.",
+		},
+		[]string{"device"},
+	)
+
+	// --- Stack Metrics Initialization ---
+	stackVolt = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "stack",
+			Name:      "volt_millivolts",
+			Help:      "Stack voltage in millivolts, from power output.",
+		},
+		[]string{"device"},
+	)
+
+	stackCurr = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "stack",
+			Name:      "curr_milliamps",
+			Help:      "Stack current in milliamps, from power output. Positive while charging.",
+		},
+		[]string{"device"},
+	)
+
+	stackPower = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "stack",
+			Name:      "power_watts",
+			Help:      "Stack power in watts, from power output; calculated from voltage and current if not reported.",
+		},
+		[]string{"device"},
+	)
+
+	stackEnergyCharged = registrar.counterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "stack",
+			Name:      "energy_charged_watthours_total",
+			Help:      "Energy charged into the stack in watt-hours, integrated from the stack power between samples.",
+		},
+		[]string{"device"},
+	)
+
+	stackEnergyDischarged = registrar.counterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "stack",
+			Name:      "energy_discharged_watthours_total",
+			Help:      "Energy discharged from the stack in watt-hours, integrated from the stack power between samples.",
+		},
+		[]string{"device"},
+	)
+
+	systemModulesExpected = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "system",
+			Name:      "modules_expected",
+			Help:      "Number of modules configured via EXPECTED_MODULES. Only exported when configured.",
+		},
+		[]string{"device"},
+	)
+
+	systemModulesPresent = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "system",
+			Name:      "modules_present",
+			Help:      "Number of modules with a parsed, non-Absent row in the pwr output.",
+		},
+		[]string{"device"},
+	)
+
+	batteryInfo = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "battery",
+			Name:      "info",
+			Help:      "Always 1; module identity from the 'info' command as labels.",
+		},
+		[]string{"device", "unit", "serial", "firmware", "board_version", "device_name"},
+	)
+
+	batterySpecCapacity = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "battery",
+			Name:      "specific_capacity_mah",
+			Help:      "Nominal module capacity in mAh from the 'info' specification.",
+		},
+		[]string{"device", "unit"},
+	)
+
+	batteryPresent = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "battery",
+			Name:      "present",
+			Help:      "1 if the cell was in the last bat output of its unit, 0 if it was reported before but is missing now.",
+		},
+		[]string{"device", "unit", "id"},
+	)
+
+	powerPresent = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "power",
+			Name:      "present",
+			Help:      "1 if the module was in the last pwr output, 0 if it was reported before but is missing or Absent now.",
+		},
+		[]string{"device", "id"},
+	)
+
+	batteryUnitIgnored = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "battery",
+			Name:      "unit_ignored",
+			Help:      "1 for units excluded from collection via IGNORE_UNITS.",
+		},
+		[]string{"device", "unit"},
+	)
+
+	batteryUnitDisabled = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "battery",
+			Name:      "unit_disabled",
+			Help:      "1 while a unit is backed off from after repeated bat failures, 0 otherwise.",
+		},
+		[]string{"device", "unit"},
+	)
+
+	batteryUnitFailStreak = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "battery",
+			Name:      "unit_failure_streak",
+			Help:      "Number of consecutive failed bat fetches or parses of a unit.",
+		},
+		[]string{"device", "unit"},
+	)
+
+	batteryUnitBackoff = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "battery",
+			Name:      "unit_backoff_seconds",
+			Help:      "Time a failing unit is skipped for before its next probe, doubling with every failed probe up to UNIT_COOLDOWN; 0 while the unit is fetched every cycle.",
+		},
+		[]string{"device", "unit"},
+	)
+
+	systemModulesMissing = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "system",
+			Name:      "modules_missing",
+			Help:      "Number of expected modules not present in the pwr output. Only exported when EXPECTED_MODULES is set.",
+		},
+		[]string{"device"},
 	)
-	reg.MustRegister(batteryStatSocSec)
 
 	// --- Power Supply Metrics Initialization ---
-	powerVolt = prometheus.NewGaugeVec(
+	powerVolt = registrar.gaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
 			Subsystem: "power",
 			Name:      "volt",
 			Help:      "Power supply voltage in millivolts.",
 		},
-		[]string{"id"},
+		[]string{"device", "id"},
 	)
-	reg.MustRegister(powerVolt)
 
-	powerCurr = prometheus.NewGaugeVec(
+	powerCurr = registrar.gaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
 			Subsystem: "power",
 			Name:      "curr",
 			Help:      "Power supply current in milliamps.",
 		},
-		[]string{"id"},
+		[]string{"device", "id"},
 	)
-	reg.MustRegister(powerCurr)
 
-	powerBoardTemp = prometheus.NewGaugeVec(
+	powerBoardTemp = registrar.gaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
 			Subsystem: "power",
 			Name:      "temp_celsius",
-			Help:      "Power supply board temperature in degrees Celsius. Assumes input is milli-degrees C.",
+			Help:      "Power supply board temperature in degrees Celsius, normalized from the device profile's reporting unit (may be negative).",
 		},
-		[]string{"id"},
+		[]string{"device", "id"},
 	)
-	reg.MustRegister(powerBoardTemp)
 
-	powerBaseState = prometheus.NewGaugeVec(
+	powerBaseState = registrar.gaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
 			Subsystem: "power",
 			Name:      "base_state",
 			Help:      "Power supply base state code (e.g., 0: Charge, 1: Dischg, 2: Idle, -1: N/A).",
 		},
-		[]string{"id"},
+		[]string{"device", "id"},
+	)
+
+	powerVoltState = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "power",
+			Name:      "volt_state",
+			Help:      "Module voltage state from 'pwr': 1 for the current state, 0 for other states seen before.",
+		},
+		[]string{"device", "id", "state"},
+	)
+
+	powerCurrState = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "power",
+			Name:      "curr_state",
+			Help:      "Module current state from 'pwr': 1 for the current state, 0 for other states seen before.",
+		},
+		[]string{"device", "id", "state"},
+	)
+
+	powerTempState = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "power",
+			Name:      "temp_state",
+			Help:      "Module temperature state from 'pwr': 1 for the current state, 0 for other states seen before.",
+		},
+		[]string{"device", "id", "state"},
 	)
-	reg.MustRegister(powerBaseState)
 
-	powerSOC = prometheus.NewGaugeVec(
+	powerBVState = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "power",
+			Name:      "bv_state",
+			Help:      "Module cell voltage state (B.V.St) from 'pwr': 1 for the current state, 0 for other states seen before.",
+		},
+		[]string{"device", "id", "state"},
+	)
+
+	powerBTState = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "power",
+			Name:      "bt_state",
+			Help:      "Module cell temperature state (B.T.St) from 'pwr': 1 for the current state, 0 for other states seen before.",
+		},
+		[]string{"device", "id", "state"},
+	)
+
+	powerMTState = registrar.gaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "power",
+			Name:      "mt_state",
+			Help:      "Module MOSFET temperature state (MosTempSt) from 'pwr': 1 for the current state, 0 for other states seen before.",
+		},
+		[]string{"device", "id", "state"},
+	)
+
+	powerAlarmTransitions = registrar.counterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "power",
+			Name:      "alarm_transitions_total",
+			Help:      "Number of times a state field of 'pwr' left Normal.",
+		},
+		[]string{"device", "id", "field"}, // field: volt, curr, temp, bv, bt, mt
+	)
+
+	powerSOC = registrar.gaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
 			Subsystem: "power",
 			Name:      "soc_percent",
 			Help:      "Power supply State of Charge or equivalent percentage (from 'Coulomb' field).",
 		},
-		[]string{"id"},
+		[]string{"device", "id"},
 	)
-	reg.MustRegister(powerSOC)
 
-	powerMosTemp = prometheus.NewGaugeVec(
+	powerMosTemp = registrar.gaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
 			Subsystem: "power",
 			Name:      "mos_temp_celsius",
-			Help:      "Power supply MOS temperature in degrees Celsius. Assumes input is milli-degrees C if numeric.",
+			Help:      "Power supply MOS temperature in degrees Celsius, normalized from the device profile's reporting unit.",
+		},
+		[]string{"device", "id"},
+	)
+
+	siScaled = registrar.scaled
+	if err := registrar.validate(); err != nil {
+		return err
+	}
+
+	metricEnabled = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "metric_enabled",
+			Help:      "Whether a metric family is enabled (1) or disabled via DISABLE_METRICS (0).",
+		},
+		[]string{"metric"},
+	)
+	reg.MustRegister(metricEnabled)
+	for _, name := range registrar.known {
+		enabled := 1.0
+		if registrar.disabled[name] {
+			enabled = 0
+		}
+		metricEnabled.WithLabelValues(name).Set(enabled)
+	}
+
+	buildInfo := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "build_info",
+			Help:      "Always 1, labelled with the version, revision and Go version the exporter was built from.",
 		},
-		[]string{"id"},
+		[]string{"version", "revision", "goversion"},
 	)
-	reg.MustRegister(powerMosTemp)
+	reg.MustRegister(buildInfo)
+	buildInfo.WithLabelValues(version.Version, version.Revision, version.GoVersion()).Set(1)
+
+	// The default registry carries these, the custom one only on request
+	if settings.Runtime {
+		reg.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	}
 
-	return reg
+	return nil
 }
 
 // UpdateBatteryMetrics updates Prometheus gauges with the latest battery status.
-func UpdateBatteryMetrics(unitLabel string, status parser.BatteryStatus) {
+func UpdateBatteryMetrics(device, unitLabel string, status parser.BatteryStatus) {
 	idStr := strconv.Itoa(status.ID)
 
-	batteryVolt.WithLabelValues(unitLabel, idStr).Set(float64(status.Volt))
-	batteryCurr.WithLabelValues(unitLabel, idStr).Set(float64(status.Curr))
-	batteryTemp.WithLabelValues(unitLabel, idStr).Set(float64(status.Temp) / 1000.0)
-	batteryBaseState.WithLabelValues(unitLabel, idStr).Set(float64(status.BaseState))
-	batterySOC.WithLabelValues(unitLabel, idStr).Set(float64(status.SOC))
-	batteryCoulomb.WithLabelValues(unitLabel, idStr).Set(float64(status.Coulomb))
+	setGauge(batteryVolt, float64(status.Volt), device, unitLabel, idStr)
+	setGauge(batteryCurr, float64(status.Curr), device, unitLabel, idStr)
+	if status.Volt > 0 {
+		setGauge(batteryPower, cellPower(status), device, unitLabel, idStr)
+	}
+	setGauge(batteryTemp, milliToCelsius(status.Temp), device, unitLabel, idStr)
+	setGauge(batteryBaseState, float64(status.BaseState), device, unitLabel, idStr)
+	// Values that could not be parsed keep the previous sample
+	if status.SOC >= 0 {
+		setGauge(batterySOC, float64(status.SOC), device, unitLabel, idStr)
+	}
+	if status.Coulomb >= 0 {
+		setGauge(batteryCoulomb, float64(status.Coulomb), device, unitLabel, idStr)
+	}
+	updateBatteryStates(device, unitLabel, idStr, status)
 
 	activeBalanceChannels := 0
 	if status.BAL == "Y" {
@@ -294,52 +1103,292 @@ func UpdateBatteryMetrics(unitLabel string, status parser.BatteryStatus) {
 	} else if status.BAL != "" && status.BAL != "N" {
 		activeBalanceChannels = strings.Count(status.BAL, "1")
 	}
-	batteryBalanceActiveCount.WithLabelValues(unitLabel, idStr).Set(float64(activeBalanceChannels))
+	setGauge(batteryBalanceActiveCount, float64(activeBalanceChannels), device, unitLabel, idStr)
 }
 
 // UpdatePowerMetrics updates Prometheus gauges with the latest power supply status.
-func UpdatePowerMetrics(status parser.PowerStatus) {
+func UpdatePowerMetrics(device string, status parser.PowerStatus) {
 	idStr := strconv.Itoa(status.ID)
 
-	powerVolt.WithLabelValues(idStr).Set(float64(status.Volt))
-	powerCurr.WithLabelValues(idStr).Set(float64(status.Curr))
-	powerBoardTemp.WithLabelValues(idStr).Set(float64(status.Temp) / 1000.0)
-	powerBaseState.WithLabelValues(idStr).Set(float64(status.BaseState))
-	powerSOC.WithLabelValues(idStr).Set(float64(status.Coulomb))
+	setGauge(powerVolt, float64(status.Volt), device, idStr)
+	setGauge(powerCurr, float64(status.Curr), device, idStr)
+	setGauge(powerBoardTemp, milliToCelsius(status.Temp), device, idStr)
+	setGauge(powerBaseState, float64(status.BaseState), device, idStr)
+	if status.Coulomb >= 0 {
+		setGauge(powerSOC, float64(status.Coulomb), device, idStr)
+	}
+	updatePowerStates(device, idStr, status)
 
-	if mosTempFloat, err := strconv.ParseFloat(status.MosTemp, 64); err == nil {
-		powerMosTemp.WithLabelValues(idStr).Set(mosTempFloat / 10.0)
-	} else {
-		log.Printf("Could not parse MosTemp string '%s' to float for power_id %s: %v", status.MosTemp, idStr, err)
+	// An unparsable MOS temperature was already reported by the parser
+	if status.MosTempValid {
+		setGauge(powerMosTemp, milliToCelsius(status.MosTempMilli), device, idStr)
+	}
+}
+
+// UpdateHeaterMetrics updates the heater gauges for a unit from its pwr row.
+// Modules without heater columns are skipped.
+func UpdateHeaterMetrics(device, unitLabel string, status parser.PowerStatus) {
+	if status.HeaterActive >= 0 {
+		setGauge(batteryHeaterActive, float64(status.HeaterActive), device, unitLabel)
+	}
+	if status.HeaterCurr >= 0 {
+		setGauge(batteryHeaterCurr, float64(status.HeaterCurr), device, unitLabel)
+	}
+}
+
+// UpdateBatteryInfo exports the identity of a unit, replacing earlier values
+// so a swapped module does not leave its predecessor's series behind.
+func UpdateBatteryInfo(device, unitLabel string, info parser.DeviceInfo) {
+	if batteryInfo != nil {
+		batteryInfo.DeletePartialMatch(prometheus.Labels{"device": device, "unit": unitLabel})
+	}
+	setGauge(batteryInfo, 1, device, unitLabel, info.Barcode, info.FirmwareVersion, info.BoardVersion, info.DeviceName)
+	if info.SpecificCapacity >= 0 {
+		setGauge(batterySpecCapacity, float64(info.SpecificCapacity), device, unitLabel)
 	}
 }
 
 // UpdateBatteryStatMetrics updates Prometheus gauges with parsed stat output.
-func UpdateBatteryStatMetrics(unitLabel string, status parser.BatteryStatStatus) {
+func UpdateBatteryStatMetrics(device, unitLabel string, status parser.BatteryStatStatus) {
 	if status.Cycles >= 0 {
-		batteryStatCycles.WithLabelValues(unitLabel).Set(status.Cycles)
+		setGauge(batteryStatCycles, status.Cycles, device, unitLabel)
 	}
 	if status.SOH >= 0 {
-		batteryStatSOH.WithLabelValues(unitLabel).Set(status.SOH)
+		setGauge(batteryStatSOH, status.SOH, device, unitLabel)
 	}
 	if status.DsgCap >= 0 {
-		batteryStatDsgCap.WithLabelValues(unitLabel).Set(status.DsgCap)
+		setGauge(batteryStatDsgCap, status.DsgCap, device, unitLabel)
 	}
 
 	for currentRange, value := range status.ChgCurrSec {
-		batteryStatChgCurrSec.WithLabelValues(unitLabel, currentRange).Set(value)
+		setGauge(batteryStatChgCurrSec, value, device, unitLabel, currentRange)
 	}
 
 	for currentRange, value := range status.DsgCurrSec {
-		batteryStatDsgCurrSec.WithLabelValues(unitLabel, currentRange).Set(value)
+		setGauge(batteryStatDsgCurrSec, value, device, unitLabel, currentRange)
 	}
 
 	for socRange, value := range status.SocSec {
-		batteryStatSocSec.WithLabelValues(unitLabel, socRange).Set(value)
+		setGauge(batteryStatSocSec, value, device, unitLabel, socRange)
+	}
+}
+
+// UpdateBatterySOH updates the state of health gauges with parsed soh output.
+func UpdateBatterySOH(device, unitLabel string, status parser.SOHStatus) {
+	if status.Percent >= 0 {
+		setGauge(batterySOHPercent, status.Percent, device, unitLabel)
+	}
+	if status.Cycles >= 0 {
+		setGauge(batteryCycleCount, status.Cycles, device, unitLabel)
+	}
+}
+
+// UpdateSystemMetrics updates Prometheus gauges with parsed pwrsys output.
+// Values the firmware does not report are left unexported.
+func UpdateSystemMetrics(device string, status parser.SystemStatus) {
+	if status.ChargeEnabled >= 0 {
+		setGauge(systemChargeEnabled, float64(status.ChargeEnabled), device)
+	}
+	if status.DischargeEnabled >= 0 {
+		setGauge(systemDischargeEnabled, float64(status.DischargeEnabled), device)
+	}
+	if status.ChargeVoltLimit >= 0 {
+		setGauge(systemChgVoltLimit, float64(status.ChargeVoltLimit), device)
+	}
+	if status.ChargeCurrLimit >= 0 {
+		setGauge(systemChgCurrLimit, float64(status.ChargeCurrLimit), device)
+	}
+	if status.DsgCurrLimit >= 0 {
+		setGauge(systemDsgCurrLimit, float64(status.DsgCurrLimit), device)
+	}
+}
+
+// UpdateModuleCounts exports the number of present modules and, when an
+// expected count is configured (expected > 0), the expected and missing
+// counts. Ignored units within the expected range never count as missing.
+func UpdateModuleCounts(device string, present, expected, ignored int) {
+	setGauge(systemModulesPresent, float64(present), device)
+	if expected <= 0 {
+		return
+	}
+
+	missing := expected - ignored - present
+	if missing < 0 {
+		missing = 0
+	}
+	setGauge(systemModulesExpected, float64(expected), device)
+	setGauge(systemModulesMissing, float64(missing), device)
+}
+
+// SetCommandSupported records whether the firmware implements a console
+// command; unsupported commands are no longer fetched.
+func SetCommandSupported(device, command string, supported bool) {
+	value := 0.0
+	if supported {
+		value = 1
+	}
+	setGauge(commandSupported, value, device, command)
+}
+
+// SetFetchTimeouts exports the effective request timeout of each console
+// command.
+func SetFetchTimeouts(timeouts map[string]time.Duration) {
+	for command, timeout := range timeouts {
+		setGauge(fetchTimeout, timeout.Seconds(), command)
+	}
+}
+
+// RecordCommandRun records the outcome of a run of a console command that
+// started at started: command_up, its duration and, if it succeeded, the
+// last success timestamp.
+func RecordCommandRun(device, command string, started time.Time, ok bool) {
+	now := time.Now()
+	setGauge(commandDuration, now.Sub(started).Seconds(), device, command)
+	if !ok {
+		setGauge(commandUp, 0, device, command)
+		return
+	}
+	setGauge(commandUp, 1, device, command)
+	setGauge(commandLastSuccess, float64(now.UnixNano())/1e9, device, command)
+}
+
+// SetUnitLastSuccess records when a per-unit console command last succeeded
+// for a unit.
+func SetUnitLastSuccess(device, command, unitLabel string, at time.Time) {
+	setGauge(unitLastSuccess, float64(at.UnixNano())/1e9, device, command, unitLabel)
+}
+
+// SetUnitTopology records where this cycle's unit count came from and when it
+// was last confirmed by pwr. The age is omitted until the first confirmation.
+func SetUnitTopology(device, source string, confirmedAt time.Time) {
+	for _, known := range []string{"pwr", "cache", "none"} {
+		value := 0.0
+		if known == source {
+			value = 1
+		}
+		setGauge(unitTopologySource, value, device, known)
+	}
+	if !confirmedAt.IsZero() {
+		setGauge(unitTopologyAge, time.Since(confirmedAt).Seconds(), device)
+	}
+}
+
+// SetUnitHealth records the failure streak of a unit and its current backoff,
+// 0 while it is fetched every cycle.
+func SetUnitHealth(device, unit string, streak int, backoff time.Duration) {
+	value := 0.0
+	if backoff > 0 {
+		value = 1
+	}
+	setGauge(batteryUnitDisabled, value, device, unit)
+	setGauge(batteryUnitFailStreak, float64(streak), device, unit)
+	setGauge(batteryUnitBackoff, backoff.Seconds(), device, unit)
+}
+
+// SetIgnoredUnits replaces the set of units exported as ignored.
+func SetIgnoredUnits(device string, units []int) {
+	if batteryUnitIgnored == nil {
+		return
+	}
+	batteryUnitIgnored.DeletePartialMatch(prometheus.Labels{"device": device})
+	for _, id := range units {
+		batteryUnitIgnored.WithLabelValues(device, "bat"+strconv.Itoa(id)).Set(1)
+	}
+}
+
+// SetDeviceIdentityMismatch records the outcome of the device serial check.
+func SetDeviceIdentityMismatch(device string, mismatch bool) {
+	value := 0.0
+	if mismatch {
+		value = 1
+	}
+	setGauge(deviceIdentityMismatch, value, device)
+}
+
+// SetActiveEndpoint marks which of the configured device endpoints is in use.
+func SetActiveEndpoint(device string, endpoints []string, active int) {
+	for idx, endpoint := range endpoints {
+		value := 0.0
+		if idx == active {
+			value = 1
+		}
+		setGauge(deviceActiveEndpoint, value, device, endpoint)
+	}
+}
+
+// ResetDeviceMetrics drops all battery, system, stack and power series of a
+// device and its command_up, e.g. while the connected device cannot be
+// trusted. The unit health and ignored units are exporter state and kept.
+func ResetDeviceMetrics(device string) {
+	labels := prometheus.Labels{"device": device}
+	for _, vec := range []*prometheus.GaugeVec{
+		batteryInfo, batterySpecCapacity, batteryLastEvent, commandUp,
+		batteryVolt, batteryCurr, batteryTemp, batteryBaseState, batterySOC, batteryCoulomb,
+		batteryBalanceActiveCount, batterySOCEstimated, batterySOCDrift, batteryHeaterActive, batteryHeaterCurr,
+		batteryCellVoltMin, batteryCellVoltMax, batteryCellVoltAvg, batteryCellVoltDelta,
+		batteryCellTempMin, batteryCellTempMax, batteryCellTempDelta,
+		batteryPower, batteryUnitPower, batteryUnitCurr, batteryUnitSOCAvg, batteryUnitCharging, batteryUnitDischarging,
+		batteryStatCycles, batteryStatSOH, batteryStatDsgCap, batteryStatChgCurrSec, batteryStatDsgCurrSec, batteryStatSocSec,
+		batterySOHPercent, batteryCycleCount,
+		systemChargeEnabled, systemDischargeEnabled, systemChgVoltLimit, systemChgCurrLimit, systemDsgCurrLimit,
+		systemModulesExpected, systemModulesPresent, systemModulesMissing,
+		stackVolt, stackCurr, stackPower,
+		powerVolt, powerCurr, powerBoardTemp, powerBaseState, powerSOC, powerMosTemp,
+		batteryPresent, powerPresent,
+		batteryVoltState, batteryCurrState, batteryTempState,
+		powerVoltState, powerCurrState, powerTempState, powerBVState, powerBTState, powerMTState,
+	} {
+		if vec != nil {
+			vec.DeletePartialMatch(labels)
+		}
+	}
+	for _, vec := range []*prometheus.CounterVec{
+		batteryEvents, batteryAlarmTransitions, powerAlarmTransitions, stackEnergyCharged, stackEnergyDischarged,
+	} {
+		if vec != nil {
+			vec.DeletePartialMatch(labels)
+		}
+	}
+	if batteryCellVoltHistogram != nil {
+		batteryCellVoltHistogram.DeletePartialMatch(labels)
+	}
+	resetDeviceModel(device)
+	resetDevicePresence(device)
+	resetDeviceStates(device)
+	PauseStackEnergy(device)
+}
+
+// RecordDeviceResponse counts an HTTP response from the device for a command.
+// Only the command name is used as label, so "bat 3" is counted as "bat".
+func RecordDeviceResponse(device, command string, statusCode int) {
+	name := command
+	if fields := strings.Fields(command); len(fields) > 0 {
+		name = fields[0]
+	}
+	incCounter(deviceHTTPResponses, device, name, strconv.Itoa(statusCode))
+}
+
+// RecordSerialResponse counts a command sent over the serial console by
+// outcome. Like RecordDeviceResponse it only uses the command name as label.
+func RecordSerialResponse(device, command, outcome string) {
+	name := command
+	if fields := strings.Fields(command); len(fields) > 0 {
+		name = fields[0]
+	}
+	incCounter(serialResponses, device, name, outcome)
+}
+
+// RecordRetry counts a retried console request. Like RecordDeviceResponse it
+// only uses the command name as label.
+func RecordRetry(device, command string) {
+	name := command
+	if fields := strings.Fields(command); len(fields) > 0 {
+		name = fields[0]
 	}
+	incCounter(fetchRetries, device, name)
 }
 
-// RecordError increments the error counter for a given type.
-func RecordError(errorType string) {
-	scrapeErrors.WithLabelValues(errorType).Inc()
+// RecordError increments the error counter of a device for a given type.
+func RecordError(device, errorType string) {
+	incCounter(scrapeErrors, device, errorType)
 }
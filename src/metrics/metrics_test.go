@@ -1,16 +1,28 @@
 package metrics
 
 import (
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"pylontech_exporter/src/config"
 	"pylontech_exporter/src/parser"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 )
 
 func TestUpdateBatteryStatMetricsExportsDsgCap(t *testing.T) {
-	t.Setenv("PROM_NAMESPACE", "devicemon")
-	registry := InitMetrics()
+	registry, err := InitMetrics()
+	if err != nil {
+		t.Fatalf("InitMetrics returned error: %v", err)
+	}
 
-	UpdateBatteryStatMetrics("bat3", parser.BatteryStatStatus{
+	UpdateBatteryStatMetrics("default", "bat3", parser.BatteryStatStatus{
 		DsgCap: 6621177,
 	})
 
@@ -41,3 +53,854 @@ func TestUpdateBatteryStatMetricsExportsDsgCap(t *testing.T) {
 
 	t.Fatal("devicemon_battery_stat_dsg_cap was not exported")
 }
+
+func TestSOCEstimatorIntegratesAndReanchors(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	var estimator socEstimator
+
+	// First sample anchors to the reported SOC.
+	if got := estimator.sample(start, -10000, 50, 100000, time.Minute); got != 50 {
+		t.Fatalf("anchored estimate = %v, want 50", got)
+	}
+
+	// 30s at -10A removes 83.3 mAh.
+	got := estimator.sample(start.Add(30*time.Second), -10000, 50, 100000, time.Minute)
+	if want := 50 - 10000*(30.0/3600)/1000; got < want-1e-9 || got > want+1e-9 {
+		t.Fatalf("integrated estimate = %v, want %v", got, want)
+	}
+
+	// A gap longer than the maximum pauses integration.
+	before := got
+	if got := estimator.sample(start.Add(time.Hour), -10000, 40, 100000, time.Minute); got != before {
+		t.Fatalf("estimate after gap = %v, want unchanged %v", got, before)
+	}
+
+	// A full module re-anchors to 100%.
+	if got := estimator.sample(start.Add(time.Hour+30*time.Second), 0, 100, 100000, time.Minute); got != 100 {
+		t.Fatalf("estimate at full = %v, want 100", got)
+	}
+}
+
+func TestSampleMaxGapFollowsCollectionMode(t *testing.T) {
+	registry, err := InitMetrics()
+	if err != nil {
+		t.Fatalf("InitMetrics returned error: %v", err)
+	}
+	t.Cleanup(func() { SetSampleMaxGap(5 * time.Minute) })
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	rows := []parser.BatteryStatus{{ID: 0, Curr: -30000, SOC: 50, Coulomb: 50000}}
+	power := parser.StackPower{Volt: 50000, Curr: -20000, Power: -1000}
+
+	// Samples 2m apart, far above 3 × REFRESH_SECONDS: scrapes in collector
+	// mode, missed ticks in ticker mode
+	for _, tt := range []struct {
+		device  string
+		env     []string
+		soc, wh float64
+	}{
+		{"collector", []string{"REFRESH_SECONDS=10"}, 49, 1000.0 / 30},
+		{"ticker", []string{"REFRESH_SECONDS=10", "COLLECTION_MODE=ticker"}, 50, 0},
+	} {
+		cfg, err := config.Load(nil, tt.env)
+		if err != nil {
+			t.Fatalf("Load(%v) returned error: %v", tt.env, err)
+		}
+		SetSampleMaxGap(cfg.SampleMaxGap)
+		for _, now := range []time.Time{start, start.Add(2 * time.Minute)} {
+			UpdateSOCEstimate(tt.device, "bat1", now, rows)
+			UpdateStackPower(tt.device, now, power)
+		}
+
+		labels := map[string]string{"device": tt.device}
+		// 2m at -30A removes 1000 mAh of 100000 mAh
+		if got := seriesValue(t, registry, "devicemon_battery_soc_estimated_percent", labels); math.Abs(got-tt.soc) > 1e-9 {
+			t.Errorf("%s: soc_estimated_percent = %v, want %v", tt.device, got, tt.soc)
+		}
+		if got := seriesValue(t, registry, "devicemon_stack_energy_discharged_watthours_total", labels); math.Abs(got-tt.wh) > 1e-9 {
+			t.Errorf("%s: stack_energy_discharged = %v Wh, want %v", tt.device, got, tt.wh)
+		}
+	}
+}
+
+func TestStackEnergyIntegratesBySignAndSkipsPausedIntervals(t *testing.T) {
+	registry, err := InitMetrics()
+	if err != nil {
+		t.Fatalf("InitMetrics returned error: %v", err)
+	}
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	counter := func(name string) float64 {
+		t.Helper()
+		metricFamilies, err := registry.Gather()
+		if err != nil {
+			t.Fatalf("Gather returned error: %v", err)
+		}
+		for _, family := range metricFamilies {
+			if family.GetName() == name && len(family.GetMetric()) > 0 {
+				return family.GetMetric()[0].GetCounter().GetValue()
+			}
+		}
+		t.Fatalf("%s was not exported", name)
+		return 0
+	}
+
+	// 1 kW charging for 3 minutes is 50 Wh.
+	UpdateStackPower("default", start, parser.StackPower{Volt: 50000, Curr: 20000, Power: 1000})
+	UpdateStackPower("default", start.Add(3*time.Minute), parser.StackPower{Volt: 50000, Curr: 20000, Power: 1000})
+	if got := counter("devicemon_stack_energy_charged_watthours_total"); got != 50 {
+		t.Fatalf("charged = %v Wh, want 50", got)
+	}
+
+	// A failed cycle skips the interval up to the next sample.
+	PauseStackEnergy("default")
+	UpdateStackPower("default", start.Add(6*time.Minute), parser.StackPower{Volt: 50000, Curr: -20000, Power: -1000})
+	UpdateStackPower("default", start.Add(9*time.Minute), parser.StackPower{Volt: 50000, Curr: -20000, Power: -1000})
+	if got := counter("devicemon_stack_energy_discharged_watthours_total"); got != 50 {
+		t.Fatalf("discharged = %v Wh, want 50", got)
+	}
+	if got := counter("devicemon_stack_energy_charged_watthours_total"); got != 50 {
+		t.Fatalf("charged after discharge = %v Wh, want unchanged 50", got)
+	}
+	if got := gaugeValue(t, registry, "devicemon_stack_power_watts"); got != -1000 {
+		t.Fatalf("stack_power_watts = %v, want -1000", got)
+	}
+}
+
+func TestUpdateBatteryMetricsKeepsNegativeValues(t *testing.T) {
+	registry, err := InitMetrics()
+	if err != nil {
+		t.Fatalf("InitMetrics returned error: %v", err)
+	}
+
+	UpdateBatteryMetrics("default", "bat1", parser.BatteryStatus{ID: 0, Curr: -18342, Temp: -2300})
+	UpdatePowerMetrics("default", parser.PowerStatus{ID: 1, Curr: -18342, Temp: -3500, MosTemp: "0"})
+
+	for name, want := range map[string]float64{
+		"devicemon_battery_curr":         -18342,
+		"devicemon_battery_temp_celsius": -2.3,
+		"devicemon_power_curr":           -18342,
+		"devicemon_power_temp_celsius":   -3.5,
+	} {
+		if got := gaugeValue(t, registry, name); got != want {
+			t.Fatalf("%s = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestUpdateBatteryMetricsSkipsUnparsedValues(t *testing.T) {
+	registry, err := InitMetrics()
+	if err != nil {
+		t.Fatalf("InitMetrics returned error: %v", err)
+	}
+
+	UpdateBatteryMetrics("default", "bat1", parser.BatteryStatus{ID: 0, SOC: 87, Coulomb: 43500})
+	UpdateBatteryMetrics("default", "bat1", parser.BatteryStatus{ID: 0, SOC: -1, Coulomb: -1})
+	UpdatePowerMetrics("default", parser.PowerStatus{ID: 1, Coulomb: -1, MosTemp: "0"})
+
+	if got := gaugeValue(t, registry, "devicemon_battery_soc"); got != 87 {
+		t.Fatalf("battery SOC = %v, want the previous value 87", got)
+	}
+	if got := gaugeValue(t, registry, "devicemon_battery_coulomb"); got != 43500 {
+		t.Fatalf("battery coulomb = %v, want the previous value 43500", got)
+	}
+	metricFamilies, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather returned error: %v", err)
+	}
+	for _, family := range metricFamilies {
+		if family.GetName() == "devicemon_power_soc_percent" {
+			t.Fatalf("power SOC exported %v for an unparsed value", family.GetMetric())
+		}
+	}
+}
+
+// gaugeValue returns the value of the first series of a gauge family.
+func gaugeValue(t *testing.T, registry *prometheus.Registry, name string) float64 {
+	t.Helper()
+
+	metricFamilies, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather returned error: %v", err)
+	}
+	for _, family := range metricFamilies {
+		if family.GetName() == name && len(family.GetMetric()) > 0 {
+			return family.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	t.Fatalf("%s was not exported", name)
+	return 0
+}
+
+func TestDisableMetricsSkipsRegistration(t *testing.T) {
+	configureDisabled(t, "battery_curr", "devicemon_battery_coulomb")
+	registry, err := InitMetrics()
+	if err != nil {
+		t.Fatalf("InitMetrics returned error: %v", err)
+	}
+
+	UpdateBatteryMetrics("default", "bat1", parser.BatteryStatus{ID: 0, Volt: 3300, Curr: 100, Coulomb: 43500})
+
+	metricFamilies, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather returned error: %v", err)
+	}
+	exported := map[string]bool{}
+	for _, family := range metricFamilies {
+		exported[family.GetName()] = true
+	}
+	if exported["devicemon_battery_curr"] || exported["devicemon_battery_coulomb"] {
+		t.Fatal("disabled metric families were exported")
+	}
+	if !exported["devicemon_battery_volt"] {
+		t.Fatal("enabled metric family devicemon_battery_volt was not exported")
+	}
+}
+
+// configureDisabled disables metric families for the rest of the test.
+func configureDisabled(t *testing.T, names ...string) {
+	t.Helper()
+	Configure(config.Metrics{Namespace: "devicemon", Disabled: names})
+	t.Cleanup(func() { Configure(config.Default().Metrics) })
+}
+
+func TestDisableMetricsRejectsUnknownNames(t *testing.T) {
+	configureDisabled(t, "battery_volts")
+	if _, err := InitMetrics(); err == nil {
+		t.Fatal("InitMetrics accepted an unknown metric name")
+	}
+}
+
+func TestMetricsAreLabelledByDevice(t *testing.T) {
+	registry, err := InitMetrics()
+	if err != nil {
+		t.Fatalf("InitMetrics returned error: %v", err)
+	}
+
+	UpdatePowerMetrics("garage", parser.PowerStatus{ID: 1, Volt: 51516, MosTemp: "0"})
+	UpdatePowerMetrics("basement", parser.PowerStatus{ID: 1, Volt: 52000, MosTemp: "0"})
+	RecordError("garage", "pwr_fetch")
+	UpdateBatteryInfo("basement", "bat1", parser.DeviceInfo{Barcode: "PPTAP0123", SpecificCapacity: 74000})
+	ObserveCellVoltages("basement", "bat1", []parser.BatteryStatus{{ID: 0, Volt: 3300}})
+	UpdateEvents("basement", []parser.Event{{Time: time.Unix(1700000000, 0), Module: 1, Type: "Cell UV"}})
+	RecordCommandRun("basement", "pwr", time.Now(), true)
+	SetDeviceModel("basement", "US5000", "1")
+	SetUnitHealth("basement", "bat1", 1, 0)
+	ResetDeviceMetrics("basement")
+
+	metricFamilies, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather returned error: %v", err)
+	}
+	devices := map[string][]string{}
+	for _, family := range metricFamilies {
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "device" {
+					devices[family.GetName()] = append(devices[family.GetName()], label.GetValue())
+				}
+			}
+		}
+	}
+	if got := devices["devicemon_power_volt"]; len(got) != 1 || got[0] != "garage" {
+		t.Fatalf("power_volt devices = %v, want only garage after resetting basement", got)
+	}
+	if got := devices["devicemon_scraper_errors_total"]; len(got) != 1 || got[0] != "garage" {
+		t.Fatalf("scraper_errors_total devices = %v, want garage", got)
+	}
+
+	// Everything read from the device goes, the exporter's own unit state stays
+	kept := []string{"battery_unit_ignored", "battery_unit_disabled", "battery_unit_failure_streak", "battery_unit_backoff_seconds"}
+	for name, got := range devices {
+		name = strings.TrimPrefix(name, "devicemon_")
+		if !slices.Contains(got, "basement") || slices.Contains(kept, name) {
+			continue
+		}
+		if name == "scraper_command_up" || !strings.HasPrefix(name, "scraper_") && !strings.HasPrefix(name, "device_") {
+			t.Errorf("%s keeps series of basement after the reset", name)
+		}
+	}
+	if !slices.Contains(devices["devicemon_battery_unit_failure_streak"], "basement") {
+		t.Error("the reset dropped the unit health of basement")
+	}
+	if _, ok := deviceModels.labels["basement"]; ok {
+		t.Error("the reset kept the model of basement")
+	}
+}
+
+func TestUpdateModuleCountsReportsMissing(t *testing.T) {
+	registry, err := InitMetrics()
+	if err != nil {
+		t.Fatalf("InitMetrics returned error: %v", err)
+	}
+
+	UpdateModuleCounts("default", 3, 4, 0)
+
+	if got := gaugeValue(t, registry, "devicemon_system_modules_present"); got != 3 {
+		t.Fatalf("modules_present = %v, want 3", got)
+	}
+	if got := gaugeValue(t, registry, "devicemon_system_modules_missing"); got != 1 {
+		t.Fatalf("modules_missing = %v, want 1", got)
+	}
+
+	UpdateModuleCounts("default", 3, 4, 1)
+	if got := gaugeValue(t, registry, "devicemon_system_modules_missing"); got != 0 {
+		t.Fatalf("modules_missing = %v, want 0 when the only absent module is ignored", got)
+	}
+}
+
+func TestSyncBatteryCellsDropsMissingCells(t *testing.T) {
+	registry, err := InitMetrics()
+	if err != nil {
+		t.Fatalf("InitMetrics returned error: %v", err)
+	}
+
+	cells := []parser.BatteryStatus{{ID: 0, Volt: 3300}, {ID: 1, Volt: 3310}}
+	for _, cell := range cells {
+		UpdateBatteryMetrics("default", "bat1", cell)
+	}
+	SyncBatteryCells("default", "bat1", cells)
+
+	UpdateBatteryMetrics("default", "bat1", cells[0])
+	SyncBatteryCells("default", "bat1", cells[:1])
+
+	metricFamilies, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather returned error: %v", err)
+	}
+	for _, family := range metricFamilies {
+		switch family.GetName() {
+		case "devicemon_battery_volt":
+			if len(family.GetMetric()) != 1 {
+				t.Fatalf("battery_volt has %d series, want only the remaining cell", len(family.GetMetric()))
+			}
+		case "devicemon_battery_present":
+			present := map[string]float64{}
+			for _, metric := range family.GetMetric() {
+				for _, label := range metric.GetLabel() {
+					if label.GetName() == "id" {
+						present[label.GetValue()] = metric.GetGauge().GetValue()
+					}
+				}
+			}
+			if present["0"] != 1 || present["1"] != 0 || len(present) != 2 {
+				t.Fatalf("battery_present = %v, want cell 0 present and cell 1 gone", present)
+			}
+		}
+	}
+}
+
+func TestUpdateCellAggregatesSkipsFailedCells(t *testing.T) {
+	registry, err := InitMetrics()
+	if err != nil {
+		t.Fatalf("InitMetrics returned error: %v", err)
+	}
+
+	// Cell 1 fails to parse and is dropped, cell 2 has no voltage reading
+	statuses, err := parser.ParseBAT([]string{
+		"0    3312   -1459  21000  Dischg  Normal  Normal  Normal  87%  43500 mAH  N",
+		"1    3xx5   -1459  22000  Dischg  Normal  Normal  Normal  87%  43500 mAH  N",
+		"3    3340   -1459  -2000  Dischg  Normal  Normal  Normal  87%  43500 mAH  N",
+		"4    3320   -1459  24000  Dischg  Normal  Normal  Normal  87%  43500 mAH  N",
+	})
+	if err != nil {
+		t.Fatalf("ParseBAT returned error: %v", err)
+	}
+	statuses = append(statuses, parser.BatteryStatus{ID: 2, Volt: -1, Temp: 23000})
+
+	UpdateCellAggregates("default", "bat1", statuses)
+
+	want := map[string]float64{
+		"devicemon_battery_cell_volt_min":           3312,
+		"devicemon_battery_cell_volt_max":           3340,
+		"devicemon_battery_cell_volt_avg":           3324,
+		"devicemon_battery_cell_volt_delta":         28,
+		"devicemon_battery_cell_temp_min_celsius":   -2,
+		"devicemon_battery_cell_temp_max_celsius":   24,
+		"devicemon_battery_cell_temp_delta_celsius": 26,
+	}
+	for name, value := range want {
+		if got := gaugeValue(t, registry, name); got != value {
+			t.Errorf("%s = %v, want %v", name, got, value)
+		}
+	}
+}
+
+// seriesValue returns the value of the series of a gauge family that has
+// all the given labels.
+func seriesValue(t *testing.T, registry *prometheus.Registry, name string, labels map[string]string) float64 {
+	t.Helper()
+
+	metricFamilies, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather returned error: %v", err)
+	}
+	for _, family := range metricFamilies {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			matched := 0
+			for _, label := range metric.GetLabel() {
+				if value, ok := labels[label.GetName()]; ok && value == label.GetValue() {
+					matched++
+				}
+			}
+			if matched == len(labels) {
+				if counter := metric.GetCounter(); counter != nil {
+					return counter.GetValue()
+				}
+				return metric.GetGauge().GetValue()
+			}
+		}
+	}
+	t.Fatalf("%s%v was not exported", name, labels)
+	return 0
+}
+
+// unitGaugeValue returns the value of the series of a gauge family with the
+// given unit label.
+func unitGaugeValue(t *testing.T, registry *prometheus.Registry, name, unit string) float64 {
+	t.Helper()
+	return seriesValue(t, registry, name, map[string]string{"unit": unit})
+}
+
+func TestUnitPowerWithChargingAndDischargingUnits(t *testing.T) {
+	registry, err := InitMetrics()
+	if err != nil {
+		t.Fatalf("InitMetrics returned error: %v", err)
+	}
+
+	charging := []parser.BatteryStatus{
+		{ID: 0, Volt: 3400, Curr: 2000, Temp: 21000, SOC: 60, Coulomb: 30000},
+		{ID: 1, Volt: 3300, Curr: 2000, Temp: 21000, SOC: 62, Coulomb: 31000},
+	}
+	discharging := []parser.BatteryStatus{
+		{ID: 0, Volt: 3200, Curr: -5000, Temp: 21000, SOC: 40, Coulomb: 20000},
+		{ID: 1, Volt: 3250, Curr: -5000, Temp: 21000, SOC: -1, Coulomb: -1},
+	}
+	for _, status := range charging {
+		UpdateBatteryMetrics("default", "bat1", status)
+	}
+	UpdateCellAggregates("default", "bat1", charging)
+	UpdateCellAggregates("default", "bat2", discharging)
+
+	want := []struct {
+		name, unit string
+		value      float64
+	}{
+		{"devicemon_battery_power_watts", "bat1", 6.8},
+		{"devicemon_battery_unit_power_watts", "bat1", 13.4},
+		{"devicemon_battery_unit_curr_milliamps", "bat1", 2000},
+		{"devicemon_battery_unit_soc_avg", "bat1", 61},
+		{"devicemon_battery_unit_charging", "bat1", 1},
+		{"devicemon_battery_unit_discharging", "bat1", 0},
+		{"devicemon_battery_unit_power_watts", "bat2", -32.25},
+		{"devicemon_battery_unit_curr_milliamps", "bat2", -5000},
+		{"devicemon_battery_unit_soc_avg", "bat2", 40},
+		{"devicemon_battery_unit_charging", "bat2", 0},
+		{"devicemon_battery_unit_discharging", "bat2", 1},
+	}
+	for _, w := range want {
+		if got := unitGaugeValue(t, registry, w.name, w.unit); math.Abs(got-w.value) > 1e-9 {
+			t.Errorf("%s{unit=%q} = %v, want %v", w.name, w.unit, got, w.value)
+		}
+	}
+}
+
+func TestUnitPowerSkipsBadRow(t *testing.T) {
+	registry, err := InitMetrics()
+	if err != nil {
+		t.Fatalf("InitMetrics returned error: %v", err)
+	}
+
+	// The current of cell 1 fails to parse; it must not count as 0 mA
+	statuses, err := parser.ParseBAT([]string{
+		"0    3300   -3000  21000  Dischg  Normal  Normal  Normal  80%  40000 mAH  N",
+		"1    3300   -3x00  21000  Dischg  Normal  Normal  Normal  20%  10000 mAH  N",
+		"2    3300   -3000  21000  Dischg  Normal  Normal  Normal  90%  45000 mAH  N",
+	})
+	if err != nil {
+		t.Fatalf("ParseBAT returned error: %v", err)
+	}
+	UpdateCellAggregates("default", "bat1", statuses)
+
+	want := map[string]float64{
+		"devicemon_battery_unit_power_watts":    -19.8,
+		"devicemon_battery_unit_curr_milliamps": -3000,
+		"devicemon_battery_unit_soc_avg":        85,
+		"devicemon_battery_unit_discharging":    1,
+	}
+	for name, value := range want {
+		if got := unitGaugeValue(t, registry, name, "bat1"); math.Abs(got-value) > 1e-9 {
+			t.Errorf("%s = %v, want %v", name, got, value)
+		}
+	}
+}
+
+func TestObserveCellVoltagesOncePerOutput(t *testing.T) {
+	registry, err := InitMetrics()
+	if err != nil {
+		t.Fatalf("InitMetrics returned error: %v", err)
+	}
+	statuses := []parser.BatteryStatus{{ID: 0, Volt: 3312}, {ID: 1, Volt: 3340}, {ID: 2, Volt: -1}}
+
+	ObserveCellVoltages("default", "bat1", statuses)
+	ObserveCellVoltages("default", "bat1", statuses)
+	// Scrapes do not observe anything
+	registry.Gather()
+
+	metricFamilies, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather returned error: %v", err)
+	}
+	for _, family := range metricFamilies {
+		if family.GetName() != "devicemon_battery_cell_volt_distribution" {
+			continue
+		}
+		histogram := family.GetMetric()[0].GetHistogram()
+		if histogram.GetSampleCount() != 4 || math.Abs(histogram.GetSampleSum()-13.304) > 1e-9 {
+			t.Fatalf("histogram count %d sum %v, want 4 cells summing to 13.304 V", histogram.GetSampleCount(), histogram.GetSampleSum())
+		}
+		for _, bucket := range histogram.GetBucket() {
+			if bucket.GetUpperBound() == 3.325 && bucket.GetCumulativeCount() != 2 {
+				t.Fatalf("bucket le=3.325 holds %d samples, want 2", bucket.GetCumulativeCount())
+			}
+		}
+		return
+	}
+	t.Fatal("devicemon_battery_cell_volt_distribution was not exported")
+}
+
+func TestBatteryStatesClearAndCountTransitions(t *testing.T) {
+	registry, err := InitMetrics()
+	if err != nil {
+		t.Fatalf("InitMetrics returned error: %v", err)
+	}
+
+	for _, state := range []string{"Normal", "High", "Normal", "OverVolt"} {
+		UpdateBatteryMetrics("default", "bat1", parser.BatteryStatus{ID: 0, VoltState: state, CurrState: "Normal", TempState: "Normal"})
+	}
+
+	metricFamilies, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather returned error: %v", err)
+	}
+	for _, family := range metricFamilies {
+		switch family.GetName() {
+		case "devicemon_battery_volt_state":
+			got := map[string]float64{}
+			for _, metric := range family.GetMetric() {
+				for _, label := range metric.GetLabel() {
+					if label.GetName() == "state" {
+						got[label.GetValue()] = metric.GetGauge().GetValue()
+					}
+				}
+			}
+			if got["OverVolt"] != 1 || got["High"] != 0 || got["Normal"] != 0 || len(got) != 3 {
+				t.Fatalf("battery_volt_state = %v, want only OverVolt active", got)
+			}
+		case "devicemon_battery_alarm_transitions_total":
+			if len(family.GetMetric()) != 1 {
+				t.Fatalf("alarm_transitions_total has %d series, want only field=volt", len(family.GetMetric()))
+			}
+			if got := family.GetMetric()[0].GetCounter().GetValue(); got != 2 {
+				t.Fatalf("alarm_transitions_total = %v, want 2", got)
+			}
+		}
+	}
+}
+
+func TestRecordCommandRun(t *testing.T) {
+	registry, err := InitMetrics()
+	if err != nil {
+		t.Fatalf("InitMetrics returned error: %v", err)
+	}
+
+	RecordCommandRun("default", "pwr", time.Now().Add(-1500*time.Millisecond), true)
+	lastSuccess := gaugeValue(t, registry, "devicemon_scraper_command_last_success_timestamp_seconds")
+	RecordCommandRun("default", "pwr", time.Now(), false)
+
+	if got := gaugeValue(t, registry, "devicemon_scraper_command_up"); got != 0 {
+		t.Fatalf("command_up after a failed run = %v, want 0", got)
+	}
+	if got := gaugeValue(t, registry, "devicemon_scraper_command_last_success_timestamp_seconds"); got != lastSuccess {
+		t.Fatalf("last success moved to %v on a failed run, want %v", got, lastSuccess)
+	}
+	if got := gaugeValue(t, registry, "devicemon_scraper_command_duration_seconds"); got >= 1 {
+		t.Fatalf("command_duration_seconds = %v, want the duration of the failed run", got)
+	}
+}
+
+// exportFixtures parses a pwr and a bat fixture of the parser tests with
+// profile and exports them like a collection cycle.
+func exportFixtures(t *testing.T, profile parser.Profile, pwrFixture, batFixture string) {
+	t.Helper()
+	read := func(name string) []string {
+		data, err := os.ReadFile(filepath.Join("..", "parser", "testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Split(string(data), "\n")
+	}
+
+	power, err := profile.ParsePWR(read(pwrFixture))
+	if err != nil {
+		t.Fatalf("ParsePWR(%s) returned error: %v", pwrFixture, err)
+	}
+	for _, status := range power {
+		UpdatePowerMetrics("default", status)
+	}
+	cells, err := profile.ParseBAT(read(batFixture))
+	if err != nil {
+		t.Fatalf("ParseBAT(%s) returned error: %v", batFixture, err)
+	}
+	for _, status := range cells {
+		UpdateBatteryMetrics("default", "bat1", status)
+	}
+}
+
+// TestExportedTemperaturesOfFixtures pins the exported temperatures of known
+// console output, so a wrong divisor for any of them cannot slip in again.
+func TestExportedTemperaturesOfFixtures(t *testing.T) {
+	deciScale := parser.PylontechProfile
+	deciScale.TempScale = parser.TempScales["deci"] // TEMP_SCALE=deci
+
+	tests := []struct {
+		name                   string
+		profile                parser.Profile
+		pwrFixture, batFixture string
+		cell0, cell1           float64
+	}{
+		{"pylontech milli-degrees", parser.PylontechProfile, "pwr_us2000.txt", "bat_us2000.txt", 21.7, 21.71},
+		{"pylontech_deci", parser.PylontechDeciProfile, "pwr_deci.txt", "bat_deci.txt", 21.7, -3.5},
+		{"TEMP_SCALE=deci", deciScale, "pwr_deci.txt", "bat_deci.txt", 21.7, -3.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry, err := InitMetrics()
+			if err != nil {
+				t.Fatalf("InitMetrics returned error: %v", err)
+			}
+			exportFixtures(t, tt.profile, tt.pwrFixture, tt.batFixture)
+
+			want := []struct {
+				name   string
+				labels map[string]string
+				value  float64
+			}{
+				{"devicemon_power_temp_celsius", map[string]string{"id": "1"}, 32.9},
+				{"devicemon_power_mos_temp_celsius", map[string]string{"id": "1"}, 32.4},
+				{"devicemon_battery_temp_celsius", map[string]string{"id": "0"}, tt.cell0},
+				{"devicemon_battery_temp_celsius", map[string]string{"id": "1"}, tt.cell1},
+			}
+			for _, w := range want {
+				if got := seriesValue(t, registry, w.name, w.labels); math.Abs(got-w.value) > 1e-9 {
+					t.Errorf("%s%v = %v, want %v", w.name, w.labels, got, w.value)
+				}
+			}
+		})
+	}
+}
+
+func TestMetricUnitsSI(t *testing.T) {
+	Configure(config.Metrics{Namespace: "devicemon", Units: "si"})
+	t.Cleanup(func() { Configure(config.Default().Metrics) })
+	registry, err := InitMetrics()
+	if err != nil {
+		t.Fatalf("InitMetrics returned error: %v", err)
+	}
+	exportFixtures(t, parser.PylontechProfile, "pwr_us2000.txt", "bat_us2000.txt")
+	UpdateCellAggregates("default", "bat1", []parser.BatteryStatus{{ID: 0, Volt: 3306, Curr: -1459, SOC: -1}})
+
+	want := []struct {
+		name   string
+		labels map[string]string
+		value  float64
+	}{
+		{"devicemon_battery_voltage_volts", map[string]string{"id": "0"}, 3.306},
+		{"devicemon_battery_current_amps", map[string]string{"id": "0"}, -1.459},
+		{"devicemon_battery_coulomb_amp_hours", map[string]string{"id": "0"}, 43.5},
+		{"devicemon_battery_temp_celsius", map[string]string{"id": "0"}, 21.7},
+		{"devicemon_battery_cell_voltage_min_volts", map[string]string{"unit": "bat1"}, 3.306},
+		{"devicemon_battery_unit_current_amps", map[string]string{"unit": "bat1"}, -1.459},
+		{"devicemon_power_voltage_volts", map[string]string{"id": "1"}, 51.516},
+		{"devicemon_power_current_amps", map[string]string{"id": "1"}, -1.459},
+		{"devicemon_power_mos_temp_celsius", map[string]string{"id": "1"}, 32.4},
+	}
+	for _, w := range want {
+		if got := seriesValue(t, registry, w.name, w.labels); math.Abs(got-w.value) > 1e-9 {
+			t.Errorf("%s%v = %v, want %v", w.name, w.labels, got, w.value)
+		}
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather returned error: %v", err)
+	}
+	for _, family := range families {
+		if name := family.GetName(); name == "devicemon_battery_volt" || name == "devicemon_power_curr" {
+			t.Errorf("%s is exported with METRIC_UNITS=si", name)
+		}
+	}
+}
+
+func TestUpdateEventsCountsOnlyNewEntries(t *testing.T) {
+	registry, err := InitMetrics()
+	if err != nil {
+		t.Fatalf("InitMetrics returned error: %v", err)
+	}
+	if err := LoadEventState(""); err != nil {
+		t.Fatalf("LoadEventState returned error: %v", err)
+	}
+
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	history := []parser.Event{
+		{Index: 0, Time: at.Add(-time.Hour), Module: 2, Type: "Cell OV"},
+		{Index: 1, Time: at, Module: 2, Type: "Cell OV"},
+	}
+	ovCount := func() float64 {
+		return seriesValue(t, registry, "devicemon_battery_events_total", map[string]string{"unit": "bat2", "type": "cell_ov"})
+	}
+
+	// The first read only sets the mark
+	UpdateEvents("default", history)
+	if got := ovCount(); got != 0 {
+		t.Fatalf("events_total after the first read = %v, want 0", got)
+	}
+
+	// The full history is printed again with two entries added, one of them
+	// in the same second as the newest known entry
+	log := append(history,
+		parser.Event{Index: 2, Time: at, Module: 0, Type: "MOS OT"},
+		parser.Event{Index: 3, Time: at.Add(time.Minute), Module: 2, Type: "Cell OV"},
+	)
+	UpdateEvents("default", log)
+	UpdateEvents("default", log)
+	if got := ovCount(); got != 1 {
+		t.Fatalf("events_total{type=cell_ov} = %v, want 1", got)
+	}
+	if got := seriesValue(t, registry, "devicemon_battery_events_total", map[string]string{"unit": "stack", "type": "mos_ot"}); got != 1 {
+		t.Fatalf("events_total{type=mos_ot} = %v, want 1", got)
+	}
+	if got := seriesValue(t, registry, "devicemon_battery_last_event_timestamp_seconds", map[string]string{"unit": "bat2", "type": "cell_ov"}); got != float64(at.Add(time.Minute).Unix()) {
+		t.Fatalf("last_event_timestamp_seconds = %v, want %d", got, at.Add(time.Minute).Unix())
+	}
+}
+
+func TestEventStateSurvivesRestart(t *testing.T) {
+	registry, err := InitMetrics()
+	if err != nil {
+		t.Fatalf("InitMetrics returned error: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "events.json")
+	if err := LoadEventState(path); err != nil {
+		t.Fatalf("LoadEventState of a missing file returned error: %v", err)
+	}
+
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := UpdateEvents("default", []parser.Event{{Time: at, Module: 1, Type: "Cell UV"}}); err != nil {
+		t.Fatalf("UpdateEvents returned error: %v", err)
+	}
+
+	// A restarted exporter reads the mark back, so it counts the entry added
+	// while it was down but not the one it had already seen
+	registry, _ = InitMetrics()
+	if err := LoadEventState(path); err != nil {
+		t.Fatalf("LoadEventState returned error: %v", err)
+	}
+	UpdateEvents("default", []parser.Event{
+		{Time: at, Module: 1, Type: "Cell UV"},
+		{Time: at.Add(time.Second), Module: 1, Type: "Cell UV"},
+	})
+	if got := seriesValue(t, registry, "devicemon_battery_events_total", map[string]string{"unit": "bat1", "type": "cell_uv"}); got != 1 {
+		t.Fatalf("events_total after the restart = %v, want 1", got)
+	}
+}
+
+func TestBuildInfoAndRuntimeMetrics(t *testing.T) {
+	registry, err := InitMetrics()
+	if err != nil {
+		t.Fatalf("InitMetrics returned error: %v", err)
+	}
+	if got := seriesValue(t, registry, "devicemon_exporter_build_info", map[string]string{"version": "dev"}); got != 1 {
+		t.Fatalf("exporter_build_info = %v, want 1", got)
+	}
+	if hasFamily(t, registry, "go_goroutines") {
+		t.Fatal("go_goroutines is exported without ENABLE_RUNTIME_METRICS")
+	}
+
+	Configure(config.Metrics{Namespace: "devicemon", Units: "raw", Runtime: true})
+	t.Cleanup(func() { Configure(config.Default().Metrics) })
+	registry, err = InitMetrics()
+	if err != nil {
+		t.Fatalf("InitMetrics returned error: %v", err)
+	}
+	if !hasFamily(t, registry, "go_goroutines") {
+		t.Fatal("go_goroutines is not exported with ENABLE_RUNTIME_METRICS")
+	}
+}
+
+func hasFamily(t *testing.T, registry *prometheus.Registry, name string) bool {
+	t.Helper()
+	metricFamilies, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather returned error: %v", err)
+	}
+	for _, family := range metricFamilies {
+		if family.GetName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDeviceLabelsOnBatteryAndPowerSeries(t *testing.T) {
+	registry, err := InitMetrics()
+	if err != nil {
+		t.Fatalf("InitMetrics returned error: %v", err)
+	}
+	t.Cleanup(func() { deviceModels.labels = map[string][]*dto.LabelPair{} })
+
+	UpdatePowerMetrics("garage", parser.PowerStatus{ID: 1, Volt: 51516, Coulomb: 87})
+	UpdatePowerMetrics("basement", parser.PowerStatus{ID: 1, Volt: 51516, Coulomb: 87})
+	UpdateBatteryMetrics("garage", "bat1", parser.BatteryStatus{ID: 0, Volt: 3300})
+	RecordError("garage", "pwr_fetch")
+	SetDeviceModel("garage", "US5000", "1")
+
+	metricFamilies, err := WithDeviceLabels(registry).Gather()
+	if err != nil {
+		t.Fatalf("Gather returned error: %v", err)
+	}
+	for _, family := range metricFamilies {
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			labelled := labels["model"] == "US5000" && labels["firmware_major"] == "1"
+			switch name := family.GetName(); {
+			case name == "devicemon_scraper_errors_total":
+				if labelled {
+					t.Errorf("%s carries the model labels", name)
+				}
+			case strings.HasPrefix(name, "devicemon_battery_") || strings.HasPrefix(name, "devicemon_power_"):
+				if labelled != (labels["device"] == "garage") {
+					t.Errorf("%s%v: model labels only belong to the garage device", name, labels)
+				}
+			}
+		}
+	}
+}
+
+func TestSetFetchTimeouts(t *testing.T) {
+	registry, err := InitMetrics()
+	if err != nil {
+		t.Fatalf("InitMetrics returned error: %v", err)
+	}
+	SetFetchTimeouts(map[string]time.Duration{"pwr": 15 * time.Second, "bat": 2500 * time.Millisecond})
+	if got := seriesValue(t, registry, "devicemon_exporter_fetch_timeout_seconds", map[string]string{"command": "bat"}); got != 2.5 {
+		t.Fatalf("fetch_timeout_seconds{command=bat} = %v, want 2.5", got)
+	}
+	if got := seriesValue(t, registry, "devicemon_exporter_fetch_timeout_seconds", map[string]string{"command": "pwr"}); got != 15 {
+		t.Fatalf("fetch_timeout_seconds{command=pwr} = %v, want 15", got)
+	}
+}
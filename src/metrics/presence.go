@@ -0,0 +1,161 @@
+package metrics
+
+import (
+	"strconv"
+	"sync"
+
+	"pylontech_exporter/src/parser"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// presenceTracker remembers the cells and power modules exported in earlier
+// cycles, so series of ones that disappeared can be deleted instead of being
+// served with their last values forever.
+type presenceTracker struct {
+	mu    sync.Mutex
+	cells map[string]map[string]map[string]bool // device -> unit label -> cell ids
+	power map[string]map[string]bool            // device -> power ids
+}
+
+var presence = presenceTracker{
+	cells: map[string]map[string]map[string]bool{},
+	power: map[string]map[string]bool{},
+}
+
+// cellVecs returns the families labelled by unit and cell id.
+func cellVecs() []*prometheus.GaugeVec {
+	return []*prometheus.GaugeVec{
+		batteryVolt, batteryCurr, batteryTemp, batteryBaseState, batterySOC, batteryCoulomb, batteryBalanceActiveCount,
+		batteryPower,
+	}
+}
+
+// powerVecs returns the families labelled by device and power id.
+func powerVecs() []*prometheus.GaugeVec {
+	return []*prometheus.GaugeVec{powerVolt, powerCurr, powerBoardTemp, powerBaseState, powerSOC, powerMosTemp}
+}
+
+// SyncBatteryCells is called with the complete bat output of a unit. Cells
+// exported before but missing now lose their series, and
+// battery_present{unit,id} flips to 0 for them.
+func SyncBatteryCells(device, unitLabel string, statuses []parser.BatteryStatus) {
+	current := make(map[string]bool, len(statuses))
+	for _, status := range statuses {
+		current[strconv.Itoa(status.ID)] = true
+	}
+
+	presence.mu.Lock()
+	defer presence.mu.Unlock()
+
+	units := presence.cells[device]
+	if units == nil {
+		units = map[string]map[string]bool{}
+		presence.cells[device] = units
+	}
+	for id := range units[unitLabel] {
+		if !current[id] {
+			deleteSeries(cellVecs(), device, unitLabel, id)
+			forgetCellStates(device, unitLabel, id)
+			setGauge(batteryPresent, 0, device, unitLabel, id)
+		}
+	}
+	for id := range current {
+		setGauge(batteryPresent, 1, device, unitLabel, id)
+	}
+	units[unitLabel] = mergeSeen(units[unitLabel], current)
+}
+
+// RetireBatteryUnits drops the cell series of all units of a device not
+// listed in units, e.g. after a module left the stack or was ignored.
+func RetireBatteryUnits(device string, units []string) {
+	keep := make(map[string]bool, len(units))
+	for _, unit := range units {
+		keep[unit] = true
+	}
+
+	presence.mu.Lock()
+	defer presence.mu.Unlock()
+
+	for unitLabel, cells := range presence.cells[device] {
+		if keep[unitLabel] {
+			continue
+		}
+		for id := range cells {
+			deleteSeries(cellVecs(), device, unitLabel, id)
+			forgetCellStates(device, unitLabel, id)
+			setGauge(batteryPresent, 0, device, unitLabel, id)
+		}
+		deleteSeries([]*prometheus.GaugeVec{batterySOCEstimated, batterySOCDrift}, device, unitLabel)
+		deleteSeries(cellAggregateVecs(), device, unitLabel)
+		if batteryCellVoltHistogram != nil {
+			batteryCellVoltHistogram.DeleteLabelValues(device, unitLabel)
+		}
+		if unitLastSuccess != nil {
+			unitLastSuccess.DeletePartialMatch(prometheus.Labels{"device": device, "unit": unitLabel})
+		}
+		presence.cells[device][unitLabel] = map[string]bool{}
+	}
+}
+
+// SyncPowerModules is called with the complete pwr output, from which Absent
+// rows are already dropped. Modules exported before but missing now lose
+// their power and heater series, and power_present{device,id} flips to 0.
+func SyncPowerModules(device string, statuses []parser.PowerStatus) {
+	current := make(map[string]bool, len(statuses))
+	for _, status := range statuses {
+		current[strconv.Itoa(status.ID)] = true
+	}
+
+	presence.mu.Lock()
+	defer presence.mu.Unlock()
+
+	for id := range presence.power[device] {
+		if !current[id] {
+			deleteSeries(powerVecs(), device, id)
+			forgetStates("power", powerStateVecs(), prometheus.Labels{"device": device, "id": id}, device, id)
+			deleteSeries([]*prometheus.GaugeVec{batteryHeaterActive, batteryHeaterCurr}, device, "bat"+id)
+			setGauge(powerPresent, 0, device, id)
+		}
+	}
+	for id := range current {
+		setGauge(powerPresent, 1, device, id)
+	}
+	presence.power[device] = mergeSeen(presence.power[device], current)
+}
+
+// mergeSeen keeps ids seen in any cycle, so a module that comes back is
+// reported as present again.
+func mergeSeen(seen, current map[string]bool) map[string]bool {
+	if seen == nil {
+		seen = map[string]bool{}
+	}
+	for id := range current {
+		seen[id] = true
+	}
+	return seen
+}
+
+func deleteSeries(vecs []*prometheus.GaugeVec, labelValues ...string) {
+	for _, vec := range vecs {
+		if vec != nil {
+			vec.DeleteLabelValues(labelValues...)
+		}
+	}
+}
+
+// resetPresence forgets all tracked cells and modules.
+func resetPresence() {
+	presence.mu.Lock()
+	defer presence.mu.Unlock()
+	presence.cells = map[string]map[string]map[string]bool{}
+	presence.power = map[string]map[string]bool{}
+}
+
+// resetDevicePresence forgets the tracked cells and modules of one device.
+func resetDevicePresence(device string) {
+	presence.mu.Lock()
+	defer presence.mu.Unlock()
+	delete(presence.cells, device)
+	delete(presence.power, device)
+}
@@ -0,0 +1,120 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metricRegistrar registers metric families unless they are listed in
+// DISABLE_METRICS. Disabled families are left nil and skipped by setGauge and
+// incCounter, so they are neither registered nor updated.
+type metricRegistrar struct {
+	reg      prometheus.Registerer
+	disabled map[string]bool
+	known    []string
+	scaled   map[*prometheus.GaugeVec]bool // Families renamed for METRIC_UNITS=si
+}
+
+// newMetricRegistrar takes the disabled metric names with or without the
+// namespace prefix (e.g. "battery_curr" or "devicemon_battery_curr").
+func newMetricRegistrar(reg prometheus.Registerer, namespace string, disabledNames []string) *metricRegistrar {
+	disabled := make(map[string]bool)
+	for _, name := range disabledNames {
+		disabled[strings.TrimPrefix(name, namespace+"_")] = true
+	}
+	return &metricRegistrar{reg: reg, disabled: disabled, scaled: map[*prometheus.GaugeVec]bool{}}
+}
+
+func (r *metricRegistrar) enabled(subsystem, name string) bool {
+	metricName := subsystem + "_" + name
+	r.known = append(r.known, metricName)
+	return !r.disabled[metricName]
+}
+
+// gaugeVec registers a gauge family. With METRIC_UNITS=si, families in
+// millivolts or milliamps are registered under their SI name instead.
+func (r *metricRegistrar) gaugeVec(opts prometheus.GaugeOpts, labelNames []string) *prometheus.GaugeVec {
+	opts, scaled := siGaugeOpts(opts)
+	if !r.enabled(opts.Subsystem, opts.Name) {
+		return nil
+	}
+	vec := prometheus.NewGaugeVec(opts, labelNames)
+	r.reg.MustRegister(vec)
+	if scaled {
+		r.scaled[vec] = true
+	}
+	return vec
+}
+
+func (r *metricRegistrar) counterVec(opts prometheus.CounterOpts, labelNames []string) *prometheus.CounterVec {
+	if !r.enabled(opts.Subsystem, opts.Name) {
+		return nil
+	}
+	vec := prometheus.NewCounterVec(opts, labelNames)
+	r.reg.MustRegister(vec)
+	return vec
+}
+
+func (r *metricRegistrar) histogramVec(opts prometheus.HistogramOpts, labelNames []string) *prometheus.HistogramVec {
+	if !r.enabled(opts.Subsystem, opts.Name) {
+		return nil
+	}
+	vec := prometheus.NewHistogramVec(opts, labelNames)
+	r.reg.MustRegister(vec)
+	return vec
+}
+
+// validate reports disabled names that do not match any metric family, which
+// are almost always typos.
+func (r *metricRegistrar) validate() error {
+	known := make(map[string]bool, len(r.known))
+	for _, name := range r.known {
+		known[name] = true
+	}
+
+	var unknown []string
+	for name := range r.disabled {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown metric name(s) in DISABLE_METRICS: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+func setGauge(vec *prometheus.GaugeVec, value float64, labelValues ...string) {
+	if vec == nil {
+		return // Disabled
+	}
+	if siScaled[vec] {
+		value /= 1000
+	}
+	vec.WithLabelValues(labelValues...).Set(value)
+}
+
+func incCounter(vec *prometheus.CounterVec, labelValues ...string) {
+	if vec == nil {
+		return // Disabled
+	}
+	vec.WithLabelValues(labelValues...).Inc()
+}
+
+func addCounter(vec *prometheus.CounterVec, value float64, labelValues ...string) {
+	if vec == nil {
+		return // Disabled
+	}
+	vec.WithLabelValues(labelValues...).Add(value)
+}
+
+func observeHistogram(vec *prometheus.HistogramVec, value float64, labelValues ...string) {
+	if vec == nil {
+		return // Disabled
+	}
+	vec.WithLabelValues(labelValues...).Observe(value)
+}
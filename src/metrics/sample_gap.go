@@ -0,0 +1,25 @@
+package metrics
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// sampleMaxGap is the longest interval between two samples that the SOC
+// estimate and the stack energy counters still integrate. Longer gaps (missed
+// scrapes, restarts of the loop) pause the integration instead of
+// extrapolating the last reading across the gap.
+var sampleMaxGap atomic.Int64
+
+func init() {
+	sampleMaxGap.Store(int64(5 * time.Minute))
+}
+
+// SetSampleMaxGap sets the longest sample interval that is integrated.
+func SetSampleMaxGap(d time.Duration) {
+	sampleMaxGap.Store(int64(d))
+}
+
+func currentSampleMaxGap() time.Duration {
+	return time.Duration(sampleMaxGap.Load())
+}
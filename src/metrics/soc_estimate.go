@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"pylontech_exporter/src/parser"
+)
+
+var (
+	socEstimatorsMu sync.Mutex
+	socEstimators   = map[string]*socEstimator{}
+)
+
+// socEstimator integrates module current into an amp-hour counter. It is
+// anchored to the BMS-reported SOC on the first sample, so units that rarely
+// reach full still produce a drift figure, and re-anchored to 100% whenever
+// the BMS reports a full module.
+type socEstimator struct {
+	anchored     bool
+	remainingMAh float64
+	lastSample   time.Time
+}
+
+// sample feeds one reading and returns the estimated SOC in percent.
+func (e *socEstimator) sample(now time.Time, currMA, reportedSOC, capacityMAh float64, maxGap time.Duration) float64 {
+	switch {
+	case reportedSOC >= 100:
+		e.remainingMAh = capacityMAh
+		e.anchored = true
+	case !e.anchored:
+		e.remainingMAh = capacityMAh * reportedSOC / 100
+		e.anchored = true
+	default:
+		if dt := now.Sub(e.lastSample); !e.lastSample.IsZero() && dt > 0 && dt <= maxGap {
+			e.remainingMAh += currMA * dt.Hours()
+		}
+	}
+
+	if e.remainingMAh < 0 {
+		e.remainingMAh = 0
+	} else if e.remainingMAh > capacityMAh {
+		e.remainingMAh = capacityMAh
+	}
+	e.lastSample = now
+
+	return e.remainingMAh / capacityMAh * 100
+}
+
+// UpdateSOCEstimate integrates the current of a unit's bat rows and exports
+// the estimated SOC and its drift from the BMS-reported SOC. Capacity is
+// derived from the reported remaining capacity and SOC of the same rows.
+func UpdateSOCEstimate(device, unitLabel string, now time.Time, statuses []parser.BatteryStatus) {
+	var currSum, socSum, coulombSum float64
+	count := 0
+	for _, status := range statuses {
+		if status.SOC < 0 || status.Coulomb < 0 {
+			continue
+		}
+		currSum += float64(status.Curr)
+		socSum += float64(status.SOC)
+		coulombSum += float64(status.Coulomb)
+		count++
+	}
+	if count == 0 || socSum == 0 {
+		return // Capacity cannot be derived at 0% SOC
+	}
+
+	reportedSOC := socSum / float64(count)
+	capacityMAh := coulombSum / float64(count) * 100 / reportedSOC
+
+	socEstimatorsMu.Lock()
+	key := device + "/" + unitLabel
+	estimator, ok := socEstimators[key]
+	if !ok {
+		estimator = &socEstimator{}
+		socEstimators[key] = estimator
+	}
+	estimated := estimator.sample(now, currSum/float64(count), reportedSOC, capacityMAh, currentSampleMaxGap())
+	socEstimatorsMu.Unlock()
+
+	setGauge(batterySOCEstimated, estimated, device, unitLabel)
+	setGauge(batterySOCDrift, estimated-reportedSOC, device, unitLabel)
+}
@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+
+	"pylontech_exporter/src/parser"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// normalState is the state every field reports while nothing is wrong.
+const normalState = "Normal"
+
+// stateSeries is one state field of one cell or module.
+type stateSeries struct {
+	current string
+	seen    map[string]bool // states exported so far, always including Normal
+}
+
+// stateTracker remembers the states exported per field, so a state that is
+// left again drops to 0 instead of lingering at 1. Keys are
+// scope|label values|field, e.g. "battery|default|bat1|3|volt".
+type stateTracker struct {
+	mu     sync.Mutex
+	series map[string]*stateSeries
+}
+
+var states = stateTracker{series: map[string]*stateSeries{}}
+
+func batteryStateVecs() []*prometheus.GaugeVec {
+	return []*prometheus.GaugeVec{batteryVoltState, batteryCurrState, batteryTempState}
+}
+
+func powerStateVecs() []*prometheus.GaugeVec {
+	return []*prometheus.GaugeVec{powerVoltState, powerCurrState, powerTempState, powerBVState, powerBTState, powerMTState}
+}
+
+func updateBatteryStates(device, unitLabel, idStr string, status parser.BatteryStatus) {
+	setState("battery", batteryVoltState, batteryAlarmTransitions, "volt", status.VoltState, device, unitLabel, idStr)
+	setState("battery", batteryCurrState, batteryAlarmTransitions, "curr", status.CurrState, device, unitLabel, idStr)
+	setState("battery", batteryTempState, batteryAlarmTransitions, "temp", status.TempState, device, unitLabel, idStr)
+}
+
+func updatePowerStates(device, idStr string, status parser.PowerStatus) {
+	setState("power", powerVoltState, powerAlarmTransitions, "volt", status.VoltState, device, idStr)
+	setState("power", powerCurrState, powerAlarmTransitions, "curr", status.CurrState, device, idStr)
+	setState("power", powerTempState, powerAlarmTransitions, "temp", status.TempState, device, idStr)
+	setState("power", powerBVState, powerAlarmTransitions, "bv", status.BVState, device, idStr)
+	setState("power", powerBTState, powerAlarmTransitions, "bt", status.BTState, device, idStr)
+	setState("power", powerMTState, powerAlarmTransitions, "mt", status.MTState, device, idStr)
+}
+
+// setState exports state as 1 and every other state seen for the field as 0,
+// and counts a transition when the field leaves Normal. Fields the device
+// profile does not report are empty and skipped.
+func setState(scope string, vec *prometheus.GaugeVec, transitions *prometheus.CounterVec, field, state string, labelValues ...string) {
+	if state == "" {
+		return
+	}
+	key := scope + "|" + strings.Join(labelValues, "|") + "|" + field
+
+	states.mu.Lock()
+	defer states.mu.Unlock()
+
+	series := states.series[key]
+	if series == nil {
+		series = &stateSeries{seen: map[string]bool{normalState: true}}
+		states.series[key] = series
+	}
+	if series.current == normalState && state != normalState {
+		incCounter(transitions, append(labelValues, field)...)
+	}
+	series.current = state
+	series.seen[state] = true
+
+	for seen := range series.seen {
+		value := 0.0
+		if seen == state {
+			value = 1
+		}
+		setGauge(vec, value, append(labelValues, seen)...)
+	}
+}
+
+// forgetStates drops the state series of a cell or module that disappeared.
+// labels and labelValues name the same leading labels, e.g. device, unit and
+// id of a cell.
+func forgetStates(scope string, vecs []*prometheus.GaugeVec, labels prometheus.Labels, labelValues ...string) {
+	for _, vec := range vecs {
+		if vec != nil {
+			vec.DeletePartialMatch(labels)
+		}
+	}
+
+	prefix := scope + "|" + strings.Join(labelValues, "|") + "|"
+	states.mu.Lock()
+	defer states.mu.Unlock()
+	for key := range states.series {
+		if strings.HasPrefix(key, prefix) {
+			delete(states.series, key)
+		}
+	}
+}
+
+// forgetCellStates drops the state series of a cell.
+func forgetCellStates(device, unitLabel, id string) {
+	forgetStates("battery", batteryStateVecs(), prometheus.Labels{"device": device, "unit": unitLabel, "id": id}, device, unitLabel, id)
+}
+
+// resetStates forgets all tracked states.
+func resetStates() {
+	states.mu.Lock()
+	defer states.mu.Unlock()
+	states.series = map[string]*stateSeries{}
+}
+
+// resetDeviceStates forgets the tracked states of one device; its series
+// are deleted by ResetDeviceMetrics.
+func resetDeviceStates(device string) {
+	states.mu.Lock()
+	defer states.mu.Unlock()
+	for key := range states.series {
+		if strings.HasPrefix(key, "battery|"+device+"|") || strings.HasPrefix(key, "power|"+device+"|") {
+			delete(states.series, key)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// siNames maps the families exported in millivolts, milliamps and
+// milliampere-hours to their names with METRIC_UNITS=si, where they are
+// exported in volts, amps and ampere-hours instead.
+var siNames = map[string]string{
+	"battery_volt":                      "voltage_volts",
+	"battery_curr":                      "current_amps",
+	"battery_coulomb":                   "coulomb_amp_hours",
+	"battery_cell_volt_min":             "cell_voltage_min_volts",
+	"battery_cell_volt_max":             "cell_voltage_max_volts",
+	"battery_cell_volt_avg":             "cell_voltage_avg_volts",
+	"battery_cell_volt_delta":           "cell_voltage_delta_volts",
+	"battery_unit_curr_milliamps":       "unit_current_amps",
+	"battery_heater_current_ma":         "heater_current_amps",
+	"system_charge_voltage_limit_mv":    "charge_voltage_limit_volts",
+	"system_charge_current_limit_ma":    "charge_current_limit_amps",
+	"system_discharge_current_limit_ma": "discharge_current_limit_amps",
+	"stack_volt_millivolts":             "voltage_volts",
+	"stack_curr_milliamps":              "current_amps",
+	"power_volt":                        "voltage_volts",
+	"power_curr":                        "current_amps",
+}
+
+var siHelp = strings.NewReplacer("millivolts", "volts", "milliamps", "amps", "milliampere-hours", "ampere-hours")
+
+// siScaled holds the families whose values setGauge divides by 1000, i.e.
+// those renamed by siNames while METRIC_UNITS=si. It is only written by
+// initMetrics.
+var siScaled = map[*prometheus.GaugeVec]bool{}
+
+// siGaugeOpts returns opts with the SI name and help of a family listed in
+// siNames and reports whether its values have to be scaled.
+func siGaugeOpts(opts prometheus.GaugeOpts) (prometheus.GaugeOpts, bool) {
+	if settings.Units != "si" {
+		return opts, false
+	}
+	name, ok := siNames[opts.Subsystem+"_"+opts.Name]
+	if !ok {
+		return opts, false
+	}
+	opts.Name = name
+	opts.Help = siHelp.Replace(opts.Help)
+	return opts, true
+}
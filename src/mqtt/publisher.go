@@ -0,0 +1,267 @@
+// Package mqtt publishes the latest snapshot of each device to an MQTT broker
+// and announces the sensors through Home Assistant MQTT discovery.
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pylontech_exporter/src/parser"
+	"pylontech_exporter/src/snapshot"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	defaultTopicPrefix     = "pylontech"
+	defaultDiscoveryPrefix = "homeassistant"
+	defaultClientID        = "pylontech_exporter"
+)
+
+// Config holds the broker settings. Only Broker is required.
+type Config struct {
+	Broker          string // e.g. tcp://192.168.1.5:1883
+	Username        string
+	Password        string
+	ClientID        string
+	TopicPrefix     string
+	DiscoveryPrefix string
+}
+
+// Device is a stack whose snapshots are published.
+type Device struct {
+	Name  string
+	Store *snapshot.Store
+}
+
+type message struct {
+	topic   string
+	payload string
+	retain  bool
+}
+
+// sensor is a per-unit value published to <prefix>/<unit>/<key>.
+type sensor struct {
+	key         string
+	name        string
+	unit        string
+	deviceClass string
+	value       func(parser.PowerStatus) (string, bool)
+}
+
+var sensors = []sensor{
+	{key: "soc", name: "SOC", unit: "%", deviceClass: "battery", value: func(s parser.PowerStatus) (string, bool) {
+		return strconv.Itoa(s.Coulomb), s.Coulomb >= 0
+	}},
+	{key: "voltage", name: "Voltage", unit: "V", deviceClass: "voltage", value: func(s parser.PowerStatus) (string, bool) {
+		return formatMilli(s.Volt), true
+	}},
+	{key: "current", name: "Current", unit: "A", deviceClass: "current", value: func(s parser.PowerStatus) (string, bool) {
+		return formatMilli(s.Curr), true
+	}},
+	{key: "temperature", name: "Temperature", unit: "°C", deviceClass: "temperature", value: func(s parser.PowerStatus) (string, bool) {
+		return formatMilli(s.Temp), true
+	}},
+	{key: "base_state", name: "Base state", value: func(s parser.PowerStatus) (string, bool) {
+		return parser.BaseStateName(s.BaseState), true
+	}},
+}
+
+func formatMilli(milli int) string {
+	return strconv.FormatFloat(float64(milli)/1000.0, 'f', -1, 64)
+}
+
+type discoveryConfig struct {
+	Name              string          `json:"name"`
+	UniqueID          string          `json:"unique_id"`
+	StateTopic        string          `json:"state_topic"`
+	AvailabilityTopic string          `json:"availability_topic"`
+	UnitOfMeasurement string          `json:"unit_of_measurement,omitempty"`
+	DeviceClass       string          `json:"device_class,omitempty"`
+	StateClass        string          `json:"state_class,omitempty"`
+	Device            discoveryDevice `json:"device"`
+}
+
+type discoveryDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+}
+
+// publisher sends the snapshot of every device after each collection cycle.
+// It runs beside the collection loop, which never waits for the broker.
+type publisher struct {
+	cfg     Config
+	client  paho.Client
+	devices []Device
+
+	mu        sync.Mutex
+	announced map[string]bool // discovery topics published since the last connect
+}
+
+// Start connects to the broker in the background and publishes after every
+// completed collection cycle. While the broker is unreachable, cycles are
+// skipped and the client keeps reconnecting.
+func Start(cfg Config, devices []Device) error {
+	if u, err := url.Parse(cfg.Broker); err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("invalid MQTT broker '%s', expected e.g. tcp://host:1883", cfg.Broker)
+	}
+	if cfg.ClientID == "" {
+		cfg.ClientID = defaultClientID
+	}
+	if cfg.TopicPrefix == "" {
+		cfg.TopicPrefix = defaultTopicPrefix
+	}
+	if cfg.DiscoveryPrefix == "" {
+		cfg.DiscoveryPrefix = defaultDiscoveryPrefix
+	}
+
+	p := &publisher{cfg: cfg, devices: devices, announced: map[string]bool{}}
+	opts := paho.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(cfg.ClientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(10*time.Second).
+		SetMaxReconnectInterval(time.Minute).
+		SetWill(p.availabilityTopic(), "offline", 1, true).
+		SetOnConnectHandler(p.onConnect).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			slog.Warn("MQTT connection lost", "broker", cfg.Broker, "error", err)
+		})
+	p.client = paho.NewClient(opts)
+	p.client.Connect() // Completes in the background thanks to ConnectRetry
+
+	for _, device := range devices {
+		go p.run(device)
+	}
+	return nil
+}
+
+func (p *publisher) run(device Device) {
+	for {
+		<-device.Store.CycleDone()
+		latest, ok := device.Store.Latest()
+		if !ok || latest.Stale {
+			continue
+		}
+		p.publish(device.Name, latest.Power)
+	}
+}
+
+// onConnect marks the exporter online and announces the sensors again, as
+// the broker may have lost its retained messages.
+func (p *publisher) onConnect(client paho.Client) {
+	slog.Info("Connected to MQTT broker", "broker", p.cfg.Broker)
+	client.Publish(p.availabilityTopic(), 1, true, "online")
+
+	p.mu.Lock()
+	p.announced = map[string]bool{}
+	p.mu.Unlock()
+	for _, device := range p.devices {
+		if latest, ok := device.Store.Latest(); ok {
+			p.publish(device.Name, latest.Power)
+		}
+	}
+}
+
+// publish sends the discovery configs of units not yet announced and the
+// current values of all units. Tokens are not waited for.
+func (p *publisher) publish(device string, power []parser.PowerStatus) {
+	if !p.client.IsConnectionOpen() {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, msg := range p.discoveryMessages(device, power) {
+		if p.announced[msg.topic] {
+			continue
+		}
+		p.announced[msg.topic] = true
+		p.client.Publish(msg.topic, 1, msg.retain, msg.payload)
+	}
+	for _, msg := range p.stateMessages(device, power) {
+		p.client.Publish(msg.topic, 0, msg.retain, msg.payload)
+	}
+}
+
+func (p *publisher) availabilityTopic() string {
+	return p.cfg.TopicPrefix + "/status"
+}
+
+// unitTopic is <prefix>/<unit>, or <prefix>/<device>/<unit> when several
+// devices are published.
+func (p *publisher) unitTopic(device string, id int) string {
+	if len(p.devices) > 1 {
+		return fmt.Sprintf("%s/%s/bat%d", p.cfg.TopicPrefix, device, id)
+	}
+	return fmt.Sprintf("%s/bat%d", p.cfg.TopicPrefix, id)
+}
+
+func (p *publisher) stateMessages(device string, power []parser.PowerStatus) []message {
+	var messages []message
+	for _, status := range power {
+		for _, s := range sensors {
+			if value, ok := s.value(status); ok {
+				messages = append(messages, message{topic: p.unitTopic(device, status.ID) + "/" + s.key, payload: value})
+			}
+		}
+	}
+	return messages
+}
+
+func (p *publisher) discoveryMessages(device string, power []parser.PowerStatus) []message {
+	var messages []message
+	for _, status := range power {
+		unitID := objectID(p.cfg.TopicPrefix, device, "bat"+strconv.Itoa(status.ID))
+		unitName := fmt.Sprintf("Pylontech bat%d", status.ID)
+		if len(p.devices) > 1 {
+			unitName = fmt.Sprintf("Pylontech %s bat%d", device, status.ID)
+		}
+		for _, s := range sensors {
+			config := discoveryConfig{
+				Name:              s.name,
+				UniqueID:          unitID + "_" + s.key,
+				StateTopic:        p.unitTopic(device, status.ID) + "/" + s.key,
+				AvailabilityTopic: p.availabilityTopic(),
+				UnitOfMeasurement: s.unit,
+				DeviceClass:       s.deviceClass,
+				Device: discoveryDevice{
+					Identifiers:  []string{unitID},
+					Name:         unitName,
+					Manufacturer: "Pylontech",
+				},
+			}
+			if s.unit != "" {
+				config.StateClass = "measurement"
+			}
+			payload, _ := json.Marshal(config) // Cannot fail for this struct
+			messages = append(messages, message{
+				topic:   fmt.Sprintf("%s/sensor/%s/config", p.cfg.DiscoveryPrefix, config.UniqueID),
+				payload: string(payload),
+				retain:  true,
+			})
+		}
+	}
+	return messages
+}
+
+// objectID joins parts into an identifier Home Assistant accepts in topics
+// and unique IDs.
+func objectID(parts ...string) string {
+	id := strings.Join(parts, "_")
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, id)
+}
@@ -0,0 +1,69 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"testing"
+
+	"pylontech_exporter/src/parser"
+)
+
+var testPower = []parser.PowerStatus{
+	{ID: 2, Volt: 49512, Curr: -1250, Temp: 23000, BaseState: 1, Coulomb: 87},
+}
+
+func TestStateMessages(t *testing.T) {
+	p := &publisher{cfg: Config{TopicPrefix: "pylontech"}, devices: []Device{{Name: "default"}}}
+
+	got := map[string]string{}
+	for _, msg := range p.stateMessages("default", testPower) {
+		got[msg.topic] = msg.payload
+	}
+	want := map[string]string{
+		"pylontech/bat2/soc":         "87",
+		"pylontech/bat2/voltage":     "49.512",
+		"pylontech/bat2/current":     "-1.25",
+		"pylontech/bat2/temperature": "23",
+		"pylontech/bat2/base_state":  "Dischg",
+	}
+	for topic, payload := range want {
+		if got[topic] != payload {
+			t.Errorf("%s = %q, want %q", topic, got[topic], payload)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %d messages, want %d: %v", len(got), len(want), got)
+	}
+}
+
+func TestStateMessagesIncludeDeviceWithSeveralDevices(t *testing.T) {
+	p := &publisher{cfg: Config{TopicPrefix: "pylontech"}, devices: []Device{{Name: "garage"}, {Name: "basement"}}}
+
+	messages := p.stateMessages("garage", testPower)
+	if len(messages) == 0 || messages[0].topic != "pylontech/garage/bat2/soc" {
+		t.Fatalf("first message = %+v, want topic pylontech/garage/bat2/soc", messages)
+	}
+}
+
+func TestDiscoveryMessages(t *testing.T) {
+	p := &publisher{cfg: Config{TopicPrefix: "pylontech", DiscoveryPrefix: "homeassistant"}, devices: []Device{{Name: "default"}}}
+
+	messages := p.discoveryMessages("default", testPower)
+	if len(messages) != len(sensors) {
+		t.Fatalf("got %d discovery messages, want %d", len(messages), len(sensors))
+	}
+	msg := messages[0]
+	if msg.topic != "homeassistant/sensor/pylontech_default_bat2_soc/config" || !msg.retain {
+		t.Fatalf("discovery message = %+v, want retained homeassistant/sensor/pylontech_default_bat2_soc/config", msg)
+	}
+
+	var config discoveryConfig
+	if err := json.Unmarshal([]byte(msg.payload), &config); err != nil {
+		t.Fatalf("decoding discovery payload: %v", err)
+	}
+	if config.StateTopic != "pylontech/bat2/soc" || config.AvailabilityTopic != "pylontech/status" {
+		t.Errorf("topics = %q / %q, want pylontech/bat2/soc / pylontech/status", config.StateTopic, config.AvailabilityTopic)
+	}
+	if config.DeviceClass != "battery" || config.UnitOfMeasurement != "%" || config.StateClass != "measurement" {
+		t.Errorf("config = %+v, want a battery sensor in %%", config)
+	}
+}
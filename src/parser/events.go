@@ -0,0 +1,139 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is one entry of the event log printed by the 'log' command.
+type Event struct {
+	Index  int       `json:"index"`  // Position in the log, -1 when not printed
+	Time   time.Time `json:"time"`   // In the local time zone of the exporter; the device clock has none
+	Module int       `json:"module"` // Unit the event belongs to, 0 for the stack or when not printed
+	Type   string    `json:"type"`   // As printed, e.g. "Cell OV" or "0x21"
+}
+
+// eventTimePattern matches the timestamps of the log, with a two or four
+// digit year.
+var eventTimePattern = regexp.MustCompile(`(\d{2}|\d{4})[-/](\d{2})[-/](\d{2})[ T]+(\d{2}):(\d{2}):(\d{2})`)
+
+// eventRowPattern matches one row of the tabular layout:
+// [index] timestamp [module] type.
+var eventRowPattern = regexp.MustCompile(`^(?:(\d+)\s+)?(\d{2,4}[-/]\d{2}[-/]\d{2}[ T]+\d{2}:\d{2}:\d{2})\s+(?:(\d+)\s+)?(\S.*?)\s*$`)
+
+// eventLabelPattern matches one "Label : value" line of the block layout.
+var eventLabelPattern = regexp.MustCompile(`^([A-Za-z][A-Za-z .]*?)\s*:\s*(.*?)\s*$`)
+
+// ParseEvents parses the raw lines of a 'log' command output. Firmwares print
+// either one block of "Label : value" lines per event or one row per event;
+// both are accepted. Entries without a timestamp or type are skipped. Firmware
+// without the command yields ErrUnsupportedCommand.
+func ParseEvents(lines []string) ([]Event, error) {
+	if isUnsupportedCommand(lines) {
+		return nil, ErrUnsupportedCommand
+	}
+
+	var results []Event
+	foundTimestamp := false
+	block := Event{Index: -1}
+	blockStarted := false
+	flush := func() {
+		if blockStarted && !block.Time.IsZero() && block.Type != "" {
+			results = append(results, block)
+		}
+		block = Event{Index: -1}
+		blockStarted = false
+	}
+
+	for lineIdx, rawLine := range lines {
+		line := strings.TrimSpace(rawLine)
+		if eventTimePattern.MatchString(line) {
+			foundTimestamp = true
+		}
+
+		if m := eventRowPattern.FindStringSubmatch(line); m != nil {
+			flush()
+			at, err := parseEventTime(m[2])
+			if err != nil {
+				warnLine("log", "Skipping event with unparsable time", "time", lineIdx, rawLine, "error", err)
+				continue
+			}
+			event := Event{Index: -1, Time: at, Type: m[4]}
+			if m[1] != "" {
+				event.Index, _ = strconv.Atoi(m[1])
+			}
+			if m[3] != "" {
+				event.Module, _ = strconv.Atoi(m[3])
+			}
+			results = append(results, event)
+			continue
+		}
+
+		m := eventLabelPattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		value := m[2]
+		switch strings.ToLower(strings.Join(strings.Fields(m[1]), " ")) {
+		case "index", "no", "no.":
+			flush()
+			index, err := strconv.Atoi(value)
+			if err != nil {
+				continue
+			}
+			block.Index = index
+		case "time", "date", "date time":
+			if !block.Time.IsZero() {
+				flush() // A block without index line
+			}
+			at, err := parseEventTime(value)
+			if err != nil {
+				warnLine("log", "Skipping event with unparsable time", "time", lineIdx, rawLine, "error", err)
+				continue
+			}
+			block.Time = at
+		case "module", "unit", "bat", "battery", "pwr", "power", "addr", "address":
+			module, err := strconv.Atoi(value)
+			if err != nil {
+				continue
+			}
+			block.Module = module
+		case "event", "type", "info", "alarm", "protect":
+			if value == "" {
+				continue
+			}
+			block.Type = value
+		default:
+			continue
+		}
+		blockStarted = true
+	}
+	flush()
+
+	if len(results) == 0 && foundTimestamp {
+		return nil, fmt.Errorf("%w: no log entries parsed although some lines contain timestamps", ErrLayoutMismatch)
+	}
+	return results, nil
+}
+
+// parseEventTime parses a log timestamp. Two digit years are in the 2000s.
+func parseEventTime(value string) (time.Time, error) {
+	m := eventTimePattern.FindStringSubmatch(value)
+	if m == nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp '%s'", value)
+	}
+	var parts [6]int
+	for i := range parts {
+		parts[i], _ = strconv.Atoi(m[i+1])
+	}
+	if len(m[1]) == 2 {
+		parts[0] += 2000
+	}
+	if parts[1] < 1 || parts[1] > 12 || parts[2] < 1 || parts[2] > 31 || parts[3] > 23 || parts[4] > 59 || parts[5] > 59 {
+		return time.Time{}, fmt.Errorf("invalid timestamp '%s'", value)
+	}
+	return time.Date(parts[0], time.Month(parts[1]), parts[2], parts[3], parts[4], parts[5], 0, time.Local), nil
+}
@@ -0,0 +1,63 @@
+package parser
+
+import (
+	"log/slog"
+	"sort"
+	"sync"
+)
+
+// logger receives the parse warnings; see SetLogger.
+var logger = slog.Default()
+
+// SetLogger sets the logger of the parser, e.g. one with a component
+// attribute. It must be called before the first console output is parsed.
+func SetLogger(l *slog.Logger) {
+	logger = l
+}
+
+// repeatedWarnings counts warnings that were already logged once. A bad
+// firmware produces the same warning for every row of every cycle, so only
+// the first one is logged and the rest are summarised by FlushWarnings.
+var repeatedWarnings = struct {
+	sync.Mutex
+	counts map[string]int // Key of each logged warning -> repeats since the last flush
+}{counts: map[string]int{}}
+
+// warnLine logs a console line that could not be parsed. kind tells apart
+// problems of the same command, e.g. the column that failed; warnings with
+// the same command, message and kind are only logged the first time.
+func warnLine(command, msg, kind string, lineIdx int, line string, attrs ...any) {
+	key := command + ": " + msg + " (" + kind + ")"
+	repeatedWarnings.Lock()
+	count, seen := repeatedWarnings.counts[key]
+	if seen {
+		count++
+	}
+	repeatedWarnings.counts[key] = count
+	repeatedWarnings.Unlock()
+	if seen {
+		return
+	}
+
+	attrs = append([]any{"command", command, "line", lineIdx + 1, "raw", line}, attrs...)
+	logger.Warn(msg, attrs...)
+}
+
+// FlushWarnings logs how often each warning repeated since the previous call
+// without being logged. It is called once per collection cycle.
+func FlushWarnings() {
+	repeatedWarnings.Lock()
+	defer repeatedWarnings.Unlock()
+
+	keys := make([]string, 0, len(repeatedWarnings.counts))
+	for key, count := range repeatedWarnings.counts {
+		if count > 0 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		logger.Warn("Parse warning repeated", "warning", key, "count", repeatedWarnings.counts[key])
+		repeatedWarnings.counts[key] = 0
+	}
+}
@@ -1,8 +1,9 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"math"
 	"regexp"
 	"strconv"
 	"strings"
@@ -18,8 +19,8 @@ type BatteryStatus struct {
 	VoltState string `json:"volt_state"`
 	CurrState string `json:"curr_state"`
 	TempState string `json:"temp_state"`
-	SOC       int8   `json:"soc"`     // State of Charge in %
-	Coulomb   int    `json:"coulomb"` // Remaining capacity in mAH
+	SOC       int    `json:"soc"`     // State of Charge in %, -1 when it could not be parsed
+	Coulomb   int    `json:"coulomb"` // Remaining capacity in mAH, -1 when it could not be parsed
 	BAL       string `json:"bal"`     // Balance status (e.g., "0000000000000000")
 }
 
@@ -33,11 +34,18 @@ type PowerStatus struct {
 	VoltState string `json:"volt_state"`
 	CurrState string `json:"curr_state"`
 	TempState string `json:"temp_state"`
-	Coulomb   int8   `json:"coulomb"`
+	Coulomb   int    `json:"coulomb"` // State of Charge in %, -1 when it could not be parsed
 	BVState   string `json:"bv_state"`
 	BTState   string `json:"bt_state"`
-	MosTemp   string `json:"mos_temp"`
-	MTState   string `json:"mt_state"`
+	MosTemp   string `json:"mos_temp"` // As reported, in the firmware's temperature unit
+	// MosTempMilli is MosTemp in milli-degrees Celsius, scaled like Temp;
+	// MosTempValid is false when MosTemp is not a number.
+	MosTempMilli int    `json:"-"`
+	MosTempValid bool   `json:"-"`
+	MTState      string `json:"mt_state"`
+	// Heater columns only exist on low-temperature models; -1 when absent.
+	HeaterActive int8 `json:"heater_active"`
+	HeaterCurr   int  `json:"heater_curr"` // Heater current in mA
 }
 
 // BatteryStatStatus holds aggregated statistics from the 'stat N' command.
@@ -50,6 +58,38 @@ type BatteryStatStatus struct {
 	SocSec     map[string]float64 `json:"soc_sec"`
 }
 
+// SOHStatus holds the state of health of a module from the 'soh N' command.
+type SOHStatus struct {
+	Percent float64 `json:"percent"` // State of health in %, -1 when not reported
+	Cycles  float64 `json:"cycles"`  // Charge cycle count, -1 when not reported
+}
+
+// DeviceInfo holds the identity fields of the 'info' command output.
+type DeviceInfo struct {
+	Manufacturer     string `json:"manufacturer"`
+	DeviceName       string `json:"device_name"` // Model, e.g. "US2000C"
+	BoardVersion     string `json:"board_version"`
+	FirmwareVersion  string `json:"firmware_version"`  // "Main Soft version", or "Soft version" if absent
+	Barcode          string `json:"barcode"`           // Serial number printed on the module
+	SpecificCapacity int    `json:"specific_capacity"` // Nominal capacity in mAh from "Specification", -1: not reported
+}
+
+// SystemStatus holds the stack-level values from the 'pwrsys' command.
+type SystemStatus struct {
+	ChargeEnabled    int8 `json:"charge_enabled"`    // 1: enabled, 0: disabled, -1: not reported
+	DischargeEnabled int8 `json:"discharge_enabled"` // 1: enabled, 0: disabled, -1: not reported
+	ChargeVoltLimit  int  `json:"charge_volt_limit"` // Requested charge voltage in mV, -1: not reported
+	ChargeCurrLimit  int  `json:"charge_curr_limit"` // Charge current limit in mA, -1: not reported
+	DsgCurrLimit     int  `json:"dsg_curr_limit"`    // Discharge current limit magnitude in mA, -1: not reported
+}
+
+// StackPower holds the aggregated stack values from the 'power' command.
+type StackPower struct {
+	Volt  int     `json:"volt"`  // Stack voltage in mV
+	Curr  int     `json:"curr"`  // Stack current in mA, positive while charging
+	Power float64 `json:"power"` // Stack power in W, calculated from Volt and Curr when not reported
+}
+
 // baseStateMap maps string representations of base states to their int8 values.
 var baseStateMap = map[string]int8{
 	"Charge":  0,
@@ -59,14 +99,28 @@ var baseStateMap = map[string]int8{
 	"N/A":     -1, // Placeholder for unknown or not applicable states
 }
 
-// parseSOC converts a string like "85%" to an int8 value 85.
-func parseSOC(s string) (int8, error) {
+// BaseStateName returns the console name of a parsed base state, "N/A" for
+// unknown states.
+func BaseStateName(state int8) string {
+	for name, value := range baseStateMap {
+		if value == state {
+			return name
+		}
+	}
+	return "N/A"
+}
+
+// parseSOC converts a string like "85%" or "85" to the value 85.
+func parseSOC(s string) (int, error) {
 	s = strings.TrimSuffix(s, "%")
 	n, err := strconv.Atoi(s)
 	if err != nil {
 		return 0, fmt.Errorf("failed to parse SOC '%s': %w", s, err)
 	}
-	return int8(n), nil
+	if n < 0 {
+		return 0, fmt.Errorf("SOC '%s' is negative", s)
+	}
+	return n, nil
 }
 
 // parseCoulomb expects the numeric part and the unit (though unit isn't used here).
@@ -79,13 +133,6 @@ func parseCoulomb(s1 string, s2 string /* unit */) (int, error) {
 	return n, nil
 }
 
-func parseBaseState(s string) int8 {
-	if val, ok := baseStateMap[s]; ok {
-		return val
-	}
-	return -1 // Unknown state
-}
-
 func parseInt(s string, fieldName string) (int, error) {
 	n, err := strconv.Atoi(strings.TrimSpace(s))
 	if err != nil {
@@ -94,6 +141,25 @@ func parseInt(s string, fieldName string) (int, error) {
 	return n, nil
 }
 
+// parseTemp parses a signed temperature reading such as "-35", "+21" or
+// "-3.5" and converts it to milli-degrees Celsius using scale (the number of
+// milli-degrees per reported unit). The sign is kept through the scaling.
+func parseTemp(s string, scale int, fieldName string) (int, error) {
+	value, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s '%s': %w", fieldName, s, err)
+	}
+	return int(math.Round(value * float64(scale))), nil
+}
+
+// implausibleTemp reports a temperature in milli-degrees C that the BMS calls
+// Normal although it is below 1 °C or above 150 °C, which is what a TempScale
+// that does not match the firmware produces: deci-degree readings ("217") on
+// the milli-degree default profile come out as 0.217 °C.
+func implausibleTemp(milli int, state string) bool {
+	return state == "Normal" && (milli > -1000 && milli < 1000 || milli > 150000)
+}
+
 func parseFloat(s string, fieldName string) (float64, error) {
 	n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
 	if err != nil {
@@ -102,6 +168,99 @@ func parseFloat(s string, fieldName string) (float64, error) {
 	return n, nil
 }
 
+// optionalField returns the field at idx, or "" when the layout does not
+// have the column (idx -1).
+func optionalField(fields []string, idx int) string {
+	if idx < 0 || idx >= len(fields) {
+		return ""
+	}
+	return fields[idx]
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+// isSpace matches the ASCII whitespace recognised by strings.Fields, so row
+// detection and splitFields agree on where fields end.
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\v' || b == '\f' || b == '\r'
+}
+
+func skipDigits(s string, i int) int {
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return i
+}
+
+func skipSpaces(s string, i int) int {
+	for i < len(s) && isSpace(s[i]) {
+		i++
+	}
+	return i
+}
+
+// leadingNumber reports whether line starts with an all-digit token followed
+// by whitespace, returning the index of the next token.
+func leadingNumber(line string) (int, bool) {
+	start := skipSpaces(line, 0)
+	end := skipDigits(line, start)
+	if end == start {
+		return 0, false
+	}
+	next := skipSpaces(line, end)
+	if next == end {
+		return 0, false
+	}
+	return next, true
+}
+
+// isBATDataLine is equivalent to matching `^\s*\d+\s+[-+]?\d`, with \s also
+// taking \v (see isSpace): a numeric ID followed by a token starting with a
+// number. The sign keeps rows whose second column is negative, e.g. a
+// discharge current in clone layouts.
+func isBATDataLine(line string) bool {
+	next, ok := leadingNumber(line)
+	if ok && next < len(line) && (line[next] == '-' || line[next] == '+') {
+		next++
+	}
+	return ok && next < len(line) && isDigit(line[next])
+}
+
+// isPWRDataLine is equivalent to matching `^\s*\d+\s+`.
+func isPWRDataLine(line string) bool {
+	_, ok := leadingNumber(line)
+	return ok
+}
+
+// splitFields behaves like strings.Fields but reuses dst to avoid allocating
+// a new slice for every console line. Non-ASCII input falls back to
+// strings.Fields so Unicode whitespace is handled identically.
+func splitFields(line string, dst []string) []string {
+	dst = dst[:0]
+	for i := 0; i < len(line); i++ {
+		if line[i] >= 0x80 {
+			return append(dst, strings.Fields(line)...)
+		}
+	}
+
+	i := 0
+	for i < len(line) {
+		for i < len(line) && isSpace(line[i]) {
+			i++
+		}
+		start := i
+		for i < len(line) && !isSpace(line[i]) {
+			i++
+		}
+		if i > start {
+			dst = append(dst, line[start:i])
+		}
+	}
+	return dst
+}
+
 func normalizeStatRange(raw string) string {
 	label := strings.ToLower(strings.TrimSpace(raw))
 	label = strings.ReplaceAll(label, " ", "")
@@ -189,75 +348,476 @@ func ParseSTAT(lines []string) (BatteryStatStatus, error) {
 	return result, nil
 }
 
-// ParseBAT parses the raw lines from the 'bat' command output.
+// ErrUnsupportedCommand is returned when the console rejects a command the
+// firmware does not implement.
+var ErrUnsupportedCommand = errors.New("command not supported by the firmware")
+
+// ErrLayoutMismatch is returned by ParseBAT, ParsePWR and ParseEvents when
+// lines look like data rows but none of them could be parsed, e.g. because
+// DEVICE_PROFILE does not match the firmware. Output without data rows, such
+// as a stack without modules, parses to no records and no error.
+var ErrLayoutMismatch = errors.New("console output does not match the expected layout")
+
+// isUnsupportedCommand reports whether the console answered with its
+// invalid/unknown command message.
+func isUnsupportedCommand(lines []string) bool {
+	for _, line := range lines {
+		lower := strings.ToLower(line)
+		if strings.Contains(lower, "invalid command") || strings.Contains(lower, "unknown command") {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseSOH parses the raw lines from a 'soh N' command output. Firmware
+// without the command yields ErrUnsupportedCommand.
+func ParseSOH(lines []string) (SOHStatus, error) {
+	result := SOHStatus{Percent: -1, Cycles: -1}
+	if isUnsupportedCommand(lines) {
+		return result, ErrUnsupportedCommand
+	}
+
+	valueLineRegex := regexp.MustCompile(`^(.+?)\s*:\s*(-?\d+(?:\.\d+)?)\s*%?\s*$`)
+	for _, rawLine := range lines {
+		m := valueLineRegex.FindStringSubmatch(strings.TrimSpace(rawLine))
+		if len(m) != 3 {
+			continue
+		}
+		value, err := parseFloat(m[2], "SOH value")
+		if err != nil {
+			continue
+		}
+
+		switch strings.ToLower(strings.Join(strings.Fields(m[1]), " ")) {
+		case "soh", "soh(%)", "soh %":
+			result.Percent = value
+		case "cycle times", "cycles", "cycle count", "cycle":
+			result.Cycles = value
+		}
+	}
+
+	if result.Percent < 0 && result.Cycles < 0 {
+		return result, fmt.Errorf("no SOH values could be parsed")
+	}
+	return result, nil
+}
+
+// specCapacityPattern extracts the capacity of a "Specification" value
+// like "48V/50AH".
+var specCapacityPattern = regexp.MustCompile(`(?i)(\d+(?:\.\d+)?)\s*AH\b`)
+
+// ParseInfo parses the raw lines from the 'info' command output.
+func ParseInfo(lines []string) (DeviceInfo, error) {
+	result := DeviceInfo{SpecificCapacity: -1}
+	softVersion := ""
+
+	for _, rawLine := range lines {
+		label, value, ok := strings.Cut(strings.TrimSpace(rawLine), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+
+		switch strings.ToLower(strings.Join(strings.Fields(label), " ")) {
+		case "barcode", "serial number":
+			result.Barcode = value
+		case "manufacturer":
+			result.Manufacturer = value
+		case "device name":
+			result.DeviceName = value
+		case "board version":
+			result.BoardVersion = value
+		case "main soft version":
+			result.FirmwareVersion = value
+		case "soft version":
+			softVersion = value
+		case "specification":
+			if match := specCapacityPattern.FindStringSubmatch(value); match != nil {
+				if ah, err := strconv.ParseFloat(match[1], 64); err == nil {
+					result.SpecificCapacity = int(math.Round(ah * 1000))
+				}
+			}
+		}
+	}
+
+	if result.FirmwareVersion == "" {
+		result.FirmwareVersion = softVersion
+	}
+	if result.Barcode == "" {
+		return result, fmt.Errorf("no barcode found in INFO output")
+	}
+
+	return result, nil
+}
+
+// FirmwareMajor returns the major version of a firmware version like "V2.5"
+// or "B66.6", its first run of digits, or "" when it has none.
+func FirmwareMajor(version string) string {
+	return firmwareMajorPattern.FindString(version)
+}
+
+var firmwareMajorPattern = regexp.MustCompile(`\d+`)
+
+// parseValueWithUnit parses the leading integer of a value like "53250 mV".
+func parseValueWithUnit(s string, fieldName string) (int, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("failed to parse %s: empty value", fieldName)
+	}
+	return parseInt(fields[0], fieldName)
+}
+
+// parseEnableFlag converts the enable/disable wording used by the console
+// into 1/0, returning false for anything unrecognised.
+func parseEnableFlag(s string) (int8, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "yes", "y", "enable", "enabled", "on", "true", "1":
+		return 1, true
+	case "no", "n", "disable", "disabled", "off", "false", "0":
+		return 0, true
+	}
+	return 0, false
+}
+
+// parseHeaterState converts the heater status column into 1 (heating) or 0.
+func parseHeaterState(s string) (int8, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "heating", "heat":
+		return 1, true
+	case "idle", "normal", "stop", "-":
+		return 0, true
+	}
+	return parseEnableFlag(s)
+}
+
+// ParsePWRSYS parses the raw lines from the 'pwrsys' command output. Values
+// the firmware does not report are left at -1.
+func ParsePWRSYS(lines []string) (SystemStatus, error) {
+	result := SystemStatus{
+		ChargeEnabled:    -1,
+		DischargeEnabled: -1,
+		ChargeVoltLimit:  -1,
+		ChargeCurrLimit:  -1,
+		DsgCurrLimit:     -1,
+	}
+
+	labelValueRegex := regexp.MustCompile(`^(.+?)\s*:\s*(.+?)\s*$`)
+	foundValueLine := false
+
+	for _, rawLine := range lines {
+		m := labelValueRegex.FindStringSubmatch(strings.TrimSpace(rawLine))
+		if len(m) != 3 {
+			continue
+		}
+		foundValueLine = true
+
+		label := strings.ToLower(strings.Join(strings.Fields(m[1]), " "))
+		switch label {
+		case "charge enable", "chg enable", "charge mos", "chg mos", "charge fet", "chg fet":
+			if flag, ok := parseEnableFlag(m[2]); ok {
+				result.ChargeEnabled = flag
+			}
+		case "discharge enable", "dsg enable", "discharge mos", "dsg mos", "discharge fet", "dsg fet":
+			if flag, ok := parseEnableFlag(m[2]); ok {
+				result.DischargeEnabled = flag
+			}
+		case "recommend chg voltage", "charge voltage limit":
+			if n, err := parseValueWithUnit(m[2], "PWRSYS charge voltage limit"); err == nil {
+				result.ChargeVoltLimit = n
+			}
+		case "recommend chg current", "charge current limit":
+			if n, err := parseValueWithUnit(m[2], "PWRSYS charge current limit"); err == nil {
+				result.ChargeCurrLimit = n
+			}
+		case "recommend dsg current", "discharge current limit":
+			if n, err := parseValueWithUnit(m[2], "PWRSYS discharge current limit"); err == nil {
+				if n < 0 {
+					n = -n // Some firmware reports the discharge limit as a negative current
+				}
+				result.DsgCurrLimit = n
+			}
+		}
+	}
+
+	if !foundValueLine {
+		return result, fmt.Errorf("no PWRSYS values could be parsed")
+	}
+
+	return result, nil
+}
+
+// ParsePower parses the raw lines from the 'power' command output. Voltage
+// and current are required; the power is calculated from them when the
+// firmware does not report it. Firmware without the command yields
+// ErrUnsupportedCommand.
+func ParsePower(lines []string) (StackPower, error) {
+	var result StackPower
+	if isUnsupportedCommand(lines) {
+		return result, ErrUnsupportedCommand
+	}
+
+	labelValueRegex := regexp.MustCompile(`^(.+?)\s*:\s*(.+?)\s*$`)
+	foundVolt, foundCurr, foundPower := false, false, false
+
+	for _, rawLine := range lines {
+		m := labelValueRegex.FindStringSubmatch(strings.TrimSpace(rawLine))
+		if len(m) != 3 {
+			continue
+		}
+
+		label := strings.ToLower(strings.Join(strings.Fields(m[1]), " "))
+		switch label {
+		case "volt", "voltage", "system volt", "system voltage", "total volt", "total voltage":
+			if n, err := parseScaledValue(m[2], "v", "mv", "POWER voltage"); err == nil {
+				result.Volt = int(math.Round(n))
+				foundVolt = true
+			}
+		case "curr", "current", "system curr", "system current", "total curr", "total current":
+			if n, err := parseScaledValue(m[2], "a", "ma", "POWER current"); err == nil {
+				result.Curr = int(math.Round(n))
+				foundCurr = true
+			}
+		case "power", "system power", "total power":
+			if n, err := parseScaledValue(m[2], "w", "w", "POWER power"); err == nil {
+				result.Power = n / 1000
+				foundPower = true
+			}
+		}
+	}
+
+	if !foundVolt || !foundCurr {
+		return result, fmt.Errorf("no POWER voltage and current could be parsed")
+	}
+	if !foundPower {
+		result.Power = float64(result.Volt) * float64(result.Curr) / 1e6
+	}
+
+	return result, nil
+}
+
+// parseScaledValue parses a value such as "49512 mV", "49.5 V" or "-2.1 kW"
+// into thousandths of baseUnit. Values without a unit are in defaultUnit.
+func parseScaledValue(s, baseUnit, defaultUnit, fieldName string) (float64, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("failed to parse %s: empty value", fieldName)
+	}
+	value, err := parseFloat(fields[0], fieldName)
+	if err != nil {
+		return 0, err
+	}
+	unit := defaultUnit
+	if len(fields) > 1 {
+		unit = strings.ToLower(fields[1])
+	}
+
+	switch unit {
+	case "m" + baseUnit:
+		return value, nil
+	case baseUnit:
+		return value * 1000, nil
+	case "k" + baseUnit:
+		return value * 1000000, nil
+	}
+	return 0, fmt.Errorf("failed to parse %s '%s': unknown unit", fieldName, s)
+}
+
+// ParseBAT parses the raw lines from the 'bat' command output using DefaultProfile.
 func ParseBAT(lines []string) ([]BatteryStatus, error) {
+	return DefaultProfile.ParseBAT(lines)
+}
+
+// headingReplacer drops the dots and underscores of 'bat' column headings.
+var headingReplacer = strings.NewReplacer(".", "", "_", "")
+
+// batHeadings maps the normalised 'bat' column headings of the known
+// firmware generations to BATColumns names. Headings are lower-cased without
+// dots and underscores, and a trailing "State"/"St" word is joined to its
+// column ("Volt. State" becomes "voltstate").
+var batHeadings = map[string]string{
+	"battery":   "id",
+	"bat":       "id",
+	"cell":      "id",
+	"volt":      "volt",
+	"curr":      "curr",
+	"tempr":     "temp",
+	"tmpr":      "temp",
+	"temp":      "temp",
+	"basestate": "base_state",
+	"basest":    "base_state",
+	"voltstate": "volt_state",
+	"voltst":    "volt_state",
+	"currstate": "curr_state",
+	"currst":    "curr_state",
+	"tempstate": "temp_state",
+	"tempst":    "temp_state",
+	"soc":       "soc",
+	"coulomb":   "coulomb",
+	"bal":       "bal",
+}
+
+// parseBATHeader derives data-field positions from a 'bat' header row such as
+// "Battery  Volt  Curr  Tempr  Base State ...". The Coulomb value is followed
+// by its unit and the Time column holds a date and a time, so both occupy two
+// fields in data rows; unknown headings (e.g. B.V.St) occupy one. It reports
+// false unless the row names the ID, Volt, Curr and Tempr columns.
+func parseBATHeader(line string) (batLayout, bool) {
+	// Most non-data lines are prompts and banners; reject them by their first
+	// word before allocating anything
+	first := line
+	for i := 0; i < len(line); i++ {
+		if isSpace(line[i]) {
+			first = line[:i]
+			break
+		}
+	}
+	if !isIDHeading(first) {
+		return batLayout{}, false
+	}
+
+	var headings []string
+	for _, word := range strings.Fields(line) {
+		word = strings.ToLower(headingReplacer.Replace(word))
+		if (word == "state" || word == "st") && len(headings) > 0 {
+			headings[len(headings)-1] += word
+			continue
+		}
+		headings = append(headings, word)
+	}
+
+	// Fields without a recognised column are named "" and skipped
+	columns := make([]string, 0, len(headings)+2)
+	var hasVolt, hasCurr, hasTemp bool
+	fields := 0
+	for _, heading := range headings {
+		column := batHeadings[heading]
+		columns = append(columns, column)
+		switch column {
+		case "volt":
+			hasVolt = true
+		case "curr":
+			hasCurr = true
+		case "temp":
+			hasTemp = true
+		}
+		if column != "" {
+			fields = len(columns) // Trailing unused columns may be left out of data rows
+		}
+		if heading == "coulomb" || heading == "time" {
+			columns = append(columns, "")
+		}
+	}
+	if !hasVolt || !hasCurr || !hasTemp {
+		return batLayout{}, false
+	}
+
+	layout := Profile{BATColumns: columns}.batLayout()
+	layout.fields = fields
+	return layout, true
+}
+
+// isIDHeading reports whether word names the ID column of a 'bat' header,
+// ignoring case.
+func isIDHeading(word string) bool {
+	for heading, column := range batHeadings {
+		if column == "id" && strings.EqualFold(word, heading) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseBAT parses the raw lines from the 'bat' command output. A header row
+// selects the columns by name, so firmware with extra or missing columns is
+// supported; without one the profile's BATColumns are used.
+func (profile Profile) ParseBAT(lines []string) ([]BatteryStatus, error) {
 	var results []BatteryStatus
-	// Regex to identify data lines. Example: "0   3750  0    301 Charge Normal Normal Normal 85% 3450 mAH 0000000000000000"
-	// It should match lines starting with numbers, followed by various fields.
-	// Adjust regex if header lines or other non-data lines are present and need skipping.
-	dataRegex := regexp.MustCompile(`^\s*\d+\s+\d+`) // Matches lines starting with at least two numbers (ID, Volt)
+	layout := profile.batLayout()
+	// Data lines start with at least two numbers (ID, Volt), e.g.
+	// "0   3750  0    21000 Charge Normal Normal Normal 85% 3450 mAH 0000000000000000".
+	// Header and other non-data lines are skipped by isBATDataLine.
+	var fields []string
+	header := "" // Paged output repeats the header row on every page
 
 	for lineIdx, line := range lines { // Added lineIdx for logging
 		line = strings.TrimSpace(line)
-		if !dataRegex.MatchString(line) || line == "" {
-			// log.Printf("Skipping non-data line (BAT) or empty line: '%s'", line) // Example logging
+		if !isBATDataLine(line) {
+			if line == header {
+				continue
+			}
+			if headerLayout, ok := parseBATHeader(line); ok {
+				layout, header = headerLayout, line
+			}
 			continue // Skip header or malformed lines
 		}
 
-		fields := strings.Fields(line)
-		// Expected fields: ID, Volt, Curr, Temp, BaseState, VoltState, CurrState, TempState, SOC, CoulombVal, CoulombUnit, BAL
-		if len(fields) < 12 { // Ensure enough fields are present
-			log.Printf("Skipping line %d (BAT) due to insufficient fields (got %d, expected at least 12): '%s'", lineIdx+1, len(fields), line)
+		fields = splitFields(line, fields)
+		// Expected fields are listed in profile.BATColumns
+		if len(fields) < layout.fields { // Ensure enough fields are present
+			warnLine("bat", "Skipping line with too few fields", strconv.Itoa(len(fields))+" fields", lineIdx, line, "fields", len(fields), "expected", layout.fields)
 			continue
 		}
 
 		var status BatteryStatus
 		var err error
 
-		status.ID, err = parseInt(fields[0], "BAT ID")
+		status.ID, err = parseInt(fields[layout.id], "BAT ID")
 		if err != nil {
-			log.Printf("Error parsing BAT ID on line %d: %v. Line: '%s'", lineIdx+1, err, line)
+			warnLine("bat", "Skipping line with unparsable field", "id", lineIdx, line, "error", err)
 			continue
 		}
 
-		status.Volt, err = parseInt(fields[1], "BAT Volt") // Assuming mV
+		status.Volt, err = parseInt(fields[layout.volt], "BAT Volt") // Assuming mV
 		if err != nil {
-			log.Printf("Error parsing BAT Volt for ID %d on line %d: %v. Line: '%s'", status.ID, lineIdx+1, err, line)
+			warnLine("bat", "Skipping line with unparsable field", "volt", lineIdx, line, "id", status.ID, "error", err)
 			continue
 		}
 
-		status.Curr, err = parseInt(fields[2], "BAT Curr") // Assuming mA
+		status.Curr, err = parseInt(fields[layout.curr], "BAT Curr") // Assuming mA
 		if err != nil {
-			log.Printf("Error parsing BAT Curr for ID %d on line %d: %v. Line: '%s'", status.ID, lineIdx+1, err, line)
+			warnLine("bat", "Skipping line with unparsable field", "curr", lineIdx, line, "id", status.ID, "error", err)
 			continue
 		}
 
-		// Temperature is in 0.1 C, e.g., "301" means 30.1 C
-		status.Temp, err = parseInt(fields[3], "BAT Temp")
+		// Temperature unit depends on the firmware; profile.TempScale converts it to milli-degrees C
+		status.Temp, err = parseTemp(fields[layout.temp], profile.TempScale, "BAT Temp")
 		if err != nil {
-			log.Printf("Error parsing BAT Temp for ID %d on line %d: %v. Line: '%s'", status.ID, lineIdx+1, err, line)
+			warnLine("bat", "Skipping line with unparsable field", "temp", lineIdx, line, "id", status.ID, "error", err)
 			continue
 		}
 
-		status.BaseState = parseBaseState(fields[4])
-		status.VoltState = fields[5]
-		status.CurrState = fields[6]
-		status.TempState = fields[7]
+		status.BaseState = -1
+		if layout.baseState >= 0 {
+			status.BaseState = profile.parseBaseState(fields[layout.baseState])
+		}
+		status.VoltState = optionalField(fields, layout.voltState)
+		status.CurrState = optionalField(fields, layout.currState)
+		status.TempState = optionalField(fields, layout.tempState)
+		if implausibleTemp(status.Temp, status.TempState) {
+			warnLine("bat", "Temperature out of range for the temperature scale, check TEMP_SCALE", "temp_scale", lineIdx, line, "id", status.ID, "temp_scale", profile.TempScale)
+		}
 
-		status.SOC, err = parseSOC(fields[8])
-		if err != nil {
-			log.Printf("Warning parsing SOC for BAT ID %d on line %d: %v. Line: '%s'", status.ID, lineIdx+1, err, line)
-			status.SOC = -1 // Indicate parsing failure for SOC
+		status.SOC = -1
+		if layout.soc >= 0 {
+			status.SOC, err = parseSOC(fields[layout.soc])
+			if err != nil {
+				warnLine("bat", "Could not parse optional field", "soc", lineIdx, line, "id", status.ID, "error", err)
+				status.SOC = -1 // Indicate parsing failure for SOC
+			}
 		}
 
-		// Coulomb parsing: fields[9] is value, fields[10] is unit "mAH"
-		status.Coulomb, err = parseCoulomb(fields[9], fields[10])
-		if err != nil {
-			log.Printf("Warning parsing Coulomb for BAT ID %d on line %d: %v. Line: '%s'", status.ID, lineIdx+1, err, line)
-			status.Coulomb = -1 // Indicate parsing failure
+		// Coulomb parsing: the value is followed by its unit "mAH"
+		status.Coulomb = -1
+		if layout.coulomb >= 0 {
+			status.Coulomb, err = parseCoulomb(fields[layout.coulomb], "mAH")
+			if err != nil {
+				warnLine("bat", "Could not parse optional field", "coulomb", lineIdx, line, "id", status.ID, "error", err)
+				status.Coulomb = -1 // Indicate parsing failure
+			}
 		}
 
-		status.BAL = fields[11]
+		status.BAL = optionalField(fields, layout.bal)
 
 		results = append(results, status)
 	}
@@ -265,15 +825,13 @@ func ParseBAT(lines []string) ([]BatteryStatus, error) {
 		// Check if any lines were data-like but failed parsing
 		foundDataLikeLine := false
 		for _, line := range lines {
-			if dataRegex.MatchString(strings.TrimSpace(line)) {
+			if isBATDataLine(strings.TrimSpace(line)) {
 				foundDataLikeLine = true
 				break
 			}
 		}
 		if foundDataLikeLine {
-			log.Println("Warning: No BAT data records were successfully parsed, though some lines appeared to be data lines. Check format and parsing logic.")
-		} else if len(lines) > 0 {
-			// log.Println("Note: No BAT data lines matched the expected format.") // Less critical if lines are just headers etc.
+			return nil, fmt.Errorf("%w: no bat records parsed although some lines look like data, check DEVICE_PROFILE", ErrLayoutMismatch)
 		}
 	}
 	return results, nil
@@ -289,6 +847,9 @@ type pwrLayout struct {
 	btState   int
 	mosTemp   int
 	mtState   int
+	// Optional columns, -1 when the header does not list them.
+	heaterState int
+	heaterCurr  int
 }
 
 var legacyPWRLayout = pwrLayout{
@@ -301,12 +862,15 @@ var legacyPWRLayout = pwrLayout{
 	btState:   16,
 	mosTemp:   17,
 	mtState:   18,
+
+	heaterState: -1,
+	heaterCurr:  -1,
 }
 
 // parsePWRHeader derives data-field positions from the column headings. The
 // displayed Time column occupies two whitespace-separated fields in data rows.
 func parsePWRHeader(line string) (pwrLayout, bool) {
-	var layout pwrLayout
+	layout := pwrLayout{heaterState: -1, heaterCurr: -1}
 	found := make(map[string]bool)
 	dataIdx := 0
 
@@ -339,6 +903,10 @@ func parsePWRHeader(line string) (pwrLayout, bool) {
 		case "M.T.St":
 			layout.mtState = dataIdx
 			found[heading] = true
+		case "Heater", "Heat.St", "Heater.St":
+			layout.heaterState = dataIdx
+		case "Heat.Curr", "Heater.Curr":
+			layout.heaterCurr = dataIdx
 		}
 
 		if heading == "Time" {
@@ -368,6 +936,8 @@ func (layout pwrLayout) requiredFields() int {
 		layout.btState,
 		layout.mosTemp,
 		layout.mtState,
+		layout.heaterState,
+		layout.heaterCurr,
 	} {
 		if idx > maxIdx {
 			maxIdx = idx
@@ -376,30 +946,46 @@ func (layout pwrLayout) requiredFields() int {
 	return maxIdx + 1
 }
 
-// ParsePWR parses the raw lines from the 'pwr' command output.
+// UnitIDs returns the IDs of the parsed pwr rows in output order. Absent
+// slots are already dropped by ParsePWR, so the IDs may have gaps.
+func UnitIDs(power []PowerStatus) []int {
+	ids := make([]int, 0, len(power))
+	for _, status := range power {
+		ids = append(ids, status.ID)
+	}
+	return ids
+}
+
+// ParsePWR parses the raw lines from the 'pwr' command output using DefaultProfile.
 func ParsePWR(lines []string) ([]PowerStatus, error) {
+	return DefaultProfile.ParsePWR(lines)
+}
+
+// ParsePWR parses the raw lines from the 'pwr' command output.
+func (profile Profile) ParsePWR(lines []string) ([]PowerStatus, error) {
 	var results []PowerStatus
 	layout := legacyPWRLayout
-	// Regex for data lines, e.g., "0  5000   0    250  ..."
-	// Based on field access, it seems to expect a line that can be split into many fields.
-	dataRegex := regexp.MustCompile(`^\s*\d+\s+`) // Matches lines starting with a number (ID)
+	// Data lines start with a number (ID), e.g., "0  5000   0    250  ..."
+	var fields []string
 
 	for lineIdx, line := range lines { // Added lineIdx for logging
 		line = strings.TrimSpace(line)
-		if headerLayout, ok := parsePWRHeader(line); ok {
-			layout = headerLayout
+		if !isPWRDataLine(line) {
+			if headerLayout, ok := parsePWRHeader(line); ok {
+				layout = headerLayout
+			}
 			continue
 		}
-		// Skip lines explicitly containing "Absent" or if they don't look like data lines or are empty.
-		if !dataRegex.MatchString(line) || strings.Contains(line, "Absent") || line == "" {
-			// log.Printf("Skipping non-data, 'Absent', or empty line (PWR): '%s'", line)
+		// Skip lines explicitly containing "Absent".
+		if strings.Contains(line, "Absent") {
+			// logger.Debug("Skipping 'Absent' line (PWR)", "raw", line)
 			continue
 		}
 
-		fields := strings.Fields(line)
+		fields = splitFields(line, fields)
 		requiredFields := layout.requiredFields()
 		if len(fields) < requiredFields {
-			log.Printf("Skipping line %d (PWR) due to insufficient fields (got %d, expected at least %d): '%s'", lineIdx+1, len(fields), requiredFields, line)
+			warnLine("pwr", "Skipping line with too few fields", strconv.Itoa(len(fields))+" fields", lineIdx, line, "fields", len(fields), "expected", requiredFields)
 			continue
 		}
 
@@ -408,63 +994,81 @@ func ParsePWR(lines []string) ([]PowerStatus, error) {
 
 		status.ID, err = parseInt(fields[0], "PWR ID")
 		if err != nil {
-			log.Printf("Error parsing PWR ID on line %d: %v. Line: '%s'", lineIdx+1, err, line)
+			warnLine("pwr", "Skipping line with unparsable field", "id", lineIdx, line, "error", err)
 			continue
 		}
 
 		status.Volt, err = parseInt(fields[1], "PWR Volt") // Assuming mV
 		if err != nil {
-			log.Printf("Error parsing PWR Volt for ID %d on line %d: %v. Line: '%s'", status.ID, lineIdx+1, err, line)
+			warnLine("pwr", "Skipping line with unparsable field", "volt", lineIdx, line, "id", status.ID, "error", err)
 			continue
 		}
 
 		status.Curr, err = parseInt(fields[2], "PWR Curr") // Assuming mA
 		if err != nil {
-			log.Printf("Error parsing PWR Curr for ID %d on line %d: %v. Line: '%s'", status.ID, lineIdx+1, err, line)
+			warnLine("pwr", "Skipping line with unparsable field", "curr", lineIdx, line, "id", status.ID, "error", err)
 			continue
 		}
 
-		status.Temp, err = parseInt(fields[3], "PWR Temp (Board)") // Temp in 0.1C
+		status.Temp, err = parseTemp(fields[3], profile.TempScale, "PWR Temp (Board)")
 		if err != nil {
-			log.Printf("Error parsing PWR Temp for ID %d on line %d: %v. Line: '%s'", status.ID, lineIdx+1, err, line)
+			warnLine("pwr", "Skipping line with unparsable field", "temp", lineIdx, line, "id", status.ID, "error", err)
 			continue
 		}
 
-		status.BaseState = parseBaseState(fields[layout.baseState])
+		status.BaseState = profile.parseBaseState(fields[layout.baseState])
 		status.VoltState = fields[layout.voltState]
 		status.CurrState = fields[layout.currState]
 		status.TempState = fields[layout.tempState] // State for board temperature
+		if implausibleTemp(status.Temp, status.TempState) {
+			warnLine("pwr", "Temperature out of range for the temperature scale, check TEMP_SCALE", "temp_scale", lineIdx, line, "id", status.ID, "temp_scale", profile.TempScale)
+		}
 
 		socVal, err := parseSOC(fields[layout.soc])
 		if err != nil {
-			log.Printf("Warning parsing SOC/Coulomb for PWR ID %d on line %d: %v. Line: '%s'", status.ID, lineIdx+1, err, line)
+			warnLine("pwr", "Could not parse optional field", "coulomb", lineIdx, line, "id", status.ID, "error", err)
 			status.Coulomb = -1 // Indicate parsing failure
 		} else {
-			status.Coulomb = socVal // Storing SOC (as int8) into Coulomb field as per struct def
+			status.Coulomb = socVal // The Coulomb column of pwr holds the SOC in %
 		}
 
 		status.BVState = fields[layout.bvState]
 		status.BTState = fields[layout.btState]
 
-		status.MosTemp = fields[layout.mosTemp] // MosTemp is a string in 0.1C
-		// No direct parsing to int here, kept as string. Conversion happens in metrics.go
+		status.MosTemp = fields[layout.mosTemp]
+		if mosTemp, err := parseTemp(status.MosTemp, profile.TempScale, "PWR MosTemp"); err != nil {
+			warnLine("pwr", "Could not parse optional field", "mos_temp", lineIdx, line, "id", status.ID, "error", err)
+		} else {
+			status.MosTempMilli, status.MosTempValid = mosTemp, true
+		}
 
 		status.MTState = fields[layout.mtState]
 
+		status.HeaterActive = -1
+		status.HeaterCurr = -1
+		if layout.heaterState >= 0 {
+			if active, ok := parseHeaterState(fields[layout.heaterState]); ok {
+				status.HeaterActive = active
+			}
+		}
+		if layout.heaterCurr >= 0 {
+			if heaterCurr, err := parseInt(fields[layout.heaterCurr], "PWR Heater Curr"); err == nil {
+				status.HeaterCurr = heaterCurr
+			}
+		}
+
 		results = append(results, status)
 	}
 	if len(results) == 0 && len(lines) > 0 {
 		foundDataLikeLine := false
 		for _, line := range lines {
-			if dataRegex.MatchString(strings.TrimSpace(line)) && !strings.Contains(line, "Absent") {
+			if isPWRDataLine(strings.TrimSpace(line)) && !strings.Contains(line, "Absent") {
 				foundDataLikeLine = true
 				break
 			}
 		}
 		if foundDataLikeLine {
-			log.Println("Warning: No PWR data records were successfully parsed, though some lines appeared to be data lines. Check format and parsing logic.")
-		} else if len(lines) > 0 {
-			// log.Println("Note: No PWR data lines matched the expected format or were not 'Absent'.")
+			return nil, fmt.Errorf("%w: no pwr records parsed although some lines look like data, check DEVICE_PROFILE", ErrLayoutMismatch)
 		}
 	}
 	return results, nil
@@ -1,6 +1,18 @@
 package parser
 
-import "testing"
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
 
 func TestParseSTATFirmwareLabelValueOutput(t *testing.T) {
 	lines := []string{
@@ -68,6 +80,30 @@ func TestParseSTATFirmwareLabelValueOutput(t *testing.T) {
 	assertFloatMap(t, "SocSec", got.SocSec, wantSoc)
 }
 
+func TestParseSOH(t *testing.T) {
+	got, err := ParseSOH([]string{
+		"soh 3",
+		"@",
+		"Device address   3",
+		"SOH             :   97%",
+		"Cycle Times     :   412",
+		"Command completed successfully",
+	})
+	if err != nil {
+		t.Fatalf("ParseSOH returned error: %v", err)
+	}
+	if got.Percent != 97 || got.Cycles != 412 {
+		t.Fatalf("ParseSOH = %+v, want 97%% and 412 cycles", got)
+	}
+
+	if _, err := ParseSOH([]string{"soh 3", "Invalid command or fail to excute."}); !errors.Is(err, ErrUnsupportedCommand) {
+		t.Fatalf("ParseSOH error = %v, want ErrUnsupportedCommand", err)
+	}
+	if _, err := ParseSOH([]string{"soh 3", "@"}); err == nil || errors.Is(err, ErrUnsupportedCommand) {
+		t.Fatalf("ParseSOH error = %v, want a parse error for empty output", err)
+	}
+}
+
 func TestParsePWRCurrentColumnLayout(t *testing.T) {
 	lines := []string{
 		"pwr",
@@ -97,6 +133,32 @@ func TestParsePWRCurrentColumnLayout(t *testing.T) {
 	}
 }
 
+func TestParsePWRHeaterColumns(t *testing.T) {
+	lines := []string{
+		"Power Volt   Curr   Tempr  Tlow   Tlow.Id  Thigh  Thigh.Id Vlow   Vlow.Id  Vhigh  Vhigh.Id Base.St  Volt.St  Curr.St  Temp.St  Coulomb  Time                 B.V.St   B.T.St  MosTempr M.T.St   Heat.St  Heat.Curr",
+		"1     51516  1459   -3500  -4000  12       -3000  0        3429   2        3438   1        Charge   Normal   Normal   Low      40%      2026-01-18 06:49:12  Normal   Normal  -2000    Normal   Heating  1800",
+	}
+
+	got, err := ParsePWR(lines)
+	if err != nil {
+		t.Fatalf("ParsePWR returned error: %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("len(ParsePWR) = %d, want 1: %#v", len(got), got)
+	}
+	if got[0].HeaterActive != 1 || got[0].HeaterCurr != 1800 {
+		t.Fatalf("heater columns parsed incorrectly: %#v", got[0])
+	}
+
+	withoutHeater, err := ParsePWR(pwrFixture())
+	if err != nil {
+		t.Fatalf("ParsePWR returned error: %v", err)
+	}
+	if withoutHeater[0].HeaterActive != -1 || withoutHeater[0].HeaterCurr != -1 {
+		t.Fatalf("heater fields should be -1 without heater columns: %#v", withoutHeater[0])
+	}
+}
+
 func TestParsePWRLegacyColumnLayoutWithoutHeader(t *testing.T) {
 	lines := []string{
 		"1 51516 -1459 32900 0 0 0 0 Dischg Normal Normal Normal 100% 2026-06-18 22:49:12 Normal Normal 32400 Normal",
@@ -116,6 +178,747 @@ func TestParsePWRLegacyColumnLayoutWithoutHeader(t *testing.T) {
 	}
 }
 
+func TestParsePWRSYSEnableFlags(t *testing.T) {
+	lines := []string{
+		"pwrsys",
+		"@",
+		"System is discharging",
+		"Total Num                : 2",
+		"System Volt              : 51516 mV",
+		"Charge Enable            : No",
+		"Discharge Enable         : Yes",
+		"Command completed successfully",
+	}
+
+	got, err := ParsePWRSYS(lines)
+	if err != nil {
+		t.Fatalf("ParsePWRSYS returned error: %v", err)
+	}
+	if got.ChargeEnabled != 0 || got.DischargeEnabled != 1 {
+		t.Fatalf("enable flags parsed incorrectly: %#v", got)
+	}
+}
+
+func TestParsePWRSYSLimits(t *testing.T) {
+	lines := []string{
+		"System Volt              : 49885 mV",
+		"Recommend chg voltage    : 53250 mV",
+		"Recommend dsg voltage    : 47000 mV",
+		"Recommend chg current    : 74000 mA",
+		"Recommend dsg current    : -148000 mA",
+	}
+
+	got, err := ParsePWRSYS(lines)
+	if err != nil {
+		t.Fatalf("ParsePWRSYS returned error: %v", err)
+	}
+	if got.ChargeVoltLimit != 53250 || got.ChargeCurrLimit != 74000 || got.DsgCurrLimit != 148000 {
+		t.Fatalf("limits parsed incorrectly: %#v", got)
+	}
+}
+
+func TestParsePWRSYSWithoutEnableFlags(t *testing.T) {
+	lines := []string{
+		"System is idle",
+		"Total Num                : 2",
+		"System Volt              : 49885 mV",
+	}
+
+	got, err := ParsePWRSYS(lines)
+	if err != nil {
+		t.Fatalf("ParsePWRSYS returned error: %v", err)
+	}
+	if got.ChargeEnabled != -1 || got.DischargeEnabled != -1 {
+		t.Fatalf("missing flags should stay -1: %#v", got)
+	}
+
+	if _, err := ParsePWRSYS([]string{"Invalid command"}); err == nil {
+		t.Fatal("ParsePWRSYS accepted output without any values")
+	}
+}
+
+func TestParsePower(t *testing.T) {
+	lines := []string{
+		"power",
+		"@",
+		"System Volt              : 49512 mV",
+		"System Curr              : -12500 mA",
+		"System Power             : -0.62 kW",
+		"Command completed successfully",
+	}
+
+	got, err := ParsePower(lines)
+	if err != nil {
+		t.Fatalf("ParsePower returned error: %v", err)
+	}
+	if got.Volt != 49512 || got.Curr != -12500 || got.Power != -620 {
+		t.Fatalf("power parsed incorrectly: %#v", got)
+	}
+}
+
+func TestParsePowerCalculatesMissingPower(t *testing.T) {
+	got, err := ParsePower([]string{"Volt : 50.0 V", "Curr : 20 A"})
+	if err != nil {
+		t.Fatalf("ParsePower returned error: %v", err)
+	}
+	if got.Volt != 50000 || got.Curr != 20000 || got.Power != 1000 {
+		t.Fatalf("power calculated incorrectly: %#v", got)
+	}
+
+	if _, err := ParsePower([]string{"power", "Invalid command"}); !errors.Is(err, ErrUnsupportedCommand) {
+		t.Fatalf("ParsePower error = %v, want ErrUnsupportedCommand", err)
+	}
+	if _, err := ParsePower([]string{"System Volt : 49512 mV"}); err == nil {
+		t.Fatal("ParsePower accepted output without a current")
+	}
+}
+
+func TestCloneV1ProfileParsesBAT(t *testing.T) {
+	lines := []string{
+		"bat 1",
+		"@",
+		"Bat  Volt   Curr   Tmpr  Base.State   Volt.State  Curr.State  Temp.State  SOC   Coulomb     BAL",
+		"0    3312   -1459  21    Discharging  Normal      Normal      Normal      87%   43500 mAH   N",
+		"1    3315   2100   22    Charging     Normal      Normal      Normal      87%   43500 mAH   Y",
+		"2    3314   0      22    Standby      Normal      Normal      Normal      87%   43500 mAH   N",
+		"Command completed successfully",
+	}
+
+	profile, err := LookupProfile("clone_v1")
+	if err != nil {
+		t.Fatalf("LookupProfile returned error: %v", err)
+	}
+
+	got, err := profile.ParseBAT(lines)
+	if err != nil {
+		t.Fatalf("ParseBAT returned error: %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("len(ParseBAT) = %d, want 3: %#v", len(got), got)
+	}
+
+	wantStates := []int8{1, 0, 2}
+	wantTemps := []int{21000, 22000, 22000}
+	for i, status := range got {
+		if status.BaseState != wantStates[i] || status.Temp != wantTemps[i] {
+			t.Fatalf("record %d = %#v, want base state %d and temp %d", i, status, wantStates[i], wantTemps[i])
+		}
+	}
+}
+
+func TestLookupProfile(t *testing.T) {
+	for name, want := range map[string]string{
+		"":               "pylontech",
+		"pylontech":      "pylontech",
+		"Pylontech_Deci": "pylontech_deci",
+		"clone_v1":       "clone_v1",
+	} {
+		profile, err := LookupProfile(name)
+		if err != nil || profile.Name != want {
+			t.Fatalf("LookupProfile(%q) = %q, %v; want %q", name, profile.Name, err, want)
+		}
+	}
+
+	if _, err := LookupProfile("seplos"); err == nil {
+		t.Fatal("LookupProfile accepted an unknown profile")
+	}
+}
+
+func TestPylontechDeciProfileScalesTemperature(t *testing.T) {
+	lines := []string{"0   3750  0    301 Charge Normal Normal Normal 85% 3450 mAH 0000000000000000"}
+
+	got, err := PylontechDeciProfile.ParseBAT(lines)
+	if err != nil {
+		t.Fatalf("ParseBAT returned error: %v", err)
+	}
+	if len(got) != 1 || got[0].Temp != 30100 {
+		t.Fatalf("deci-degree temperature parsed incorrectly: %#v", got)
+	}
+}
+
+func TestParseInfoBarcode(t *testing.T) {
+	lines := []string{
+		"info",
+		"@",
+		"Device address      : 1",
+		"Manufacturer        : Pylon",
+		"Device name         : US2000C",
+		"Barcode             : PPTAH02400123456",
+		"Command completed successfully",
+	}
+
+	got, err := ParseInfo(lines)
+	if err != nil {
+		t.Fatalf("ParseInfo returned error: %v", err)
+	}
+	if got.Barcode != "PPTAH02400123456" {
+		t.Fatalf("Barcode = %q, want PPTAH02400123456", got.Barcode)
+	}
+
+	if _, err := ParseInfo([]string{"Invalid command"}); err == nil {
+		t.Fatal("ParseInfo accepted output without a barcode")
+	}
+}
+
+func TestParseInfoFields(t *testing.T) {
+	lines := []string{
+		"Device address      : 1",
+		"Manufacturer        : Pylon",
+		"Device name         : US3000C",
+		"Board version       : PHANTOMSAV10R03",
+		"Main Soft version   : B66.6",
+		"Soft  version       : V2.4",
+		"Boot  version       : V2.0",
+		"Release Date        : 21-05-07",
+		"Barcode             : PPTAH02400123456",
+		"Specification       : 48V/74AH",
+		"Cell Number         : 15",
+	}
+
+	got, err := ParseInfo(lines)
+	if err != nil {
+		t.Fatalf("ParseInfo returned error: %v", err)
+	}
+	want := DeviceInfo{
+		Manufacturer:     "Pylon",
+		DeviceName:       "US3000C",
+		BoardVersion:     "PHANTOMSAV10R03",
+		FirmwareVersion:  "B66.6",
+		Barcode:          "PPTAH02400123456",
+		SpecificCapacity: 74000,
+	}
+	if got != want {
+		t.Fatalf("ParseInfo = %+v, want %+v", got, want)
+	}
+
+	got, err = ParseInfo([]string{"Soft  version : V1.3", "Barcode : X1"})
+	if err != nil {
+		t.Fatalf("ParseInfo returned error: %v", err)
+	}
+	if got.FirmwareVersion != "V1.3" || got.SpecificCapacity != -1 {
+		t.Fatalf("ParseInfo = %+v, want firmware V1.3 and unknown capacity", got)
+	}
+}
+
+func TestParseBATSubZeroTemperatures(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile Profile
+		line    string
+		want    int
+	}{
+		{"milli-degree", PylontechProfile, "0   3312  -1459  -3500 Dischg Normal Normal Low 85% 3450 mAH N", -3500},
+		{"deci-degree", PylontechDeciProfile, "0   3312  -1459  -35   Dischg Normal Normal Low 85% 3450 mAH N", -3500},
+		{"whole degree", CloneV1Profile, "0   3312  -1459  -3.5  Discharging Normal Normal Low 85% 3450 mAH N", -3500},
+		{"just below zero", PylontechDeciProfile, "0   3312  0  -1   Idle Normal Normal Low 85% 3450 mAH N", -100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.profile.ParseBAT([]string{tt.line})
+			if err != nil {
+				t.Fatalf("ParseBAT returned error: %v", err)
+			}
+			if len(got) != 1 || got[0].Temp != tt.want {
+				t.Fatalf("ParseBAT temp = %#v, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseBATNegativeValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		wantCurr int
+		wantTemp int
+	}{
+		{"discharging", "0   3312  -18342  21000 Dischg Normal Normal Normal 85% 3450 mAH N", -18342, 21000},
+		{"sub-zero", "0   3312  0  -2300 Idle Normal Normal Low 85% 3450 mAH N", 0, -2300},
+		{"discharging below zero", "0   3312  -18342  -2300 Dischg Normal Normal Low 85% 3450 mAH N", -18342, -2300},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PylontechProfile.ParseBAT([]string{tt.line})
+			if err != nil {
+				t.Fatalf("ParseBAT returned error: %v", err)
+			}
+			if len(got) != 1 || got[0].Curr != tt.wantCurr || got[0].Temp != tt.wantTemp {
+				t.Fatalf("ParseBAT = %#v, want curr %d and temp %d", got, tt.wantCurr, tt.wantTemp)
+			}
+		})
+	}
+}
+
+func TestRepeatedParseWarningsAreSummarised(t *testing.T) {
+	var buf bytes.Buffer
+	previous := logger
+	SetLogger(slog.New(slog.NewTextHandler(&buf, nil)))
+	repeatedWarnings.counts = map[string]int{}
+	t.Cleanup(func() {
+		SetLogger(previous)
+		repeatedWarnings.counts = map[string]int{}
+	})
+
+	lines := []string{
+		"0   3312  -1459  21000 Dischg Normal Normal Normal 85% 3450 mAH N",
+		"1   33x2  -1459  21000 Dischg Normal Normal Normal 85% 3450 mAH N",
+		"2   33x2  -1459  21000 Dischg Normal Normal Normal 85% 3450 mAH N",
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := PylontechProfile.ParseBAT(lines); err != nil {
+			t.Fatalf("ParseBAT returned error: %v", err)
+		}
+	}
+	if n := strings.Count(buf.String(), "Skipping line with unparsable field"); n != 1 {
+		t.Fatalf("logged the warning %d times, want once:\n%s", n, buf.String())
+	}
+	if !strings.Contains(buf.String(), "command=bat") || !strings.Contains(buf.String(), "line=2") {
+		t.Errorf("warning lacks the command and line attributes:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	FlushWarnings()
+	if !strings.Contains(buf.String(), "Parse warning repeated") || !strings.Contains(buf.String(), "count=3") {
+		t.Fatalf("summary = %q, want the 3 repeats", buf.String())
+	}
+	buf.Reset()
+	FlushWarnings()
+	if buf.Len() != 0 {
+		t.Fatalf("second flush logged %q, want nothing", buf.String())
+	}
+}
+
+func TestParsePWRWarnsOnceAboutMosTemp(t *testing.T) {
+	var buf bytes.Buffer
+	previous := logger
+	SetLogger(slog.New(slog.NewTextHandler(&buf, nil)))
+	repeatedWarnings.counts = map[string]int{}
+	t.Cleanup(func() {
+		SetLogger(previous)
+		repeatedWarnings.counts = map[string]int{}
+	})
+
+	lines := []string{
+		"Power Volt   Curr   Tempr  Tlow   Tlow.Id  Thigh  Thigh.Id Vlow   Vlow.Id  Vhigh  Vhigh.Id Base.St  Volt.St  Curr.St  Temp.St  Coulomb  Time                 B.V.St   B.T.St  MosTempr M.T.St",
+		"1     51516  -18342 22000  21000  12       23000  0        3429   2        3438   1        Dischg   Normal   Normal   Normal   40%      2026-01-18 06:49:12  Normal   Normal  -        Normal",
+		"2     51517  -18342 22000  21000  12       23000  0        3429   2        3438   1        Dischg   Normal   Normal   Normal   40%      2026-01-18 06:49:12  Normal   Normal  -        Normal",
+	}
+	for range 2 {
+		got, err := PylontechProfile.ParsePWR(lines)
+		if err != nil {
+			t.Fatalf("ParsePWR returned error: %v", err)
+		}
+		if len(got) != 2 || got[0].MosTempValid {
+			t.Fatalf("ParsePWR = %#v, want both rows without a valid MOS temperature", got)
+		}
+	}
+	if n := strings.Count(buf.String(), "Could not parse optional field"); n != 1 {
+		t.Fatalf("logged the warning %d times, want once:\n%s", n, buf.String())
+	}
+}
+
+func TestParseWarnsOnceAboutTemperatureScale(t *testing.T) {
+	var buf bytes.Buffer
+	previous := logger
+	SetLogger(slog.New(slog.NewTextHandler(&buf, nil)))
+	repeatedWarnings.counts = map[string]int{}
+	t.Cleanup(func() {
+		SetLogger(previous)
+		repeatedWarnings.counts = map[string]int{}
+	})
+	bat := readFixture(t, "bat_deci.txt")
+
+	// Deci-degree firmware on the milli-degree default profile
+	for range 2 {
+		got, err := PylontechProfile.ParseBAT(bat)
+		if err != nil {
+			t.Fatalf("ParseBAT returned error: %v", err)
+		}
+		if len(got) != 2 || got[0].Temp != 217 {
+			t.Fatalf("ParseBAT = %#v, want the readings as milli-degrees", got)
+		}
+	}
+	if n := strings.Count(buf.String(), "check TEMP_SCALE"); n != 1 {
+		t.Fatalf("logged the warning %d times, want once:\n%s", n, buf.String())
+	}
+
+	buf.Reset()
+	repeatedWarnings.counts = map[string]int{}
+	if _, err := PylontechDeciProfile.ParseBAT(bat); err != nil {
+		t.Fatalf("ParseBAT returned error: %v", err)
+	}
+	if _, err := PylontechDeciProfile.ParsePWR(readFixture(t, "pwr_deci.txt")); err != nil {
+		t.Fatalf("ParsePWR returned error: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("logged %q with the matching temperature scale, want nothing", buf.String())
+	}
+}
+
+func TestParseBATSOC(t *testing.T) {
+	tests := []struct {
+		soc  string
+		want int
+	}{
+		{"0%", 0},
+		{"100%", 100},
+		{"87", 87},
+		{"n/a%", -1},
+		{"-5%", -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.soc, func(t *testing.T) {
+			got, err := PylontechProfile.ParseBAT([]string{"0   3312  -1459  21000 Dischg Normal Normal Normal " + tt.soc + " 3450 mAH N"})
+			if err != nil {
+				t.Fatalf("ParseBAT returned error: %v", err)
+			}
+			if len(got) != 1 || got[0].SOC != tt.want || got[0].Coulomb != 3450 {
+				t.Fatalf("ParseBAT = %#v, want SOC %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseBATNegativeSecondColumn(t *testing.T) {
+	// A layout with the current right after the ID
+	profile := PylontechProfile
+	profile.BATColumns = []string{"id", "curr", "volt", "temp", "base_state", "volt_state", "curr_state", "temp_state", "soc", "coulomb", "coulomb_unit", "bal"}
+
+	got, err := profile.ParseBAT([]string{"0   -18342  3312  -2300 Dischg Normal Normal Low 85% 3450 mAH N"})
+	if err != nil {
+		t.Fatalf("ParseBAT returned error: %v", err)
+	}
+	if len(got) != 1 || got[0].Curr != -18342 || got[0].Volt != 3312 || got[0].Temp != -2300 {
+		t.Fatalf("ParseBAT = %#v, want the row with a negative current", got)
+	}
+}
+
+func TestParsePWRDischargingBelowZero(t *testing.T) {
+	got, err := PylontechProfile.ParsePWR([]string{
+		"Power Volt   Curr   Tempr  Tlow   Tlow.Id  Thigh  Thigh.Id Vlow   Vlow.Id  Vhigh  Vhigh.Id Base.St  Volt.St  Curr.St  Temp.St  Coulomb  Time                 B.V.St   B.T.St  MosTempr M.T.St",
+		"1     51516  -18342 -2300  -2500  12       -2100  0        3429   2        3438   1        Dischg   Normal   Normal   Low      40%      2026-01-18 06:49:12  Normal   Normal  -1800    Normal",
+	})
+	if err != nil {
+		t.Fatalf("ParsePWR returned error: %v", err)
+	}
+	if len(got) != 1 || got[0].Curr != -18342 || got[0].Temp != -2300 {
+		t.Fatalf("ParsePWR = %#v, want curr -18342 and temp -2300", got)
+	}
+}
+
+func TestParsePWRSubZeroTemperatures(t *testing.T) {
+	header := "Power Volt   Curr   Tempr  Tlow   Tlow.Id  Thigh  Thigh.Id Vlow   Vlow.Id  Vhigh  Vhigh.Id Base.St  Volt.St  Curr.St  Temp.St  Coulomb  Time                 B.V.St   B.T.St  MosTempr M.T.St"
+
+	milli, err := PylontechProfile.ParsePWR([]string{
+		header,
+		"1     51516  1459   -3500  -4000  12       -3000  0        3429   2        3438   1        Charge   Normal   Normal   Low      40%      2026-01-18 06:49:12  Normal   Normal  -2000    Normal",
+	})
+	if err != nil {
+		t.Fatalf("ParsePWR returned error: %v", err)
+	}
+	if len(milli) != 1 || milli[0].Temp != -3500 {
+		t.Fatalf("milli-degree PWR temp = %#v, want -3500", milli)
+	}
+
+	deci, err := PylontechDeciProfile.ParsePWR([]string{
+		header,
+		"1     51516  1459   -35    -40    12       -30    0        3429   2        3438   1        Charge   Normal   Normal   Low      40%      2026-01-18 06:49:12  Normal   Normal  -20      Normal",
+	})
+	if err != nil {
+		t.Fatalf("ParsePWR returned error: %v", err)
+	}
+	if len(deci) != 1 || deci[0].Temp != -3500 {
+		t.Fatalf("deci-degree PWR temp = %#v, want -3500", deci)
+	}
+}
+
+func TestDataLineGatesMatchRegexps(t *testing.T) {
+	batRegex := regexp.MustCompile(`^\s*\d+\s+[-+]?\d`)
+	pwrRegex := regexp.MustCompile(`^\s*\d+\s+`)
+
+	lines := []string{
+		"",
+		" ",
+		"@",
+		"bat 1",
+		"Battery  Volt     Curr     Tempr",
+		"0",
+		"0 ",
+		"0 3750",
+		"0\t3750",
+		"  12   3312   -1459  301",
+		"1 -1459",
+		"1 +21",
+		"1 -",
+		"1 -x",
+		"1 x",
+		"12a 3312",
+		"1     -      -      -        Absent",
+		"10    3312  0  17000 Idle Normal Normal Normal 85% 3450 mAH N",
+		"Command completed successfully",
+		"$$",
+		"1\u00a03312",
+	}
+
+	for _, line := range lines {
+		if got, want := isBATDataLine(line), batRegex.MatchString(line); got != want {
+			t.Errorf("isBATDataLine(%q) = %v, regexp = %v", line, got, want)
+		}
+		if got, want := isPWRDataLine(line), pwrRegex.MatchString(line); got != want {
+			t.Errorf("isPWRDataLine(%q) = %v, regexp = %v", line, got, want)
+		}
+	}
+}
+
+func TestSplitFieldsMatchesStringsFields(t *testing.T) {
+	lines := []string{
+		"",
+		"   ",
+		"0   3750  0    301 Charge Normal Normal Normal 85% 3450 mAH 0000000000000000",
+		"\tleading\vand\ftrailing\r\n",
+		"1\u00a03312\u2003-1459",
+	}
+
+	var buf []string
+	for _, line := range lines {
+		buf = splitFields(line, buf)
+		want := strings.Fields(line)
+		if len(buf) == 0 && len(want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(buf, want) {
+			t.Errorf("splitFields(%q) = %q, want %q", line, buf, want)
+		}
+	}
+}
+
+func TestParseBATFixtureOutput(t *testing.T) {
+	got, err := ParseBAT(batFixture(2))
+	if err != nil {
+		t.Fatalf("ParseBAT returned error: %v", err)
+	}
+	if len(got) != 30 {
+		t.Fatalf("len(ParseBAT) = %d, want 30", len(got))
+	}
+
+	want := BatteryStatus{
+		ID:        14,
+		Volt:      3314,
+		Curr:      -1459,
+		Temp:      17014,
+		BaseState: 1,
+		VoltState: "Normal",
+		CurrState: "Normal",
+		TempState: "Normal",
+		SOC:       87,
+		Coulomb:   43500,
+		BAL:       "N",
+	}
+	if got[29] != want {
+		t.Fatalf("last record = %#v, want %#v", got[29], want)
+	}
+}
+
+func TestParseBATFirmwareLayouts(t *testing.T) {
+	tests := []struct {
+		fixture string
+		cells   int
+		last    BatteryStatus
+	}{
+		{"bat_us2000.txt", 15, BatteryStatus{
+			ID: 14, Volt: 3308, Curr: -1459, Temp: 21840, BaseState: 1,
+			VoltState: "Normal", CurrState: "Normal", TempState: "Normal",
+			SOC: 87, Coulomb: 43500, BAL: "N",
+		}},
+		// No SOC column
+		{"bat_us3000c.txt", 15, BatteryStatus{
+			ID: 14, Volt: 3331, Curr: 2112, Temp: 19440, BaseState: 0,
+			VoltState: "Normal", CurrState: "Normal", TempState: "Normal",
+			SOC: -1, Coulomb: 46112, BAL: "N",
+		}},
+		// 16 cells, Time and B_V_St/B_T_St columns, no BAL column
+		{"bat_us5000.txt", 16, BatteryStatus{
+			ID: 15, Volt: 3337, Curr: -2397, Temp: -1350, BaseState: 1,
+			VoltState: "Normal", CurrState: "Normal", TempState: "Low",
+			SOC: 76, Coulomb: 75881,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			got, err := ParseBAT(readFixture(t, tt.fixture))
+			if err != nil {
+				t.Fatalf("ParseBAT returned error: %v", err)
+			}
+			if len(got) != tt.cells {
+				t.Fatalf("len(ParseBAT) = %d, want %d", len(got), tt.cells)
+			}
+			if got[len(got)-1] != tt.last {
+				t.Fatalf("last record = %#v, want %#v", got[len(got)-1], tt.last)
+			}
+		})
+	}
+}
+
+func TestParseBATHeaderReordersColumns(t *testing.T) {
+	got, err := ParseBAT([]string{
+		"Battery  Volt   Tempr  Curr   Base.St  SOC  Coulomb",
+		"0        3312   -2300  -1459  Dischg   85%  3450 mAH",
+	})
+	if err != nil {
+		t.Fatalf("ParseBAT returned error: %v", err)
+	}
+	want := BatteryStatus{ID: 0, Volt: 3312, Curr: -1459, Temp: -2300, BaseState: 1, SOC: 85, Coulomb: 3450}
+	if len(got) != 1 || got[0] != want {
+		t.Fatalf("ParseBAT = %#v, want %#v", got, want)
+	}
+}
+
+func TestParseBATHeaderSkipsOtherLinesWithoutAllocating(t *testing.T) {
+	for _, line := range []string{"Press [Enter] to be continued,other key to exit", "Command completed successfully", "@", ""} {
+		if allocs := testing.AllocsPerRun(100, func() { parseBATHeader(line) }); allocs != 0 {
+			t.Errorf("parseBATHeader(%q) allocates %v times, want 0", line, allocs)
+		}
+	}
+	if _, ok := parseBATHeader("BATTERY  Volt  Curr  Tempr"); !ok {
+		t.Error("parseBATHeader rejects an upper-case ID heading")
+	}
+}
+
+// readFixture returns the lines of a console dump in testdata.
+func readFixture(t *testing.T, name string) []string {
+	t.Helper()
+	raw, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.ReplaceAll(string(raw), "\r\n", "\n"), "\n")
+}
+
+// batFixture renders a paginated 'bat' dump with 15 cells per page.
+func batFixture(pages int) []string {
+	lines := []string{"bat 1", "@"}
+	for page := 0; page < pages; page++ {
+		lines = append(lines, "Battery  Volt     Curr     Tempr    Base State   Volt. State  Curr. State  Temp. State  SOC          Coulomb      BAL")
+		for cell := 0; cell < 15; cell++ {
+			lines = append(lines, fmt.Sprintf("%-8d %-8d %-8d %-8d Dischg       Normal       Normal       Normal       87%%          43500 mAH    N",
+				cell, 3300+cell, -1459, 17000+cell))
+		}
+		lines = append(lines, "Press [Enter] to be continued,other key to exit")
+	}
+	return append(lines, "Command completed successfully", "$$")
+}
+
+func TestParseLayoutMismatch(t *testing.T) {
+	// A stack without modules has no data rows and is not an error
+	if got, err := ParsePWR([]string{"pwr", "@", "Power Volt   Curr   Tempr", "1     -      -      -     Absent", "$$"}); err != nil || len(got) != 0 {
+		t.Fatalf("ParsePWR = %v, %v, want no records and no error", got, err)
+	}
+	if got, err := ParseBAT([]string{"bat 1", "@", "Battery  Volt  Curr  Tempr", "$$"}); err != nil || len(got) != 0 {
+		t.Fatalf("ParseBAT = %v, %v, want no records and no error", got, err)
+	}
+
+	// Rows that look like data but do not fit the layout
+	if _, err := ParsePWR([]string{"pwr", "@", "1     51516"}); !errors.Is(err, ErrLayoutMismatch) {
+		t.Fatalf("ParsePWR error = %v, want ErrLayoutMismatch", err)
+	}
+	if _, err := ParseBAT([]string{"bat 1", "@", "0   3312"}); !errors.Is(err, ErrLayoutMismatch) {
+		t.Fatalf("ParseBAT error = %v, want ErrLayoutMismatch", err)
+	}
+}
+
+func TestParsePWRPagedOutput(t *testing.T) {
+	lines := pwrFixture()
+	// The console repeats the header at the top of the second page
+	paged := append([]string{}, lines[:10]...)
+	paged = append(paged, lines[2])
+	paged = append(paged, lines[10:]...)
+
+	want, err := ParsePWR(lines)
+	if err != nil {
+		t.Fatalf("ParsePWR returned error: %v", err)
+	}
+	got, err := ParsePWR(paged)
+	if err != nil {
+		t.Fatalf("ParsePWR returned error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("paged output parsed as %#v, want %#v", got, want)
+	}
+}
+
+// pwrFixture renders a 'pwr' dump for a 16-module stack with two empty slots.
+func TestUnitIDsFollowPWRRows(t *testing.T) {
+	header := "Power Volt   Curr   Tempr  Tlow   Tlow.Id  Thigh  Thigh.Id Vlow   Vlow.Id  Vhigh  Vhigh.Id Base.St  Volt.St  Curr.St  Temp.St  Coulomb  Time                 B.V.St   B.T.St  MosTempr M.T.St   SysAlarm.St"
+	row := func(id int) string {
+		return fmt.Sprintf("%-5d 51516  -1459  32900  29400  12       31300  0        3429   2        3438   1        Dischg   Normal   Normal   Normal   100%%     2026-06-18 22:49:12  Normal   Normal  32400    Normal   Normal", id)
+	}
+	absent := func(id int) string {
+		return fmt.Sprintf("%-5d -      -      -      -      -        -      -        Absent", id)
+	}
+
+	tests := []struct {
+		name  string
+		lines []string
+		want  []int
+	}{
+		{"gap in the id sequence", []string{header, row(1), row(2), row(4), row(6)}, []int{1, 2, 4, 6}},
+		{"absent rows in the middle", []string{header, row(1), absent(2), absent(3), row(4), row(5), row(6)}, []int{1, 4, 5, 6}},
+		{"ids not starting at 1", []string{header, absent(1), row(2), row(3)}, []int{2, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			power, err := ParsePWR(tt.lines)
+			if err != nil {
+				t.Fatalf("ParsePWR returned error: %v", err)
+			}
+			if got := UnitIDs(power); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("UnitIDs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func pwrFixture() []string {
+	lines := []string{
+		"pwr",
+		"@",
+		"Power Volt   Curr   Tempr  Tlow   Tlow.Id  Thigh  Thigh.Id Vlow   Vlow.Id  Vhigh  Vhigh.Id Base.St  Volt.St  Curr.St  Temp.St  Coulomb  Time                 B.V.St   B.T.St  MosTempr M.T.St   SysAlarm.St",
+	}
+	for id := 1; id <= 16; id++ {
+		if id == 7 || id == 12 {
+			lines = append(lines, fmt.Sprintf("%-5d -      -      -      -      -        -      -        Absent", id))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%-5d 51516  -1459  32900  29400  12       31300  0        3429   2        3438   1        Dischg   Normal   Normal   Normal   100%%     2026-06-18 22:49:12  Normal   Normal  32400    Normal   Normal", id))
+	}
+	return append(lines, "Command completed successfully", "$$")
+}
+
+func BenchmarkParseBAT(b *testing.B) {
+	lines := batFixture(16)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseBAT(lines); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParsePWR(b *testing.B) {
+	lines := pwrFixture()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParsePWR(lines); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func assertFloatMap(t *testing.T, name string, got, want map[string]float64) {
 	t.Helper()
 
@@ -129,3 +932,79 @@ func assertFloatMap(t *testing.T, name string, got, want map[string]float64) {
 		}
 	}
 }
+
+func TestParseEventsBlockLayout(t *testing.T) {
+	lines := []string{
+		"log",
+		"@",
+		"Index          : 1021",
+		"Time           : 21-12-31 13:46:04",
+		"Module         : 2",
+		"Event          : Cell OV",
+		"",
+		"Index          : 1022",
+		"Time           : 21-12-31 13:46:04",
+		"Event          : MOS OT",
+		"",
+		"Index          : 1023",
+		"Time           : 2022-01-02 08:00:00",
+		"Module         : 1",
+		"Event          : ",
+		"Command completed successfully",
+		"$$",
+	}
+	got, err := ParseEvents(lines)
+	if err != nil {
+		t.Fatalf("ParseEvents returned error: %v", err)
+	}
+	at := time.Date(2021, 12, 31, 13, 46, 4, 0, time.Local)
+	want := []Event{
+		{Index: 1021, Time: at, Module: 2, Type: "Cell OV"},
+		{Index: 1022, Time: at, Module: 0, Type: "MOS OT"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ParseEvents = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseEventsRowLayout(t *testing.T) {
+	lines := []string{
+		"log",
+		"@",
+		"Index  Time                 Module  Event",
+		"7      2023-05-01 22:10:59  3       Cell UV",
+		"8      23-05-02 06:00:00    1       0x21",
+		"$$",
+	}
+	got, err := ParseEvents(lines)
+	if err != nil {
+		t.Fatalf("ParseEvents returned error: %v", err)
+	}
+	want := []Event{
+		{Index: 7, Time: time.Date(2023, 5, 1, 22, 10, 59, 0, time.Local), Module: 3, Type: "Cell UV"},
+		{Index: 8, Time: time.Date(2023, 5, 2, 6, 0, 0, 0, time.Local), Module: 1, Type: "0x21"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ParseEvents = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseEventsErrors(t *testing.T) {
+	if got, err := ParseEvents([]string{"log", "@", "$$"}); err != nil || len(got) != 0 {
+		t.Fatalf("ParseEvents of an empty log = %v, %v, want no events and no error", got, err)
+	}
+	if _, err := ParseEvents([]string{"log", "Invalid command or fail to execute."}); !errors.Is(err, ErrUnsupportedCommand) {
+		t.Fatalf("ParseEvents error = %v, want ErrUnsupportedCommand", err)
+	}
+	if _, err := ParseEvents([]string{"log", "@", "Time : 21-13-40 10:00:00", "Event : Cell OV"}); !errors.Is(err, ErrLayoutMismatch) {
+		t.Fatalf("ParseEvents error = %v, want ErrLayoutMismatch", err)
+	}
+}
+
+func TestFirmwareMajor(t *testing.T) {
+	for version, want := range map[string]string{"V2.5": "2", "B66.6": "66", "1.3.2": "1", "": ""} {
+		if got := FirmwareMajor(version); got != want {
+			t.Errorf("FirmwareMajor(%q) = %q, want %q", version, got, want)
+		}
+	}
+}
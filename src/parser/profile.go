@@ -0,0 +1,159 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Profile describes how a console firmware variant formats its output, so a
+// new variant can be supported by adding data instead of forking the parser.
+type Profile struct {
+	Name string
+	// BATColumns names the whitespace-separated fields of a 'bat' data row in
+	// display order. Recognised names are id, volt, curr, temp, base_state,
+	// volt_state, curr_state, temp_state, soc, coulomb and bal; any other
+	// name (e.g. "coulomb_unit") marks a field that is skipped. It is only
+	// used for output without a header row; see parseBATHeader.
+	BATColumns []string
+	// TempScale converts the reported temperature readings into the
+	// milli-degrees Celsius stored in BatteryStatus.Temp, PowerStatus.Temp
+	// and PowerStatus.MosTempMilli; see TempScales.
+	TempScale int
+	// BaseStates maps the firmware's base state wording to the numeric codes
+	// documented on BatteryStatus.BaseState.
+	BaseStates map[string]int8
+}
+
+var pylontechBATColumns = []string{
+	"id", "volt", "curr", "temp", "base_state", "volt_state", "curr_state", "temp_state", "soc", "coulomb", "coulomb_unit", "bal",
+}
+
+// PylontechProfile matches Pylontech firmware reporting milli-degrees Celsius.
+var PylontechProfile = Profile{
+	Name:       "pylontech",
+	BATColumns: pylontechBATColumns,
+	TempScale:  1,
+	BaseStates: baseStateMap,
+}
+
+// PylontechDeciProfile matches older Pylontech firmware reporting 0.1 °C
+// (e.g. "301" means 30.1 °C).
+var PylontechDeciProfile = Profile{
+	Name:       "pylontech_deci",
+	BATColumns: pylontechBATColumns,
+	TempScale:  100,
+	BaseStates: baseStateMap,
+}
+
+// CloneV1Profile matches Pylontech-protocol-compatible firmware (Basen/Seplos
+// style) with a "Bat Volt Curr Tmpr" header, whole-degree temperatures and
+// its own base state wording.
+var CloneV1Profile = Profile{
+	Name:       "clone_v1",
+	BATColumns: pylontechBATColumns, // Same order, only the headings differ
+	TempScale:  1000,
+	BaseStates: map[string]int8{
+		"Charging":    0,
+		"Discharging": 1,
+		"Standby":     2,
+		"Balancing":   3,
+		"N/A":         -1,
+	},
+}
+
+// TempScales are the TempScale values of the temperature units firmware
+// reports, by the names TEMP_SCALE accepts.
+var TempScales = map[string]int{
+	"milli":  1,    // 21000 means 21 °C
+	"centi":  10,   // 2100 means 21 °C
+	"deci":   100,  // 210 means 21 °C
+	"degree": 1000, // 21 means 21 °C
+}
+
+// DefaultProfile is used by ParseBAT and ParsePWR.
+var DefaultProfile = PylontechProfile
+
+var profiles = map[string]Profile{
+	PylontechProfile.Name:     PylontechProfile,
+	PylontechDeciProfile.Name: PylontechDeciProfile,
+	CloneV1Profile.Name:       CloneV1Profile,
+}
+
+// LookupProfile returns the profile registered under name. An empty name
+// selects DefaultProfile.
+func LookupProfile(name string) (Profile, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return DefaultProfile, nil
+	}
+	if profile, ok := profiles[name]; ok {
+		return profile, nil
+	}
+
+	known := make([]string, 0, len(profiles))
+	for profileName := range profiles {
+		known = append(known, profileName)
+	}
+	sort.Strings(known)
+	return Profile{}, fmt.Errorf("unknown device profile '%s' (known: %s)", name, strings.Join(known, ", "))
+}
+
+func (profile Profile) parseBaseState(s string) int8 {
+	if val, ok := profile.BaseStates[s]; ok {
+		return val
+	}
+	return -1 // Unknown state
+}
+
+type batLayout struct {
+	id   int
+	volt int
+	curr int
+	temp int
+	// Optional columns, -1 when the layout does not list them.
+	baseState int
+	voltState int
+	currState int
+	tempState int
+	soc       int
+	coulomb   int
+	bal       int
+	fields    int
+}
+
+// batLayout resolves the profile's BAT column names to field positions.
+func (profile Profile) batLayout() batLayout {
+	layout := batLayout{
+		baseState: -1, voltState: -1, currState: -1, tempState: -1,
+		soc: -1, coulomb: -1, bal: -1,
+		fields: len(profile.BATColumns),
+	}
+	for idx, column := range profile.BATColumns {
+		switch column {
+		case "id":
+			layout.id = idx
+		case "volt":
+			layout.volt = idx
+		case "curr":
+			layout.curr = idx
+		case "temp":
+			layout.temp = idx
+		case "base_state":
+			layout.baseState = idx
+		case "volt_state":
+			layout.voltState = idx
+		case "curr_state":
+			layout.currState = idx
+		case "temp_state":
+			layout.tempState = idx
+		case "soc":
+			layout.soc = idx
+		case "coulomb":
+			layout.coulomb = idx
+		case "bal":
+			layout.bal = idx
+		}
+	}
+	return layout
+}
@@ -0,0 +1,100 @@
+package snapshot
+
+import (
+	"sync"
+	"time"
+
+	"pylontech_exporter/src/parser"
+)
+
+// Snapshot is the most recently parsed device data.
+type Snapshot struct {
+	CollectedAt time.Time                         `json:"collected_at"` // Time of the last successful pwr collection
+	Power       []parser.PowerStatus              `json:"power"`
+	Batteries   map[string][]parser.BatteryStatus `json:"batteries"` // Keyed by unit label, e.g. "bat1"
+	System      *parser.SystemStatus              `json:"system,omitempty"`
+	// Stale is set when the last collection cycle failed, so the data is
+	// older than one refresh.
+	Stale bool `json:"stale"`
+}
+
+// Store keeps the latest Snapshot and is safe for concurrent use by the
+// collection loop and HTTP handlers.
+type Store struct {
+	mu        sync.RWMutex
+	snapshot  Snapshot
+	cycleDone chan struct{}
+}
+
+// NewStore returns an empty Store.
+func NewStore() *Store {
+	return &Store{
+		snapshot:  Snapshot{Batteries: map[string][]parser.BatteryStatus{}},
+		cycleDone: make(chan struct{}),
+	}
+}
+
+// CompleteCycle is called by the collection loop after each cycle and
+// releases everyone waiting on CycleDone.
+func (s *Store) CompleteCycle() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	close(s.cycleDone)
+	s.cycleDone = make(chan struct{})
+}
+
+// CycleDone returns a channel that is closed when the running collection
+// cycle completes.
+func (s *Store) CycleDone() <-chan struct{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cycleDone
+}
+
+// SetPower records freshly parsed pwr data and marks the snapshot as collected now.
+func (s *Store) SetPower(power []parser.PowerStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshot.Power = append([]parser.PowerStatus(nil), power...)
+	s.snapshot.CollectedAt = time.Now()
+}
+
+// SetBattery records freshly parsed bat data for a unit.
+func (s *Store) SetBattery(unitLabel string, batteries []parser.BatteryStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshot.Batteries[unitLabel] = append([]parser.BatteryStatus(nil), batteries...)
+}
+
+// SetSystem records freshly parsed pwrsys data.
+func (s *Store) SetSystem(system parser.SystemStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshot.System = &system
+}
+
+// SetStale records whether the last collection cycle failed.
+func (s *Store) SetStale(stale bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshot.Stale = stale
+}
+
+// Latest returns a copy of the current snapshot and whether any pwr data has
+// been collected yet.
+func (s *Store) Latest() (Snapshot, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	latest := s.snapshot
+	latest.Power = append([]parser.PowerStatus(nil), s.snapshot.Power...)
+	latest.Batteries = make(map[string][]parser.BatteryStatus, len(s.snapshot.Batteries))
+	for unitLabel, batteries := range s.snapshot.Batteries {
+		latest.Batteries[unitLabel] = append([]parser.BatteryStatus(nil), batteries...)
+	}
+	if s.snapshot.System != nil {
+		system := *s.snapshot.System
+		latest.System = &system
+	}
+	return latest, !s.snapshot.CollectedAt.IsZero()
+}
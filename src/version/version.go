@@ -0,0 +1,55 @@
+// Package version holds the build information of the exporter. The values
+// are set at build time, e.g.
+//
+//	go build -ldflags "-X pylontech_exporter/src/version.Version=v1.2.0
+//	  -X pylontech_exporter/src/version.Revision=$(git rev-parse HEAD)
+//	  -X pylontech_exporter/src/version.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+var (
+	Version   = "dev"
+	Revision  = "" // Git commit; taken from the VCS stamp of the Go toolchain when unset
+	BuildDate = "" // RFC 3339; taken from the commit time when unset
+)
+
+func init() {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if Revision == "" {
+				Revision = setting.Value
+			}
+		case "vcs.time":
+			if BuildDate == "" {
+				BuildDate = setting.Value
+			}
+		}
+	}
+}
+
+// GoVersion is the Go release the exporter was built with.
+func GoVersion() string {
+	return runtime.Version()
+}
+
+// String renders the build information for -version, e.g.
+// "v1.2.0 (revision 1a2b3c4, built 2026-01-02T10:00:00Z, go1.26.0)".
+func String() string {
+	return Version + " (revision " + orUnknown(Revision) + ", built " + orUnknown(BuildDate) + ", " + GoVersion() + ")"
+}
+
+func orUnknown(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	return value
+}
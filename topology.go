@@ -0,0 +1,75 @@
+package main
+
+import (
+	"log/slog"
+	"slices"
+	"time"
+)
+
+// unitTopology caches the unit IDs last seen in pwr, so a failed pwr fetch
+// does not stop bat collection and a briefly shorter pwr listing does not
+// drop units. New units are accepted at once; a listing that lacks units is
+// only accepted after it has been reported for shrinkAfter consecutive
+// cycles.
+type unitTopology struct {
+	ids         []int
+	confirmedAt time.Time
+	shrinkTo    []int
+	shrinkSeen  int
+	shrinkAfter int
+}
+
+// newUnitTopology accepts a shorter listing after shrinkAfter cycles
+// (UNIT_SHRINK_CYCLES).
+func newUnitTopology(shrinkAfter int) *unitTopology {
+	return &unitTopology{shrinkAfter: shrinkAfter}
+}
+
+// observe feeds the unit IDs of this cycle's pwr output (empty when pwr
+// failed) and returns the IDs to collect bat data for, along with where they
+// came from: "pwr", "cache", or "none" before pwr succeeded once.
+func (t *unitTopology) observe(pwrIDs []int, now time.Time) ([]int, string) {
+	switch {
+	case len(pwrIDs) == 0:
+		if len(t.ids) == 0 {
+			return nil, "none"
+		}
+		slog.Debug("PWR data unavailable, using the cached units", "units", t.ids)
+		return t.ids, "cache"
+
+	case containsAll(pwrIDs, t.ids):
+		if len(t.ids) > 0 && len(pwrIDs) > len(t.ids) {
+			slog.Info("Units grew", "from", t.ids, "to", pwrIDs)
+		}
+		t.ids = slices.Clone(pwrIDs)
+		t.confirmedAt = now
+		t.shrinkSeen = 0
+		return t.ids, "pwr"
+	}
+
+	if !slices.Equal(t.shrinkTo, pwrIDs) {
+		t.shrinkTo = slices.Clone(pwrIDs)
+		t.shrinkSeen = 0
+	}
+	t.shrinkSeen++
+	if t.shrinkSeen < t.shrinkAfter {
+		slog.Warn("PWR reports fewer units, keeping the cached units", "units", pwrIDs, "cached", t.ids, "cycles", t.shrinkSeen, "after", t.shrinkAfter)
+		return t.ids, "cache"
+	}
+
+	slog.Warn("Units shrank", "from", t.ids, "to", pwrIDs, "cycles", t.shrinkSeen)
+	t.ids = slices.Clone(pwrIDs)
+	t.confirmedAt = now
+	t.shrinkSeen = 0
+	return t.ids, "pwr"
+}
+
+// containsAll reports whether every id of subset is in ids.
+func containsAll(ids, subset []int) bool {
+	for _, id := range subset {
+		if !slices.Contains(ids, id) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"log/slog"
+	"strconv"
+	"time"
+
+	"pylontech_exporter/src/metrics"
+)
+
+// unitHealth backs off from units that keep failing, so one unit timing out
+// on every bat fetch does not stall the rest of the cycle. After
+// disableAfter consecutive failures a unit is skipped for two refresh
+// intervals and then probed once; every failed probe doubles the backoff up
+// to maxBackoff, and a success resumes the normal cadence.
+type unitHealth struct {
+	device       string
+	disableAfter int
+	interval     time.Duration
+	maxBackoff   time.Duration
+	streaks      map[int]int
+	backoffs     map[int]time.Duration // Current backoff of the units backed off from
+	benchedUntil map[int]time.Time
+}
+
+// newUnitHealth backs off from a unit after disableAfter consecutive failures
+// (UNIT_DISABLE_AFTER, 0 turns backoff off), starting at two refresh
+// intervals and capped at maxBackoff (UNIT_COOLDOWN).
+func newUnitHealth(device string, disableAfter int, interval, maxBackoff time.Duration) *unitHealth {
+	return &unitHealth{
+		device:       device,
+		disableAfter: disableAfter,
+		interval:     interval,
+		maxBackoff:   maxBackoff,
+		streaks:      map[int]int{},
+		backoffs:     map[int]time.Duration{},
+		benchedUntil: map[int]time.Time{},
+	}
+}
+
+// shouldFetch reports whether the unit is not backed off or due for its probe.
+func (h *unitHealth) shouldFetch(id int, now time.Time) bool {
+	until, benched := h.benchedUntil[id]
+	return !benched || !now.Before(until)
+}
+
+func (h *unitHealth) recordSuccess(id int) {
+	if _, benched := h.benchedUntil[id]; benched {
+		slog.Warn("Unit answered again, leaving backoff", "device", h.device, "unit", "bat"+strconv.Itoa(id), "failures", h.streaks[id])
+		delete(h.benchedUntil, id)
+		delete(h.backoffs, id)
+	}
+	h.streaks[id] = 0
+	metrics.SetUnitHealth(h.device, "bat"+strconv.Itoa(id), 0, 0)
+}
+
+func (h *unitHealth) recordFailure(id int, now time.Time) {
+	h.streaks[id]++
+	streak := h.streaks[id]
+	if h.disableAfter > 0 && streak >= h.disableAfter {
+		backoff, benched := h.backoffs[id]
+		if benched {
+			backoff *= 2
+		} else {
+			backoff = 2 * h.interval
+		}
+		backoff = min(backoff, h.maxBackoff)
+		if !benched {
+			slog.Warn("Unit failed repeatedly, backing off", "device", h.device, "unit", "bat"+strconv.Itoa(id), "failures", streak, "backoff", backoff.String())
+		} else {
+			slog.Debug("Unit still failing, extending backoff", "device", h.device, "unit", "bat"+strconv.Itoa(id), "failures", streak, "backoff", backoff.String())
+		}
+		h.backoffs[id] = backoff
+		h.benchedUntil[id] = now.Add(backoff)
+	}
+	metrics.SetUnitHealth(h.device, "bat"+strconv.Itoa(id), streak, h.backoffs[id])
+}
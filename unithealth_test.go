@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUnitHealthBacksOffExponentially(t *testing.T) {
+	h := newUnitHealth("default", 3, 10*time.Second, time.Minute)
+	now := time.Unix(1700000000, 0)
+
+	h.recordFailure(4, now)
+	h.recordFailure(4, now)
+	if !h.shouldFetch(4, now) {
+		t.Fatal("unit is backed off before UNIT_DISABLE_AFTER failures")
+	}
+
+	// Two refresh intervals, then doubling with every failed probe up to the cap
+	for _, want := range []time.Duration{20 * time.Second, 40 * time.Second, time.Minute, time.Minute} {
+		h.recordFailure(4, now)
+		if h.shouldFetch(4, now.Add(want-time.Second)) {
+			t.Fatalf("unit is probed before its backoff of %s has passed", want)
+		}
+		if !h.shouldFetch(4, now.Add(want)) {
+			t.Fatalf("unit is not probed after its backoff of %s", want)
+		}
+		if h.backoffs[4] != want {
+			t.Fatalf("backoff = %s, want %s", h.backoffs[4], want)
+		}
+		now = now.Add(want)
+	}
+
+	h.recordSuccess(4)
+	if !h.shouldFetch(4, now) || h.backoffs[4] != 0 || h.streaks[4] != 0 {
+		t.Fatalf("unit still backed off after a success: backoff %s, streak %d", h.backoffs[4], h.streaks[4])
+	}
+
+	// A success resets the streak, so a single failure does not back off again
+	h.recordFailure(4, now)
+	if !h.shouldFetch(4, now) {
+		t.Fatal("unit is backed off after one failure following a success")
+	}
+}
+
+func TestUnitHealthWithoutBackoff(t *testing.T) {
+	h := newUnitHealth("default", 0, 10*time.Second, time.Minute)
+	now := time.Unix(1700000000, 0)
+	for range 10 {
+		h.recordFailure(1, now)
+	}
+	if !h.shouldFetch(1, now) {
+		t.Fatal("unit is backed off with UNIT_DISABLE_AFTER=0")
+	}
+}
+
+func TestFetchDueUnitsSkipsFailingUnit(t *testing.T) {
+	h := newUnitHealth("default", 2, time.Hour, 4*time.Hour)
+	var mu sync.Mutex
+	var fetched []int
+	fetch := func(_ context.Context, unitID int) batResult {
+		mu.Lock()
+		fetched = append(fetched, unitID)
+		mu.Unlock()
+		if unitID == 2 {
+			return batResult{unitID: unitID, stage: "fetch", err: errors.New("timeout")}
+		}
+		return batResult{unitID: unitID}
+	}
+	cycle := func() []int {
+		fetched = nil
+		results := fetchDueUnits(context.Background(), h, []int{1, 2, 3}, 3, fetch)
+		if len(results) != len(fetched) {
+			t.Fatalf("%d results for %d fetched units", len(results), len(fetched))
+		}
+		slices.Sort(fetched)
+		return fetched
+	}
+
+	// Unit 2 is fetched until its second failure backs it off, the others
+	// keep their cadence
+	for i, want := range [][]int{{1, 2, 3}, {1, 2, 3}, {1, 3}, {1, 3}} {
+		if got := cycle(); !slices.Equal(got, want) {
+			t.Fatalf("cycle %d fetched %v, want %v", i+1, got, want)
+		}
+	}
+	if h.streaks[1] != 0 || h.streaks[2] != 2 {
+		t.Fatalf("streaks = %v, want only unit 2 failing", h.streaks)
+	}
+}
+
+func TestProcessBATDataFailsWithEveryUnitBackedOff(t *testing.T) {
+	h := newUnitHealth("default", 1, time.Hour, time.Hour)
+	now := time.Now()
+	h.recordFailure(1, now)
+	h.recordFailure(2, now)
+	c := &collectionCycle{name: "default", health: h, fetchConcurrency: 2}
+
+	// No console is needed, as no unit is due
+	if c.processBATData(context.Background(), []int{1, 2}) {
+		t.Fatal("processBATData reported success without collecting any unit")
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"pylontech_exporter/src/fetcher"
+	"pylontech_exporter/src/parser"
+
+	"golang.org/x/term"
+)
+
+type watchKey int
+
+const (
+	keyQuit watchKey = iota
+	keyPrev
+	keyNext
+	keyToggleCells
+)
+
+// watchView holds what the watch table currently shows.
+type watchView struct {
+	device    fetcher.Fetcher
+	power     []parser.PowerStatus
+	cells     []parser.BatteryStatus
+	selected  int
+	showCells bool
+	updated   time.Time
+	status    string
+}
+
+// runWatch renders a live-updating table of all modules of a device (the
+// first configured one unless named), plus the cells of the selected unit,
+// until q is pressed. It uses the same fetch/parse pipeline as the exporter
+// but starts no metrics server.
+func runWatch(refreshInterval time.Duration, deviceName string) error {
+	devices, err := fetcher.LoadDevices()
+	if err != nil {
+		return err
+	}
+	device := devices[0]
+	if deviceName != "" {
+		device = nil
+		for _, candidate := range devices {
+			if candidate.Name == deviceName {
+				device = candidate
+			}
+		}
+		if device == nil {
+			return fmt.Errorf("unknown device '%s'", deviceName)
+		}
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return fmt.Errorf("watch mode needs an interactive terminal")
+	}
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("failed to switch terminal to raw mode: %w", err)
+	}
+	defer term.Restore(fd, oldState)
+
+	// Parser and fetcher warnings would tear up the table; errors are shown in the footer instead.
+	previous := slog.Default()
+	useLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	defer useLogger(previous)
+
+	keys := make(chan watchKey)
+	go readWatchKeys(os.Stdin, keys)
+
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+
+	view := watchView{device: device, showCells: true}
+	view.refresh(true)
+	view.render(os.Stdout, refreshInterval)
+
+	for {
+		select {
+		case <-ticker.C:
+			view.refresh(true)
+		case key := <-keys:
+			switch key {
+			case keyQuit:
+				fmt.Fprint(os.Stdout, "\x1b[2J\x1b[H")
+				return nil
+			case keyPrev:
+				if view.selected > 0 {
+					view.selected--
+					view.refresh(false)
+				}
+			case keyNext:
+				if view.selected < len(view.power)-1 {
+					view.selected++
+					view.refresh(false)
+				}
+			case keyToggleCells:
+				view.showCells = !view.showCells
+				view.refresh(false)
+			}
+		}
+		view.render(os.Stdout, refreshInterval)
+	}
+}
+
+// readWatchKeys translates raw terminal input into watch keys.
+func readWatchKeys(r io.Reader, keys chan<- watchKey) {
+	buf := make([]byte, 8)
+	for {
+		n, err := r.Read(buf)
+		if err != nil {
+			keys <- keyQuit
+			return
+		}
+		input := string(buf[:n])
+		switch {
+		case input == "q" || input == "Q" || input == "\x03":
+			keys <- keyQuit
+		case input == "\x1b[A" || input == "\x1b[D":
+			keys <- keyPrev
+		case input == "\x1b[B" || input == "\x1b[C":
+			keys <- keyNext
+		case input == "c" || input == "\r":
+			keys <- keyToggleCells
+		}
+	}
+}
+
+// refresh fetches pwr (when includePower is set) and the cells of the
+// selected unit.
+func (v *watchView) refresh(includePower bool) {
+	v.status = ""
+	if includePower {
+		v.device.BeginCycle()
+		pwrLines, err := v.device.FetchConsoleOutput(context.Background(), "pwr")
+		if err != nil {
+			v.status = fmt.Sprintf("pwr fetch failed: %v", err)
+			return
+		}
+		power, err := deviceProfile.ParsePWR(pwrLines)
+		if err != nil {
+			v.status = fmt.Sprintf("pwr parse failed: %v", err)
+			return
+		}
+		v.power = power
+		v.updated = time.Now()
+		if v.selected >= len(v.power) {
+			v.selected = len(v.power) - 1
+		}
+		if v.selected < 0 {
+			v.selected = 0
+		}
+	}
+
+	if !v.showCells || len(v.power) == 0 {
+		v.cells = nil
+		return
+	}
+
+	command := "bat " + strconv.Itoa(v.power[v.selected].ID)
+	batLines, err := v.device.FetchConsoleOutput(context.Background(), command)
+	if err != nil {
+		v.status = fmt.Sprintf("%s fetch failed: %v", command, err)
+		v.cells = nil
+		return
+	}
+	cells, err := deviceProfile.ParseBAT(batLines)
+	if err != nil {
+		v.status = fmt.Sprintf("%s parse failed: %v", command, err)
+		v.cells = nil
+		return
+	}
+	v.cells = cells
+}
+
+func (v *watchView) render(w io.Writer, refreshInterval time.Duration) {
+	var b strings.Builder
+	b.WriteString("\x1b[2J\x1b[H")
+
+	updated := "never"
+	if !v.updated.IsZero() {
+		updated = v.updated.Format("15:04:05")
+	}
+	fmt.Fprintf(&b, "Pylontech watch - profile %s - updated %s (every %s)\r\n", deviceProfile.Name, updated, refreshInterval)
+	b.WriteString("q: quit   arrows: select unit   c/enter: toggle cells\r\n\r\n")
+
+	fmt.Fprintf(&b, "  %-6s %9s %9s %9s %5s %9s  %s\r\n", "Unit", "Volt(V)", "Curr(A)", "Power(W)", "SOC", "Temp(C)", "State")
+	for i, status := range v.power {
+		marker := " "
+		if i == v.selected {
+			marker = ">"
+		}
+		fmt.Fprintf(&b, "%s %-6s %9.3f %9.3f %9.1f %4d%% %9.1f  %s\r\n",
+			marker,
+			"bat"+strconv.Itoa(status.ID),
+			float64(status.Volt)/1000,
+			float64(status.Curr)/1000,
+			float64(status.Volt)*float64(status.Curr)/1e6,
+			status.Coulomb,
+			float64(status.Temp)/1000,
+			baseStateName(status.BaseState),
+		)
+	}
+
+	if v.showCells && len(v.power) > 0 {
+		fmt.Fprintf(&b, "\r\nCells of bat%d:\r\n", v.power[v.selected].ID)
+		fmt.Fprintf(&b, "  %-4s %8s %9s %8s %5s  %-8s %s\r\n", "Cell", "Volt(V)", "Curr(A)", "Temp(C)", "SOC", "State", "BAL")
+		for _, cell := range v.cells {
+			fmt.Fprintf(&b, "  %-4d %8.3f %9.3f %8.1f %4d%%  %-8s %s\r\n",
+				cell.ID,
+				float64(cell.Volt)/1000,
+				float64(cell.Curr)/1000,
+				float64(cell.Temp)/1000,
+				cell.SOC,
+				baseStateName(cell.BaseState),
+				cell.BAL,
+			)
+		}
+	}
+
+	if v.status != "" {
+		fmt.Fprintf(&b, "\r\n%s\r\n", v.status)
+	}
+	io.WriteString(w, b.String())
+}
+
+// baseStateName is the inverse of the default base state codes.
+func baseStateName(state int8) string {
+	switch state {
+	case 0:
+		return "Charge"
+	case 1:
+		return "Dischg"
+	case 2:
+		return "Idle"
+	case 3:
+		return "Balance"
+	}
+	return "-"
+}